@@ -0,0 +1,38 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// ==========================
+// Admin methods here
+// ==========================
+
+// GET /db/api/admin/slowlog/?limit=N, the N slowest statements (10 by default),
+// their args only with -slow-log-args
+func adminHandler(w http.ResponseWriter, r *http.Request, inputRequest *InputRequest, store Store) {
+	if inputRequest.method != "GET" || inputRequest.path != "/db/api/admin/slowlog/" {
+		return
+	}
+
+	limit := 10
+	if len(inputRequest.query["limit"]) == 1 {
+		n, err := strconv.Atoi(inputRequest.query["limit"][0])
+		if err != nil || n < 0 {
+			io.WriteString(w, createInvalidQuery())
+			return
+		}
+		limit = n
+	}
+
+	entries := slowQueries.top(limit)
+
+	responseInterface := make([]interface{}, len(entries))
+	for i, v := range entries {
+		responseInterface[i] = v
+	}
+
+	io.WriteString(w, createResponseFromArray(0, responseInterface))
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"container/list"
+	"strconv"
+	"sync"
+	"time"
+
+	rs "technopark-db/response"
+)
+
+// =================
+// Cache here
+// =================
+
+// lruCache is a bounded map from keys to values that expire after ttl.
+// When it is full the least recently used entry is dropped.
+type lruCache struct {
+	name string // label of the hit/miss metrics
+	size int
+	ttl  time.Duration
+
+	mu    sync.Mutex
+	items map[string]*list.Element
+	order *list.List // most recently used first
+}
+
+type cacheEntry struct {
+	key     string
+	value   interface{}
+	expires time.Time
+}
+
+func newLRUCache(name string, size int, ttl time.Duration) *lruCache {
+	return &lruCache{
+		name:  name,
+		size:  size,
+		ttl:   ttl,
+		items: make(map[string]*list.Element, size),
+		order: list.New(),
+	}
+}
+
+func (c *lruCache) get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem := c.items[key]
+	if elem != nil && time.Now().After(elem.Value.(*cacheEntry).expires) {
+		c.order.Remove(elem)
+		delete(c.items, key)
+		elem = nil
+	}
+
+	if elem == nil {
+		cacheRequests.WithLabelValues(c.name, "miss").Inc()
+		return nil, false
+	}
+
+	cacheRequests.WithLabelValues(c.name, "hit").Inc()
+	c.order.MoveToFront(elem)
+	return elem.Value.(*cacheEntry).value, true
+}
+
+func (c *lruCache) put(key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires := time.Now().Add(c.ttl)
+
+	if elem := c.items[key]; elem != nil {
+		entry := elem.Value.(*cacheEntry)
+		entry.value, entry.expires = value, expires
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	if c.order.Len() >= c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).key)
+	}
+
+	c.items[key] = c.order.PushFront(&cacheEntry{key: key, value: value, expires: expires})
+}
+
+func (c *lruCache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem := c.items[key]; elem != nil {
+		c.order.Remove(elem)
+		delete(c.items, key)
+	}
+}
+
+func (c *lruCache) purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.items = make(map[string]*list.Element, c.size)
+	c.order.Init()
+}
+
+// ======================
+// Cached store here
+// ======================
+
+// CachedStore keeps users, their lists, forums and threads of the wrapped
+// Store in memory, size entries of each for at most ttl. Writes through it
+// drop the entries they change; writes made around it (another server on
+// the same database) show up once the entries expire.
+//
+// Values are cached as copies and handed out as copies, lists and string
+// pointers included, handlers are free to change what they get.
+type CachedStore struct {
+	Store
+
+	users         *lruCache
+	followers     *lruCache
+	following     *lruCache
+	subscriptions *lruCache
+	forums        *lruCache
+	threads       *lruCache
+
+	// Invalidations to repeat once the unit of work ends, nil outside Tx.
+	// A reader may cache the committed row between a write and its commit.
+	pending *[]func()
+}
+
+func NewCachedStore(store Store, size int, ttl time.Duration) *CachedStore {
+	return &CachedStore{
+		Store:         store,
+		users:         newLRUCache("user", size, ttl),
+		followers:     newLRUCache("followers", size, ttl),
+		following:     newLRUCache("following", size, ttl),
+		subscriptions: newLRUCache("subscriptions", size, ttl),
+		forums:        newLRUCache("forum", size, ttl),
+		threads:       newLRUCache("thread", size, ttl),
+	}
+}
+
+// Value of key from c or from load. Inside a unit of work the cache is
+// skipped both ways, load may see writes that are not committed yet.
+func (s *CachedStore) cached(c *lruCache, key string, load func() (interface{}, error)) (interface{}, error) {
+	if s.pending != nil {
+		return load()
+	}
+
+	if value, ok := c.get(key); ok {
+		return value, nil
+	}
+
+	value, err := load()
+	if err != nil {
+		return nil, err
+	}
+	c.put(key, value)
+	return value, nil
+}
+
+func (s *CachedStore) invalidate(c *lruCache, key string) {
+	c.remove(key)
+	if s.pending != nil {
+		*s.pending = append(*s.pending, func() { c.remove(key) })
+	}
+}
+
+func threadKey(id int64) string {
+	return strconv.FormatInt(id, 10)
+}
+
+func (s *CachedStore) Tx(fn func(tx Store) error) error {
+	// already in one, as the SQL stores do
+	if s.pending != nil {
+		return fn(s)
+	}
+
+	var pending []func()
+	err := s.Store.Tx(func(tx Store) error {
+		cachedTx := *s
+		cachedTx.Store, cachedTx.pending = tx, &pending
+		return fn(&cachedTx)
+	})
+
+	for _, remove := range pending {
+		remove()
+	}
+	return err
+}
+
+// users
+
+func (s *CachedStore) GetUser(email string) (*rs.UserDetails, error) {
+	value, err := s.cached(s.users, email, func() (interface{}, error) {
+		user, err := s.Store.GetUser(email)
+		if err != nil {
+			return nil, err
+		}
+		return copyUser(*user), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	user := copyUser(value.(rs.UserDetails))
+	return &user, nil
+}
+
+// Copy of user that shares no string or list with it
+func copyUser(user rs.UserDetails) rs.UserDetails {
+	for _, field := range []**string{&user.Username, &user.About, &user.Name} {
+		if *field != nil {
+			value := **field
+			*field = &value
+		}
+	}
+
+	if list, ok := user.Followers.([]string); ok {
+		user.Followers = copyStrings(list)
+	}
+	if list, ok := user.Following.([]string); ok {
+		user.Following = copyStrings(list)
+	}
+	if list, ok := user.Subscriptions.([]int); ok {
+		user.Subscriptions = copyInts(list)
+	}
+	return user
+}
+
+func copyStrings(list []string) []string {
+	if list == nil {
+		return nil
+	}
+	return append(make([]string, 0, len(list)), list...)
+}
+
+func copyInts(list []int) []int {
+	if list == nil {
+		return nil
+	}
+	return append(make([]int, 0, len(list)), list...)
+}
+
+func (s *CachedStore) UpdateUser(email, about, name string) error {
+	defer s.invalidate(s.users, email)
+	return s.Store.UpdateUser(email, about, name)
+}
+
+// follows
+
+func (s *CachedStore) Follow(follower, followee string) error {
+	defer s.invalidateFollow(follower, followee)
+	return s.Store.Follow(follower, followee)
+}
+
+func (s *CachedStore) Unfollow(follower, followee string) error {
+	defer s.invalidateFollow(follower, followee)
+	return s.Store.Unfollow(follower, followee)
+}
+
+func (s *CachedStore) invalidateFollow(follower, followee string) {
+	s.invalidate(s.following, follower)
+	s.invalidate(s.followers, followee)
+}
+
+func (s *CachedStore) GetFollowers(email string) ([]string, error) {
+	value, err := s.cached(s.followers, email, func() (interface{}, error) {
+		list, err := s.Store.GetFollowers(email)
+		return copyStrings(list), err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return copyStrings(value.([]string)), nil
+}
+
+func (s *CachedStore) GetFollowing(email string) ([]string, error) {
+	value, err := s.cached(s.following, email, func() (interface{}, error) {
+		list, err := s.Store.GetFollowing(email)
+		return copyStrings(list), err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return copyStrings(value.([]string)), nil
+}
+
+// forums
+
+func (s *CachedStore) GetForum(shortName string) (*rs.ForumDetails, error) {
+	value, err := s.cached(s.forums, shortName, func() (interface{}, error) {
+		forum, err := s.Store.GetForum(shortName)
+		if err != nil {
+			return nil, err
+		}
+		return *forum, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	forum := value.(rs.ForumDetails)
+	return &forum, nil
+}
+
+// threads
+
+func (s *CachedStore) GetThread(id int64) (*rs.ThreadDetails, error) {
+	value, err := s.cached(s.threads, threadKey(id), func() (interface{}, error) {
+		thread, err := s.Store.GetThread(id)
+		if err != nil {
+			return nil, err
+		}
+		return *thread, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	thread := value.(rs.ThreadDetails)
+	return &thread, nil
+}
+
+func (s *CachedStore) UpdateThread(id int64, message, slug string, editor *string) error {
+	defer s.invalidate(s.threads, threadKey(id))
+	return s.Store.UpdateThread(id, message, slug, editor)
+}
+
+func (s *CachedStore) VoteThread(id int64, vote int) error {
+	defer s.invalidate(s.threads, threadKey(id))
+	return s.Store.VoteThread(id, vote)
+}
+
+func (s *CachedStore) SetThreadClosed(id int64, closed bool) (bool, error) {
+	defer s.invalidate(s.threads, threadKey(id))
+	return s.Store.SetThreadClosed(id, closed)
+}
+
+func (s *CachedStore) RemoveThread(id int64) (bool, error) {
+	defer s.invalidate(s.threads, threadKey(id))
+	return s.Store.RemoveThread(id)
+}
+
+func (s *CachedStore) RestoreThread(id int64) (bool, error) {
+	defer s.invalidate(s.threads, threadKey(id))
+	return s.Store.RestoreThread(id)
+}
+
+func (s *CachedStore) UpdateThreadPosts(id int64, delta int) error {
+	defer s.invalidate(s.threads, threadKey(id))
+	return s.Store.UpdateThreadPosts(id, delta)
+}
+
+// Counters of posts are not cached, only threads have to be dropped
+func (s *CachedStore) SetVote(target string, id int64, user string, vote int) error {
+	if target == "thread" {
+		defer s.invalidate(s.threads, threadKey(id))
+	}
+	return s.Store.SetVote(target, id, user, vote)
+}
+
+// subscriptions
+
+func (s *CachedStore) Subscribe(thread int64, user string) error {
+	defer s.invalidate(s.subscriptions, user)
+	return s.Store.Subscribe(thread, user)
+}
+
+func (s *CachedStore) Unsubscribe(thread int64, user string) (bool, error) {
+	defer s.invalidate(s.subscriptions, user)
+	return s.Store.Unsubscribe(thread, user)
+}
+
+func (s *CachedStore) GetSubscriptions(email string) ([]int, error) {
+	value, err := s.cached(s.subscriptions, email, func() (interface{}, error) {
+		list, err := s.Store.GetSubscriptions(email)
+		return copyInts(list), err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return copyInts(value.([]int)), nil
+}
+
+// information
+
+func (s *CachedStore) Clear() error {
+	defer func() {
+		for _, c := range []*lruCache{s.users, s.followers, s.following, s.subscriptions, s.forums, s.threads} {
+			c.purge()
+		}
+	}()
+	return s.Store.Clear()
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// =================
+// Config here
+// =================
+
+// Config holds the server settings. Every setting is read from, last one
+// wins: the defaults, the -config YAML file, a TECHNOPARK_* env var, a flag.
+type Config struct {
+	Storage string // memory, mysql, postgres or sqlite
+	DSN     string // database to open, the file name for sqlite
+	Listen  string // host:port of the API
+
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration // 0 keeps connections forever
+
+	LogFile    string // empty for stderr
+	LogFormat  string // json or logfmt
+	LogLevel   string // debug, info, warn or error
+	LogMaxSize int    // MB before the file is rotated, 0 never rotates
+	LogBackups int    // rotated files kept
+
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+
+	ShutdownTimeout time.Duration // how long requests may drain on SIGTERM
+
+	SlowQueryThreshold time.Duration // 0 keeps no slow query log
+	SlowQueryExplain   bool          // EXPLAIN slow SELECTs
+	SlowLogSize        int           // distinct queries kept
+	SlowLogArgs        bool          // args in /db/api/admin/slowlog/
+
+	CacheSize int           // entries of each cache, 0 turns the cache off
+	CacheTTL  time.Duration // how long an entry may be served
+
+	NotifyQueue   int // posts waiting for their notifications, more wait for the sweep
+	NotifyWorkers int // goroutines writing notifications, 0 turns them off
+
+	StreamHistory int // thread events kept for streams that reconnect
+
+	LiveMaxChannels int // channels a live gateway client may subscribe to
+	LiveSendBuffer  int // messages waiting for a live client, more are dropped
+
+	AnonymousVotes bool // votes without a user, each one counted
+}
+
+func defaultConfig() *Config {
+	return &Config{
+		Storage:      "mysql",
+		Listen:       ":5000",
+		MaxOpenConns: 10,
+		MaxIdleConns: 2,
+		LogFormat:    "json",
+		LogLevel:     "info",
+		LogMaxSize:   100,
+		LogBackups:   5,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+		IdleTimeout:  60 * time.Second,
+
+		ShutdownTimeout: 30 * time.Second,
+
+		SlowQueryThreshold: 100 * time.Millisecond,
+		SlowLogSize:        50,
+
+		CacheSize: 10000,
+		CacheTTL:  time.Minute,
+
+		NotifyQueue:   1000,
+		NotifyWorkers: 2,
+
+		StreamHistory: 1000,
+
+		LiveMaxChannels: 100,
+		LiveSendBuffer:  256,
+	}
+}
+
+// One setting: flag -name, env TECHNOPARK_NAME, file key name with '_'
+type setting struct {
+	name  string
+	usage string
+	field func(c *Config) interface{} // pointer to the Config field
+}
+
+var settings = []setting{
+	{"storage", "storage backend: memory, mysql, postgres or sqlite", func(c *Config) interface{} { return &c.Storage }},
+	{"dsn", "database to open, a file for sqlite", func(c *Config) interface{} { return &c.DSN }},
+	{"listen", "address of the API, host:port", func(c *Config) interface{} { return &c.Listen }},
+	{"max-open-conns", "max open db connections", func(c *Config) interface{} { return &c.MaxOpenConns }},
+	{"max-idle-conns", "max idle db connections", func(c *Config) interface{} { return &c.MaxIdleConns }},
+	{"conn-max-lifetime", "max lifetime of a db connection, 0 for no limit", func(c *Config) interface{} { return &c.ConnMaxLifetime }},
+	{"log-file", "log file, stderr when empty", func(c *Config) interface{} { return &c.LogFile }},
+	{"log-format", "log line format: json or logfmt", func(c *Config) interface{} { return &c.LogFormat }},
+	{"log-level", "lowest level logged: debug, info, warn or error", func(c *Config) interface{} { return &c.LogLevel }},
+	{"log-max-size", "MB the log file may grow to before it is rotated, 0 never rotates", func(c *Config) interface{} { return &c.LogMaxSize }},
+	{"log-backups", "rotated log files kept", func(c *Config) interface{} { return &c.LogBackups }},
+	{"read-timeout", "max time to read a request", func(c *Config) interface{} { return &c.ReadTimeout }},
+	{"write-timeout", "max time to write a response", func(c *Config) interface{} { return &c.WriteTimeout }},
+	{"idle-timeout", "max time a keep-alive connection waits for the next request", func(c *Config) interface{} { return &c.IdleTimeout }},
+	{"shutdown-timeout", "max time to drain requests on SIGINT or SIGTERM", func(c *Config) interface{} { return &c.ShutdownTimeout }},
+	{"slow-query-threshold", "log statements slower than this, 0 for none", func(c *Config) interface{} { return &c.SlowQueryThreshold }},
+	{"slow-query-explain", "store the EXPLAIN plan of slow SELECTs", func(c *Config) interface{} { return &c.SlowQueryExplain }},
+	{"slow-log-size", "distinct statements kept in the slow query log", func(c *Config) interface{} { return &c.SlowLogSize }},
+	{"slow-log-args", "show the args of slow statements, emails and messages among them, in the admin slowlog", func(c *Config) interface{} { return &c.SlowLogArgs }},
+	{"cache-size", "users, forums and threads cached of each, 0 turns the cache off", func(c *Config) interface{} { return &c.CacheSize }},
+	{"cache-ttl", "max time a cached user, forum or thread is served", func(c *Config) interface{} { return &c.CacheTTL }},
+	{"notify-queue", "new posts waiting to notify subscribers, more wait for the next sweep", func(c *Config) interface{} { return &c.NotifyQueue }},
+	{"notify-workers", "goroutines notifying subscribers of new posts, 0 turns notifications off", func(c *Config) interface{} { return &c.NotifyWorkers }},
+	{"stream-history", "thread events kept for streams that reconnect with Last-Event-ID", func(c *Config) interface{} { return &c.StreamHistory }},
+	{"live-max-channels", "channels a live gateway client may subscribe to", func(c *Config) interface{} { return &c.LiveMaxChannels }},
+	{"live-send-buffer", "messages waiting for a live gateway client, more are dropped", func(c *Config) interface{} { return &c.LiveSendBuffer }},
+	{"anonymous-votes", "accept votes without a user, counted every time, for old clients", func(c *Config) interface{} { return &c.AnonymousVotes }},
+}
+
+func (s setting) env() string {
+	return "TECHNOPARK_" + strings.ToUpper(strings.Replace(s.name, "-", "_", -1))
+}
+
+func (s setting) key() string {
+	return strings.Replace(s.name, "-", "_", -1)
+}
+
+func (s setting) get(c *Config) string {
+	switch field := s.field(c).(type) {
+	case *string:
+		return *field
+	case *int:
+		return strconv.Itoa(*field)
+	case *time.Duration:
+		return field.String()
+	case *bool:
+		return strconv.FormatBool(*field)
+	}
+	return ""
+}
+
+// Parse value into the setting's field of c
+func (s setting) set(c *Config, value string) error {
+	switch field := s.field(c).(type) {
+	case *string:
+		*field = value
+
+	case *int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", value)
+		}
+		*field = n
+
+	case *time.Duration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration like 10s or 1m", value)
+		}
+		*field = d
+
+	case *bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", value)
+		}
+		*field = b
+	}
+
+	return nil
+}
+
+// Read the config from args (without the program name), the environment and
+// the config file. The remaining args are returned for the subcommands.
+func loadConfig(args []string) (*Config, []string, error) {
+	fs := flag.NewFlagSet("technopark-db", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: technopark-db [flags] [migrate up|down|status|force <version> | stress [replies] [workers]]")
+		fs.PrintDefaults()
+	}
+
+	configFile := fs.String("config", os.Getenv("TECHNOPARK_CONFIG"), "YAML config file, env TECHNOPARK_CONFIG")
+
+	// flags are applied last, keep them until then
+	defaults := defaultConfig()
+	flags := make(map[string]string)
+	for _, s := range settings {
+		name := s.name
+		usage := fmt.Sprintf("%s, env %s", s.usage, s.env())
+		if value := s.get(defaults); value != "" && value != "0" && value != "0s" && value != "false" {
+			usage += " (default " + value + ")"
+		}
+		keep := func(value string) error {
+			flags[name] = value
+			return nil
+		}
+		// -name alone turns a bool setting on
+		if _, ok := s.field(defaults).(*bool); ok {
+			fs.BoolFunc(name, usage, keep)
+		} else {
+			fs.Func(name, usage, keep)
+		}
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	c := defaultConfig()
+
+	if *configFile != "" {
+		if err := c.loadFile(*configFile); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for _, s := range settings {
+		if value, ok := os.LookupEnv(s.env()); ok {
+			if err := s.set(c, value); err != nil {
+				return nil, nil, fmt.Errorf("%s: %v", s.env(), err)
+			}
+		}
+	}
+
+	for _, s := range settings {
+		if value, ok := flags[s.name]; ok {
+			if err := s.set(c, value); err != nil {
+				return nil, nil, fmt.Errorf("-%s: %v", s.name, err)
+			}
+		}
+	}
+
+	if err := c.validate(); err != nil {
+		return nil, nil, err
+	}
+
+	return c, fs.Args(), nil
+}
+
+// Apply the settings of a YAML file, a flat map of setting keys
+func (c *Config) loadFile(file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	values := make(map[string]string)
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("%s: %v", file, err)
+	}
+
+	for key, value := range values {
+		found := false
+		for _, s := range settings {
+			if s.key() != key {
+				continue
+			}
+			if err := s.set(c, value); err != nil {
+				return fmt.Errorf("%s: %s: %v", file, key, err)
+			}
+			found = true
+		}
+
+		if !found {
+			return fmt.Errorf("%s: unknown setting %q", file, key)
+		}
+	}
+
+	return nil
+}
+
+// Split the older -storage=driver:dsn form into driver and dsn
+func parseStorage(storage string) (driver, dsn string) {
+	driver = storage
+	if i := strings.Index(storage, ":"); i >= 0 {
+		driver, dsn = storage[:i], storage[i+1:]
+	}
+	return driver, dsn
+}
+
+func (c *Config) validate() error {
+	// -storage=driver:dsn as before -dsn
+	if driver, dsn := parseStorage(c.Storage); dsn != "" {
+		if c.DSN != "" {
+			return errors.New("storage: dsn given twice, in storage and dsn")
+		}
+		c.Storage, c.DSN = driver, dsn
+	}
+
+	switch c.Storage {
+	case "memory":
+	case "sqlite":
+		if c.DSN == "" {
+			c.DSN = "technopark.db"
+		}
+	case "mysql", "postgres":
+		if c.DSN == "" {
+			return fmt.Errorf("dsn: storage %s needs a dsn, set -dsn or TECHNOPARK_DSN", c.Storage)
+		}
+	default:
+		return fmt.Errorf("storage: unknown storage %q, want memory, mysql, postgres or sqlite", c.Storage)
+	}
+
+	// a bare port listens on all interfaces
+	if _, err := strconv.Atoi(c.Listen); err == nil {
+		c.Listen = ":" + c.Listen
+	}
+	if _, _, err := net.SplitHostPort(c.Listen); err != nil {
+		return fmt.Errorf("listen: %v", err)
+	}
+
+	if c.MaxOpenConns <= 0 {
+		return fmt.Errorf("max-open-conns: %d, want at least 1", c.MaxOpenConns)
+	}
+	if c.MaxIdleConns < 0 || c.MaxIdleConns > c.MaxOpenConns {
+		return fmt.Errorf("max-idle-conns: %d, want 0 to max-open-conns (%d)", c.MaxIdleConns, c.MaxOpenConns)
+	}
+
+	if c.LogFormat != "json" && c.LogFormat != "logfmt" {
+		return fmt.Errorf("log-format: %q, want json or logfmt", c.LogFormat)
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		return fmt.Errorf("log-level: %q, want debug, info, warn or error", c.LogLevel)
+	}
+	if c.LogMaxSize < 0 || c.LogBackups < 0 {
+		return fmt.Errorf("log-max-size and log-backups: want 0 or more")
+	}
+	if c.SlowLogSize <= 0 {
+		return fmt.Errorf("slow-log-size: %d, want at least 1", c.SlowLogSize)
+	}
+	if c.CacheSize < 0 {
+		return fmt.Errorf("cache-size: %d, want 0 or more", c.CacheSize)
+	}
+	if c.CacheSize > 0 && c.CacheTTL == 0 {
+		return errors.New("cache-ttl: 0, want more, or cache-size 0 to turn the cache off")
+	}
+	if c.NotifyWorkers < 0 {
+		return fmt.Errorf("notify-workers: %d, want 0 or more", c.NotifyWorkers)
+	}
+	if c.NotifyWorkers > 0 && c.NotifyQueue <= 0 {
+		return fmt.Errorf("notify-queue: %d, want at least 1, or notify-workers 0 to turn notifications off", c.NotifyQueue)
+	}
+	if c.StreamHistory < 0 {
+		return fmt.Errorf("stream-history: %d, want 0 or more", c.StreamHistory)
+	}
+	if c.LiveMaxChannels <= 0 {
+		return fmt.Errorf("live-max-channels: %d, want at least 1", c.LiveMaxChannels)
+	}
+	if c.LiveSendBuffer <= 0 {
+		return fmt.Errorf("live-send-buffer: %d, want at least 1", c.LiveSendBuffer)
+	}
+
+	for _, s := range settings {
+		if d, ok := s.field(c).(*time.Duration); ok && *d < 0 {
+			return fmt.Errorf("%s: %v, want 0 or more", s.name, *d)
+		}
+	}
+
+	return nil
+}
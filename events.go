@@ -0,0 +1,302 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	rs "technopark-db/response"
+)
+
+// =================
+// Thread events here
+// =================
+
+// threadEvent is a change of a thread or of a post in it, as the stream
+// sends it. Ids count the events of all threads in this process.
+type threadEvent struct {
+	id     int64
+	thread int64
+	name   string // thread_close, post_create ...
+	data   []byte // JSON
+}
+
+// eventSubscriber gets the events of one thread. A subscriber that lets
+// its buffer fill up is dropped: its channel is closed and the client
+// comes back with Last-Event-ID.
+type eventSubscriber struct {
+	thread int64
+	events chan threadEvent
+}
+
+// Events a subscriber may be behind before it is dropped
+const subscriberBuffer = 64
+
+// eventBus hands the events that handlers publish to the streams of their
+// thread. The last history events of all threads are kept, so a client
+// that reconnects gets the ones it missed.
+type eventBus struct {
+	mu          sync.Mutex
+	size        int // events kept
+	lastId      int64
+	history     []threadEvent // oldest first, the last size of them count
+	subscribers map[int64]map[*eventSubscriber]bool
+	closed      bool
+}
+
+// Handlers publish here, the thread streams subscribe
+var threadEvents = &eventBus{subscribers: make(map[int64]map[*eventSubscriber]bool)}
+
+func (b *eventBus) configure(size int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.size = size
+}
+
+// Events still kept, oldest first, called with mu held
+func (b *eventBus) kept() []threadEvent {
+	if len(b.history) > b.size {
+		return b.history[len(b.history)-b.size:]
+	}
+	return b.history
+}
+
+// Publish an event of thread with data as its JSON. Subscribers too slow
+// to take it are dropped, publish never waits.
+func (b *eventBus) publish(thread int64, name string, data interface{}) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		slog.Error("can't encode event", "event", name, "error", err)
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+
+	b.lastId++
+	event := threadEvent{id: b.lastId, thread: thread, name: name, data: encoded}
+	streamEvents.WithLabelValues(name).Inc()
+
+	if b.size > 0 {
+		b.history = append(b.history, event)
+		// trim now and then, not on every event
+		if len(b.history) >= 2*b.size {
+			b.history = append([]threadEvent(nil), b.kept()...)
+		}
+	}
+
+	for sub := range b.subscribers[thread] {
+		select {
+		case sub.events <- event:
+		default:
+			slog.Warn("stream lagging, dropped", "thread", thread, "event", event.id)
+			streamLagged.Inc()
+			b.remove(sub)
+		}
+	}
+}
+
+// Subscribe to the events of thread after the event lastId, 0 for only the
+// new ones. The missed events come back at once; complete is false when
+// some of them are no longer kept or lastId is from before a restart. The
+// subscriber is nil once the bus is closed.
+func (b *eventBus) subscribe(thread, lastId int64) (sub *eventSubscriber, missed []threadEvent, complete bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, nil, false
+	}
+
+	kept := b.kept()
+	complete = lastId == 0 || lastId == b.lastId || lastId < b.lastId && len(kept) > 0 && lastId >= kept[0].id-1
+
+	if lastId != 0 {
+		for _, event := range kept {
+			if event.id > lastId && event.thread == thread {
+				missed = append(missed, event)
+			}
+		}
+	}
+
+	sub = &eventSubscriber{thread: thread, events: make(chan threadEvent, subscriberBuffer)}
+	if b.subscribers[thread] == nil {
+		b.subscribers[thread] = make(map[*eventSubscriber]bool)
+	}
+	b.subscribers[thread][sub] = true
+
+	return sub, missed, complete
+}
+
+func (b *eventBus) unsubscribe(sub *eventSubscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.remove(sub)
+}
+
+// Drop sub and close its channel, called with mu held
+func (b *eventBus) remove(sub *eventSubscriber) {
+	subs := b.subscribers[sub.thread]
+	if !subs[sub] {
+		return
+	}
+
+	close(sub.events)
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(b.subscribers, sub.thread)
+	}
+}
+
+// End every stream and take no more, for the shutdown: streams never go
+// idle on their own
+func (b *eventBus) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for _, subs := range b.subscribers {
+		for sub := range subs {
+			b.remove(sub)
+		}
+	}
+}
+
+func (b *eventBus) clients() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n := 0
+	for _, subs := range b.subscribers {
+		n += len(subs)
+	}
+	return n
+}
+
+// ======================
+// Thread stream here
+// ======================
+
+const (
+	streamRetry     = 3 * time.Second  // EventSource reconnect delay
+	streamHeartbeat = 15 * time.Second // keeps proxies from closing a quiet stream
+	streamWrite     = 10 * time.Second // a client that takes longer for a write is gone
+)
+
+// Write one event in the text/event-stream format
+func writeEvent(w io.Writer, event threadEvent) error {
+	_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.id, event.name, event.data)
+	return err
+}
+
+// Stream the events of a thread as Server-Sent Events. The thread is
+// checked first and errors are API responses as usual, the stream then
+// runs until the client leaves or the server shuts down. After a reset
+// event the client can't catch up by events and has to reload the thread.
+func (t *Thread) stream(w http.ResponseWriter, r *http.Request) {
+	// Validate query values
+	if len(t.inputRequest.query["thread"]) != 1 {
+		io.WriteString(w, createInvalidResponse())
+		return
+	}
+	threadId, ok := parseId(t.inputRequest.query["thread"][0])
+	if !ok {
+		io.WriteString(w, createInvalidResponse())
+		return
+	}
+
+	// EventSource sends the header, lastEventId is for clients that can't
+	lastId := r.Header.Get("Last-Event-ID")
+	if lastId == "" && len(t.inputRequest.query["lastEventId"]) >= 1 {
+		lastId = t.inputRequest.query["lastEventId"][0]
+	}
+	var after int64
+	if lastId != "" {
+		var err error
+		if after, err = strconv.ParseInt(lastId, 10, 64); err != nil || after < 0 {
+			io.WriteString(w, createInvalidResponse())
+			return
+		}
+	}
+
+	if _, err := t.store.GetThread(threadId); err != nil {
+		io.WriteString(w, createErrorResponse(t.inputRequest, err))
+		return
+	}
+
+	sub, missed, complete := threadEvents.subscribe(threadId, after)
+	if sub == nil {
+		io.WriteString(w, unknownErrorResponse) // shutting down
+		return
+	}
+	defer threadEvents.unsubscribe(sub)
+
+	// the write timeout is for responses, a stream has one per write
+	rc := http.NewResponseController(w)
+	deadline := func() {
+		if err := rc.SetWriteDeadline(time.Now().Add(streamWrite)); err != nil {
+			t.inputRequest.log.Warn("stream keeps the write timeout", "error", err)
+		}
+	}
+	deadline()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(w, "retry: %d\n\n", streamRetry.Milliseconds())
+	if !complete {
+		data, _ := json.Marshal(&rs.ThreadBoolBasic{Thread: float64(threadId)})
+		fmt.Fprintf(w, "event: reset\ndata: %s\n\n", data)
+	}
+	for _, event := range missed {
+		writeEvent(w, event)
+	}
+	if err := rc.Flush(); err != nil {
+		t.inputRequest.log.Warn("stream can't flush", "error", err)
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		var err error
+
+		select {
+		case event, ok := <-sub.events:
+			if !ok {
+				return // dropped or shutting down, the client reconnects
+			}
+			deadline()
+			err = writeEvent(w, event)
+
+		case <-heartbeat.C:
+			deadline()
+			_, err = io.WriteString(w, ": ping\n\n")
+
+		case <-r.Context().Done():
+			return
+		}
+
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			t.inputRequest.log.Debug("stream closed", "error", err)
+			return
+		}
+	}
+}
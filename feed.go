@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+
+	rs "technopark-db/response"
+)
+
+// =================
+// Feed here
+// =================
+
+// Threads and posts share the feed, and so the cursors: the key of a feed
+// item is 2*id+1 for a thread and 2*id for a post. Items of the same date
+// are ordered by key.
+func feedKey(table string, id int64) int64 {
+	if table == "thread" {
+		return 2*id + 1
+	}
+	return 2 * id
+}
+
+// Items of a feed page, when the limit is not given and at most. The feed
+// of a user with many followees never ends, so it always comes in pages.
+const (
+	feedPageSize = 50
+	feedMaxPage  = 200
+)
+
+// Table and id of a feed key
+func feedRow(key int64) (string, int64) {
+	if key%2 == 1 {
+		return "thread", key / 2
+	}
+	return "post", key / 2
+}
+
+// Query of the keys of a feed page for the SQL stores. Threads and posts
+// of the followees are cut to the page each before they are merged, both
+// read from follow and then their (user, date) index. user is the user
+// column as the dialect names it, afterDate the date of the opts.After item.
+func feedQuery(args *[]interface{}, email string, opts ListOptions, afterDate, user string) string {
+	part := func(table string) string {
+		key := fmt.Sprintf("%s.id * 2 + %d", table, feedKey(table, 0))
+
+		query := fmt.Sprintf("SELECT %[1]s.date AS date, %[2]s AS feed_key FROM follow"+
+			" JOIN %[1]s ON %[1]s.%[3]s = follow.followee"+
+			" WHERE follow.follower = ? AND NOT %[1]s.isDeleted", table, key, user)
+		*args = append(*args, email)
+
+		if opts.Since != "" {
+			query += fmt.Sprintf(" AND %s.date > ?", table)
+			*args = append(*args, opts.Since)
+		}
+		if opts.After != 0 {
+			query += fmt.Sprintf(" AND (%[1]s.date < ? OR %[1]s.date = ? AND %[2]s < ?)", table, key)
+			*args = append(*args, afterDate, afterDate, opts.After)
+		}
+
+		return "SELECT * FROM (" + query + " ORDER BY date DESC, feed_key DESC" + limitClause(opts.Limit) + ") " + table + "_feed"
+	}
+
+	return "SELECT feed_key FROM (" + part("thread") + " UNION ALL " + part("post") + ") feed" +
+		" ORDER BY date DESC, feed_key DESC" + limitClause(opts.Limit)
+}
+
+// Feed items of keys, in their order. Rows gone since the keys were read
+// are left out.
+func feedItems(keys []int64, getThreads func(ids []int64) ([]rs.ThreadDetails, error), getPosts func(ids []int64) ([]rs.PostDetails, error)) ([]rs.FeedItem, error) {
+	threadIds := make([]int64, 0)
+	postIds := make([]int64, 0)
+	for _, key := range keys {
+		if table, id := feedRow(key); table == "thread" {
+			threadIds = append(threadIds, id)
+		} else {
+			postIds = append(postIds, id)
+		}
+	}
+
+	var threads []rs.ThreadDetails
+	var posts []rs.PostDetails
+	var err error
+
+	if len(threadIds) > 0 {
+		if threads, err = getThreads(threadIds); err != nil {
+			return nil, err
+		}
+	}
+	if len(postIds) > 0 {
+		if posts, err = getPosts(postIds); err != nil {
+			return nil, err
+		}
+	}
+
+	byKey := make(map[int64]rs.FeedItem, len(keys))
+	for i := range threads {
+		byKey[feedKey("thread", threads[i].Id)] = rs.FeedItem{Type: "thread", Thread: &threads[i]}
+	}
+	for i := range posts {
+		byKey[feedKey("post", posts[i].Id)] = rs.FeedItem{Type: "post", Post: &posts[i]}
+	}
+
+	items := make([]rs.FeedItem, 0, len(keys))
+	for _, key := range keys {
+		if item, ok := byKey[key]; ok {
+			item.Key = key
+			items = append(items, item)
+		}
+	}
+
+	return items, nil
+}
+
+func (u *User) feed() string {
+	// Validate query values
+	if len(u.inputRequest.query["user"]) != 1 {
+		return createInvalidResponse()
+	}
+	email := u.inputRequest.query["user"][0]
+
+	// Optional params, a feed is newest first
+	opts, ok := u.inputRequest.listOptions("desc", "since")
+	if !ok {
+		return createInvalidResponse()
+	}
+	opts.Order = "desc"
+	if opts.Limit < 0 {
+		opts.Limit = feedPageSize
+	} else if opts.Limit > feedMaxPage {
+		opts.Limit = feedMaxPage
+	}
+	page := newPager(&opts)
+
+	if _, err := u.store.GetUser(email); err != nil {
+		return createErrorResponse(u.inputRequest, err)
+	}
+
+	items, err := u.store.ListFeed(email, opts)
+	if err != nil {
+		return createErrorResponse(u.inputRequest, err)
+	}
+
+	items = items[:page.cut(len(items), func(i int) int64 { return items[i].Key })]
+
+	// related rows in batches, for threads and posts alike
+	threads := make([]*rs.ThreadDetails, 0)
+	posts := make([]*rs.PostDetails, 0)
+	for i := range items {
+		if items[i].Thread != nil {
+			threads = append(threads, items[i].Thread)
+		} else {
+			posts = append(posts, items[i].Post)
+		}
+	}
+	if err := relateThreads(u.store, threads, u.inputRequest.query["related"]); err != nil {
+		return createErrorResponse(u.inputRequest, err)
+	}
+	if err := relatePosts(u.store, posts, u.inputRequest.query["related"]); err != nil {
+		return createErrorResponse(u.inputRequest, err)
+	}
+
+	responseInterface := make([]interface{}, len(items))
+	for i, v := range items {
+		responseInterface[i] = v
+	}
+
+	return page.response(0, responseInterface)
+}
@@ -1,12 +1,8 @@
 package main
 
 import (
-	"database/sql"
-	"fmt"
 	"io"
-	"log"
 	"net/http"
-	"strconv"
 
 	rs "technopark-db/response"
 )
@@ -17,67 +13,58 @@ import (
 
 type Forum struct {
 	inputRequest *InputRequest
-	db           *sql.DB
+	store        Store
 }
 
 func (f *Forum) create() string {
 	var resp string
-	args := Args{}
-
-	query := "INSERT INTO forum (name, short_name, user) VALUES(?, ?, ?)"
 
 	if !validateJson(f.inputRequest, "name", "short_name", "user") {
 		return createInvalidJsonResponse(f.inputRequest)
 	}
 
-	args.generateFromJson(&f.inputRequest.json, "name", "short_name", "user")
-
-	dbResp, err := execQuery(query, &args.data, f.db)
-	if err != nil {
-		return createErrorResponse(err)
+	if !checkStringParams(f.inputRequest.json, "name", "short_name", "user") {
+		return createInvalidJsonResponse(f.inputRequest)
 	}
 
 	responseCode := 0
 	responseMsg := &rs.ForumCreate{
 		Name:       f.inputRequest.json["name"].(string),
 		Short_Name: f.inputRequest.json["short_name"].(string),
-		Id:         dbResp.lastId,
 		User:       f.inputRequest.json["user"].(string),
 	}
 
+	err := f.store.CreateForum(responseMsg)
+	if err != nil {
+		return createErrorResponse(f.inputRequest, err)
+	}
+
 	resp = createResponse(responseCode, responseMsg)
 
-	log.Printf("Forum '%s' created", responseMsg.Short_Name)
+	f.inputRequest.log.Info("forum created", "forum", responseMsg.Short_Name)
 
 	return resp
 }
 
-func (f *Forum) _getForumDetails(args Args) (int, *rs.ForumDetails) {
-	query := "SELECT * FROM forum WHERE short_name = ?"
-
-	getForum := selectQuery(query, &args.data, f.db)
+// Code 1 and empty details for a missing forum, storage errors are returned
+func (f *Forum) _getForumDetails(shortName string) (int, *rs.ForumDetails, error) {
+	responseMsg, err := f.store.GetForum(shortName)
 
-	if getForum.rows == 0 {
+	if err == ErrNotFound {
 		responseCode := 1
 		errorMessage := &rs.ForumDetails{}
 
-		return responseCode, errorMessage
+		return responseCode, errorMessage, nil
+	} else if err != nil {
+		return 0, nil, err
 	}
 
 	responseCode := 0
-	responseMsg := &rs.ForumDetails{
-		Id:         stringToInt64(getForum.values[0]["id"]),
-		Short_Name: getForum.values[0]["short_name"],
-		Name:       getForum.values[0]["name"],
-		User:       getForum.values[0]["user"],
-	}
-
-	return responseCode, responseMsg
+	return responseCode, responseMsg, nil
 }
 
 func (f *Forum) details() string {
 	var relatedUser bool
-	args := Args{}
 
 	if len(f.inputRequest.query["forum"]) != 1 {
 		return createInvalidResponse()
@@ -86,17 +73,19 @@ func (f *Forum) details() string {
 		relatedUser = true
 	}
 
-	args.append(f.inputRequest.query["forum"][0])
-
-	responseCode, responseMsg := f._getForumDetails(args)
+	responseCode, responseMsg, err := f._getForumDetails(f.inputRequest.query["forum"][0])
+	if err != nil {
+		return createErrorResponse(f.inputRequest, err)
+	}
 
-	if relatedUser {
-		u := User{inputRequest: f.inputRequest, db: f.db}
+	if relatedUser && responseCode == 0 {
+		u := User{inputRequest: f.inputRequest, store: f.store}
 		clearQuery(&u.inputRequest.query)
-		args := Args{}
-		args.append(responseMsg.User.(string))
 
-		_, userDetails := u._getUserDetails(args)
+		_, userDetails, err := u._getUserDetails(responseMsg.User.(string))
+		if err != nil {
+			return createErrorResponse(f.inputRequest, err)
+		}
 
 		responseMsg.User = userDetails
 	}
@@ -105,12 +94,12 @@ func (f *Forum) details() string {
 }
 
 func (f *Forum) listThreads() string {
-	relatedUser := false
-	relatedForum := false
+	t := Thread{inputRequest: f.inputRequest, store: f.store}
 
-	t := Thread{inputRequest: f.inputRequest, db: f.db}
-
-	responseCode, responseMsg := t.listBasic()
+	responseCode, responseMsg, page, err := t.listBasic()
+	if err != nil {
+		return createErrorResponse(f.inputRequest, err)
+	}
 
 	if responseCode == 1 {
 		return becauseAPI()
@@ -118,33 +107,13 @@ func (f *Forum) listThreads() string {
 		return createInvalidResponse()
 	}
 
-	// related params
-	if len(f.inputRequest.query["related"]) >= 1 && stringInSlice("user", f.inputRequest.query["related"]) {
-		relatedUser = true
+	// Response here, related rows in batches
+	threads := make([]*rs.ThreadDetails, len(responseMsg.Threads))
+	for i := range responseMsg.Threads {
+		threads[i] = &responseMsg.Threads[i]
 	}
-	if len(f.inputRequest.query["related"]) >= 1 && stringInSlice("forum", f.inputRequest.query["related"]) {
-		relatedForum = true
-	}
-
-	// Response here
-	for key, _ := range responseMsg.Threads {
-		if relatedUser {
-			u := User{inputRequest: f.inputRequest, db: f.db}
-			userArgs := Args{}
-			userArgs.append(responseMsg.Threads[key].User)
-
-			_, responseUser := u._getUserDetails(userArgs)
-			responseMsg.Threads[key].User = responseUser
-		}
-
-		if relatedForum {
-			f := Forum{inputRequest: f.inputRequest, db: f.db}
-			forumArgs := Args{}
-			forumArgs.append(responseMsg.Threads[key].Forum)
-
-			_, responseForum := f._getForumDetails(forumArgs)
-			responseMsg.Threads[key].Forum = responseForum
-		}
+	if err := relateThreads(f.store, threads, f.inputRequest.query["related"]); err != nil {
+		return createErrorResponse(f.inputRequest, err)
 	}
 
 	responseInterface := make([]interface{}, len(responseMsg.Threads))
@@ -152,85 +121,35 @@ func (f *Forum) listThreads() string {
 		responseInterface[i] = v
 	}
 
-	return createResponseFromArray(responseCode, responseInterface)
+	return page.response(responseCode, responseInterface)
 }
 
 func (f *Forum) listPosts() string {
-	var query, order string
-	relatedUser := false
-	relatedThread := false
-	relatedForum := false
-	args := Args{}
-
-	p := Post{inputRequest: f.inputRequest, db: f.db}
+	p := Post{inputRequest: f.inputRequest, store: f.store}
 
 	// Validate query values
-	if len(p.inputRequest.query["forum"]) == 1 {
-		query = "SELECT * FROM post p WHERE p.forum = ?"
-		args.append(p.inputRequest.query["forum"][0])
-	} else {
+	if len(p.inputRequest.query["forum"]) != 1 {
 		return createInvalidResponse()
 	}
 
-	// related params
-	// var join string
-	if len(f.inputRequest.query["related"]) >= 1 && stringInSlice("user", f.inputRequest.query["related"]) {
-		relatedUser = true
-	}
-	if len(f.inputRequest.query["related"]) >= 1 && stringInSlice("thread", f.inputRequest.query["related"]) {
-		relatedThread = true
-	}
-	if len(f.inputRequest.query["related"]) >= 1 && stringInSlice("forum", f.inputRequest.query["related"]) {
-		relatedForum = true
-	}
-
-	// order by here
-	if len(p.inputRequest.query["order"]) >= 1 {
-		orderType := p.inputRequest.query["order"][0]
-		if orderType != "desc" && orderType != "asc" {
-			return createInvalidResponse()
-		}
-
-		order = fmt.Sprintf(" ORDER BY date %s", orderType)
-	} else {
-		order = " ORDER BY date DESC"
+	responseCode, responseMsg, page, err := p._getList("forum", p.inputRequest.query["forum"][0])
+	if err != nil {
+		return createErrorResponse(f.inputRequest, err)
 	}
 
-	responseCode, responseMsg := p._getList(query, order, args)
-
 	if responseCode == 1 {
 		return becauseAPI()
 	} else if responseCode != 0 {
 		return createInvalidResponse()
 	}
 
-	for key, _ := range responseMsg.Posts {
-		if relatedUser {
-			u := User{inputRequest: f.inputRequest, db: f.db}
-			userArgs := Args{}
-			userArgs.append(responseMsg.Posts[key].User)
-
-			_, responseUser := u._getUserDetails(userArgs)
-			responseMsg.Posts[key].User = responseUser
-		}
-
-		if relatedThread {
-			t := Thread{inputRequest: f.inputRequest, db: f.db}
-			threadArgs := Args{}
-			threadArgs.append(responseMsg.Posts[key].Thread)
-
-			_, responseThread := t._getThreadDetails(threadArgs)
-			responseMsg.Posts[key].Thread = responseThread
-		}
-
-		if relatedForum {
-			f := Forum{inputRequest: f.inputRequest, db: f.db}
-			forumArgs := Args{}
-			forumArgs.append(responseMsg.Posts[key].Forum)
-
-			_, responseForum := f._getForumDetails(forumArgs)
-			responseMsg.Posts[key].Forum = responseForum
-		}
+	// related rows in batches
+	posts := make([]*rs.PostDetails, len(responseMsg.Posts))
+	for i := range responseMsg.Posts {
+		posts[i] = &responseMsg.Posts[i]
+	}
+	if err := relatePosts(f.store, posts, f.inputRequest.query["related"]); err != nil {
+		return createErrorResponse(f.inputRequest, err)
 	}
 
 	responseInterface := make([]interface{}, len(responseMsg.Posts))
@@ -238,51 +157,29 @@ func (f *Forum) listPosts() string {
 		responseInterface[i] = v
 	}
 
-	return createResponseFromArray(responseCode, responseInterface)
+	return page.response(responseCode, responseInterface)
 }
 
 func (f *Forum) listUsers() string {
-	var query string
-	args := Args{}
-
-	query = "SELECT u.email FROM user u WHERE email IN (SELECT DISTINCT p.user FROM post p WHERE p.forum = ?)"
-
 	// Validate query values
 	if len(f.inputRequest.query["forum"]) != 1 {
 		return createInvalidResponse()
 	}
 
-	args.append(f.inputRequest.query["forum"][0])
-
 	// Optional params
-	if len(f.inputRequest.query["since_id"]) >= 1 {
-		query += " AND u.id >= ?"
-		args.append(f.inputRequest.query["since_id"][0])
-	}
-
-	if len(f.inputRequest.query["order"]) >= 1 {
-		orderType := f.inputRequest.query["order"][0]
-		if orderType != "desc" && orderType != "asc" {
-			return createInvalidResponse()
-		}
-
-		query += fmt.Sprintf(" ORDER BY u.name %s", orderType)
-	} else {
-		query += " ORDER BY u.name desc"
-	}
-
-	if len(f.inputRequest.query["limit"]) >= 1 {
-		i, err := strconv.Atoi(f.inputRequest.query["limit"][0])
-		if err != nil || i < 0 {
-			return createInvalidResponse()
-		}
-		query += fmt.Sprintf(" LIMIT %d", i)
+	opts, ok := f.inputRequest.listOptions("desc", "since_id")
+	if !ok {
+		return createInvalidResponse()
 	}
+	page := newPager(&opts)
 
 	// Query
-	users := selectQuery(query, &args.data, f.db)
+	users, err := f.store.ListForumUsers(f.inputRequest.query["forum"][0], opts)
+	if err != nil {
+		return createErrorResponse(f.inputRequest, err)
+	}
 
-	if users.rows == 0 {
+	if len(users) == 0 {
 		return becauseAPI()
 	}
 
@@ -291,14 +188,13 @@ func (f *Forum) listUsers() string {
 	responseArray := make([]rs.UserDetails, 0)
 	responseMsg := &rs.UserListBasic{Users: responseArray}
 
-	for _, value := range users.values {
-		u := User{inputRequest: f.inputRequest, db: f.db}
-		userArgs := Args{}
-		userArgs.append(value["email"])
-
-		_, responseUser := u._getUserDetails(userArgs)
-
-		responseMsg.Users = append(responseMsg.Users, *responseUser)
+	details, err := loadUsers(f.store, users)
+	if err != nil {
+		return createErrorResponse(f.inputRequest, err)
+	}
+	users = users[:page.cut(len(users), func(i int) int64 { return details[users[i]].Id })]
+	for _, email := range users {
+		responseMsg.Users = append(responseMsg.Users, *details[email])
 	}
 
 	// Convert to interface
@@ -307,12 +203,12 @@ func (f *Forum) listUsers() string {
 		responseInterface[i] = v
 	}
 
-	return createResponseFromArray(responseCode, responseInterface)
+	return page.response(responseCode, responseInterface)
 }
 
-func forumHandler(w http.ResponseWriter, r *http.Request, inputRequest *InputRequest, db *sql.DB) {
+func forumHandler(w http.ResponseWriter, r *http.Request, inputRequest *InputRequest, store Store) {
 	//t0 := time.Now()
-	forum := Forum{inputRequest: inputRequest, db: db}
+	forum := Forum{inputRequest: inputRequest, store: store}
 	var result string
 
 	if inputRequest.method == "GET" {
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	rs "technopark-db/response"
+)
+
+// =================
+// Live gateway here
+// =================
+
+// The gateway sends forum activity over WebSocket to the clients that
+// subscribed to its channels: forum:<short_name>, thread:<id> and
+// user:<email>. Clients send
+//
+//	{"op": "subscribe", "channels": ["forum:f1", "thread:3"]}
+//	{"op": "unsubscribe", "channels": ["thread:3"]}
+//	{"op": "ping"}
+//
+// and get rs.LiveMessage back. An event that matches several channels of
+// a client comes once, with the channels it matched.
+
+const (
+	liveWriteWait  = 10 * time.Second // a client that takes longer for a write is gone
+	livePongWait   = 60 * time.Second // a client quiet for longer is gone
+	livePingPeriod = 25 * time.Second // pings keep the client from going quiet
+	liveMaxMessage = 4096             // bytes of a client message
+)
+
+var liveUpgrader = websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 1024}
+
+// liveClient is one WebSocket connection. Messages wait in send for the
+// writer; when it is full they are dropped and counted, and the client is
+// told how many before the next message it gets.
+type liveClient struct {
+	ws       *websocket.Conn
+	send     chan []byte
+	dropped  atomic.Int64
+	done     chan struct{} // closed once the connection is going away
+	doneOnce sync.Once
+
+	channels map[string]bool // guarded by the gateway's mu
+}
+
+func (c *liveClient) close() {
+	c.doneOnce.Do(func() { close(c.done) })
+}
+
+// Queue msg for the writer, never waits
+func (c *liveClient) queue(msg *rs.LiveMessage) {
+	encoded, err := json.Marshal(msg)
+	if err != nil {
+		slog.Error("can't encode live message", "type", msg.Type, "error", err)
+		return
+	}
+
+	select {
+	case c.send <- encoded:
+	default:
+		c.dropped.Add(1)
+		liveDropped.Inc()
+	}
+}
+
+// The only writer of ws: queued messages, pings and the close frame
+func (c *liveClient) write() {
+	ping := time.NewTicker(livePingPeriod)
+	defer func() {
+		ping.Stop()
+		c.ws.Close()
+	}()
+
+	write := func(data []byte) error {
+		c.ws.SetWriteDeadline(time.Now().Add(liveWriteWait))
+		return c.ws.WriteMessage(websocket.TextMessage, data)
+	}
+
+	for {
+		select {
+		case data := <-c.send:
+			if dropped := c.dropped.Swap(0); dropped > 0 {
+				notice, _ := json.Marshal(&rs.LiveMessage{Type: "dropped", Dropped: dropped})
+				if err := write(notice); err != nil {
+					return
+				}
+			}
+			if err := write(data); err != nil {
+				return
+			}
+
+		case <-ping.C:
+			if err := c.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(liveWriteWait)); err != nil {
+				return
+			}
+
+		case <-c.done:
+			c.ws.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, ""), time.Now().Add(liveWriteWait))
+			return
+		}
+	}
+}
+
+// liveGateway keeps the clients of every channel
+type liveGateway struct {
+	mu       sync.RWMutex
+	channels map[string]map[*liveClient]bool
+	clients  map[*liveClient]bool
+	closed   bool
+
+	maxChannels int // per client
+	sendBuffer  int // messages waiting per client
+}
+
+// Handlers publish here, /db/api/live/ connects
+var gateway = &liveGateway{
+	channels: make(map[string]map[*liveClient]bool),
+	clients:  make(map[*liveClient]bool),
+}
+
+func (g *liveGateway) configure(maxChannels, sendBuffer int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.maxChannels = maxChannels
+	g.sendBuffer = sendBuffer
+}
+
+func forumChannel(forum string) string { return "forum:" + forum }
+
+func threadChannel(thread int64) string { return "thread:" + int64ToString(thread) }
+
+func userChannel(email string) string { return "user:" + email }
+
+// Send event with data as its JSON to the clients of the channels
+func (g *liveGateway) publish(event string, data interface{}, channels ...string) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		slog.Error("can't encode live event", "event", event, "error", err)
+		return
+	}
+
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	matched := make(map[*liveClient][]string)
+	for _, channel := range channels {
+		for c := range g.channels[channel] {
+			matched[c] = append(matched[c], channel)
+		}
+	}
+
+	for c, list := range matched {
+		c.queue(&rs.LiveMessage{Type: "event", Channels: list, Event: event, Data: encoded})
+	}
+}
+
+func (g *liveGateway) add(c *liveClient) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.closed {
+		return false
+	}
+	g.clients[c] = true
+	return true
+}
+
+// Take c off the gateway and close it
+func (g *liveGateway) remove(c *liveClient) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for channel := range c.channels {
+		g.leave(c, channel)
+	}
+	delete(g.clients, c)
+	c.close()
+}
+
+// Called with mu held
+func (g *liveGateway) leave(c *liveClient, channel string) {
+	delete(c.channels, channel)
+	delete(g.channels[channel], c)
+	if len(g.channels[channel]) == 0 {
+		delete(g.channels, channel)
+	}
+}
+
+// Subscribe c to channels, all or none of them: false when they would take
+// c over maxChannels
+func (g *liveGateway) subscribe(c *liveClient, channels []string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	added := 0
+	for _, channel := range channels {
+		if !c.channels[channel] {
+			added++
+		}
+	}
+	if len(c.channels)+added > g.maxChannels {
+		return false
+	}
+
+	for _, channel := range channels {
+		c.channels[channel] = true
+		if g.channels[channel] == nil {
+			g.channels[channel] = make(map[*liveClient]bool)
+		}
+		g.channels[channel][c] = true
+	}
+	return true
+}
+
+func (g *liveGateway) unsubscribe(c *liveClient, channels []string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, channel := range channels {
+		g.leave(c, channel)
+	}
+}
+
+// Close every client and take no more, for the shutdown: hijacked
+// connections are not the server's to close
+func (g *liveGateway) close() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.closed = true
+	for c := range g.clients {
+		c.close()
+	}
+}
+
+func (g *liveGateway) count() int {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return len(g.clients)
+}
+
+// API code and message of a channel name, 0 for one that exists
+func checkChannel(store Store, channel string) (int, string) {
+	kind, key, ok := strings.Cut(channel, ":")
+	if !ok || key == "" {
+		return 2, "Invalid channel " + channel
+	}
+
+	var err error
+	switch kind {
+	case "forum":
+		_, err = store.GetForum(key)
+	case "thread":
+		id, ok := parseId(key)
+		if !ok {
+			return 2, "Invalid channel " + channel
+		}
+		_, err = store.GetThread(id)
+	case "user":
+		_, err = store.GetUser(key)
+	default:
+		return 2, "Invalid channel " + channel
+	}
+
+	if err == ErrNotFound {
+		return 1, "Not exist " + channel
+	} else if err != nil {
+		slog.Error("can't check channel", "channel", channel, "error", err)
+		return 4, "Unknown error"
+	}
+	return 0, ""
+}
+
+// A message of a client
+type liveRequest struct {
+	Op       string   `json:"op"`
+	Channels []string `json:"channels"`
+}
+
+// Answer one client message
+func (g *liveGateway) handle(c *liveClient, store Store, request *liveRequest) {
+	switch request.Op {
+	case "subscribe":
+		for _, channel := range request.Channels {
+			if code, msg := checkChannel(store, channel); code != 0 {
+				c.queue(&rs.LiveMessage{Type: "error", Code: code, Msg: msg})
+				return
+			}
+		}
+		if !g.subscribe(c, request.Channels) {
+			c.queue(&rs.LiveMessage{Type: "error", Code: 2, Msg: "Too many channels"})
+			return
+		}
+		c.queue(&rs.LiveMessage{Type: "subscribed", Channels: request.Channels})
+
+	case "unsubscribe":
+		g.unsubscribe(c, request.Channels)
+		c.queue(&rs.LiveMessage{Type: "unsubscribed", Channels: request.Channels})
+
+	case "ping":
+		c.queue(&rs.LiveMessage{Type: "pong"})
+
+	default:
+		c.queue(&rs.LiveMessage{Type: "error", Code: 3, Msg: "Invalid query"})
+	}
+}
+
+// Upgrade to WebSocket and serve the client until it leaves. Channels in
+// the query string (?channel=forum:f1&channel=thread:3) are subscribed
+// to first.
+func liveHandler(w http.ResponseWriter, r *http.Request, inputRequest *InputRequest, store Store) {
+	ws, err := liveUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		inputRequest.log.Info("live: no upgrade", "error", err) // the upgrader answered
+		return
+	}
+
+	c := &liveClient{
+		ws:       ws,
+		send:     make(chan []byte, gateway.sendBuffer),
+		done:     make(chan struct{}),
+		channels: make(map[string]bool),
+	}
+	if !gateway.add(c) {
+		ws.Close()
+		return
+	}
+	defer gateway.remove(c)
+
+	go c.write()
+
+	if channels := inputRequest.query["channel"]; len(channels) > 0 {
+		gateway.handle(c, store, &liveRequest{Op: "subscribe", Channels: channels})
+	}
+
+	ws.SetReadLimit(liveMaxMessage)
+	ws.SetReadDeadline(time.Now().Add(livePongWait))
+	ws.SetPongHandler(func(string) error {
+		return ws.SetReadDeadline(time.Now().Add(livePongWait))
+	})
+
+	for {
+		_, data, err := ws.ReadMessage()
+		if err != nil {
+			inputRequest.log.Debug("live: client gone", "error", err)
+			return
+		}
+		ws.SetReadDeadline(time.Now().Add(livePongWait))
+
+		var request liveRequest
+		if err := json.Unmarshal(data, &request); err != nil {
+			c.queue(&rs.LiveMessage{Type: "error", Code: 3, Msg: "Invalid json"})
+			continue
+		}
+		gateway.handle(c, store, &request)
+	}
+}
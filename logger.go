@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// =================
+// Logging here
+// =================
+
+// Set up the default slog logger from the config: JSON or logfmt lines at
+// the configured level, to stderr or a rotated file. The log package writes
+// through it as well. The returned file is flushed on shutdown, nil for stderr.
+func initLog(config *Config) (io.Closer, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(config.LogLevel)); err != nil {
+		return nil, err
+	}
+
+	var w io.Writer = os.Stderr
+	var file *rotatingFile
+
+	if config.LogFile != "" {
+		f, err := openRotatingFile(config.LogFile, int64(config.LogMaxSize)<<20, config.LogBackups)
+		if err != nil {
+			return nil, err
+		}
+		w, file = f, f
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	if config.LogFormat == "json" {
+		handler = slog.NewJSONHandler(w, opts)
+	} else {
+		handler = slog.NewTextHandler(w, opts)
+	}
+
+	slog.SetDefault(slog.New(handler))
+
+	if file == nil {
+		return nil, nil
+	}
+	return file, nil
+}
+
+// Log err at error level and exit, log.Fatal for the slog logger
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// Request id from the X-Request-Id header, a new random one without it
+func requestId(r *http.Request) string {
+	if id := r.Header.Get("X-Request-Id"); id != "" {
+		return id
+	}
+
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// responseRecorder keeps what the access log needs from a response
+type responseRecorder struct {
+	http.ResponseWriter
+	head  []byte // first bytes of the body, they hold the API code
+	bytes int
+}
+
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	if free := 16 - len(r.head); free > 0 {
+		if free > len(p) {
+			free = len(p)
+		}
+		r.head = append(r.head, p[:free]...)
+	}
+
+	n, err := r.ResponseWriter.Write(p)
+	r.bytes += n
+	return n, err
+}
+
+// For http.ResponseController, streams flush and lift the write deadline
+func (r *responseRecorder) Unwrap() http.ResponseWriter { return r.ResponseWriter }
+
+// For the live gateway, which takes the connection over
+func (r *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(r.ResponseWriter).Hijack()
+}
+
+// API code of the response, -1 when the body has none. json.Marshal sorts
+// the keys of createResponse, so "code" always comes first.
+func (r *responseRecorder) code() int {
+	head := bytes.TrimPrefix(r.head, []byte(`{"code":`))
+	if len(head) == len(r.head) {
+		return -1
+	}
+
+	end := bytes.IndexAny(head, ",}")
+	if end < 0 {
+		return -1
+	}
+
+	code, err := strconv.Atoi(string(head[:end]))
+	if err != nil {
+		return -1
+	}
+	return code
+}
+
+// Log one line per request once the response is written
+func logRequest(logger *slog.Logger, r *http.Request, rec *responseRecorder, start time.Time) {
+	code := rec.code()
+
+	level := slog.LevelInfo
+	if code == 4 {
+		level = slog.LevelError
+	}
+
+	logger.Log(r.Context(), level, "request",
+		"method", r.Method,
+		"code", code,
+		"bytes", rec.bytes,
+		"latency_ms", float64(time.Since(start).Microseconds())/1000)
+}
+
+// ======================
+// Log file here
+// ======================
+
+// rotatingFile is an append-only log file that is moved to name.1 once it
+// grows past maxSize, older copies to name.2 ... name.<backups>.
+type rotatingFile struct {
+	mu      sync.Mutex
+	name    string
+	maxSize int64 // 0 never rotates
+	backups int
+
+	file *os.File
+	size int64
+}
+
+func openRotatingFile(name string, maxSize int64, backups int) (*rotatingFile, error) {
+	f := &rotatingFile{name: name, maxSize: maxSize, backups: backups}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+
+	// the oldest copy is overwritten, with no backups the log starts over
+	if f.backups == 0 {
+		if err := os.Remove(f.name); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	for i := f.backups; i > 0; i-- {
+		from := f.name
+		if i > 1 {
+			from = fmt.Sprintf("%s.%d", f.name, i-1)
+		}
+
+		if err := os.Rename(from, fmt.Sprintf("%s.%d", f.name, i)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return f.open()
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.file.Sync(); err != nil {
+		f.file.Close()
+		return err
+	}
+	return f.file.Close()
+}
@@ -1,49 +1,79 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"flag"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
-)
-
-func initLog() {
-	fmt.Println("Hey, initLog() here")
-	f, err := os.OpenFile("main2.log", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
-	if err != nil {
-		panic(err)
-	}
-	defer f.Close()
-
-	log.SetOutput(f)
+	"os/signal"
+	"runtime/debug"
+	"syscall"
+	"time"
 
-	for {
-	}
-}
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
 
 // =================
 // Main here
 // =================
 
-func makeHandler(db *sql.DB, fn func(http.ResponseWriter, *http.Request, *InputRequest, *sql.DB)) http.HandlerFunc {
+// Handlers return storage errors as responses. The recover here is a last
+// guard against bugs, a panic is logged and answered as an unknown error.
+// Every request is logged and counted with its endpoint, API code and latency.
+func makeHandler(store Store, fn func(http.ResponseWriter, *http.Request, *InputRequest, Store)) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		inputRequest := new(InputRequest)
-		inputRequest.parse(r)
+		start := time.Now()
+
+		id := requestId(r)
+		w.Header().Set("X-Request-Id", id)
 
-		fn(w, r, inputRequest, db)
+		inputRequest := &InputRequest{log: slog.With("request_id", id, "endpoint", r.URL.Path)}
+		rec := &responseRecorder{ResponseWriter: w}
+		defer func() {
+			logRequest(inputRequest.log, r, rec, start)
+			observeRequest(r, rec, start)
+		}()
+
+		defer func() {
+			failure := recover()
+			if failure == nil {
+				return
+			} else if failure == http.ErrAbortHandler {
+				panic(failure)
+			}
+
+			err, ok := failure.(error)
+			if !ok {
+				err = fmt.Errorf("%v", failure)
+			}
+			inputRequest.log.Error("panic", "error", err, "stack", string(debug.Stack()))
+
+			io.WriteString(rec, createErrorResponse(inputRequest, err))
+		}()
+
+		if err := inputRequest.parse(r); err != nil {
+			inputRequest.log.Warn("can't read request", "error", err)
+			io.WriteString(rec, createInvalidResponse())
+			return
+		}
+
+		fn(rec, r, inputRequest, store)
 	}
 }
 
-func main() {
-	db, err := sql.Open("mysql", "sasha1003:10031995@/mydb")
+func openDB(driver, dsn string) *sql.DB {
+	db, err := sql.Open(driver, dsn)
 
 	if err != nil {
 		panic(err.Error())
 	} else {
-		fmt.Println("db ok")
+		slog.Info("db ok", "driver", driver)
 	}
-	defer db.Close()
 
 	// Open doesn't open a connection. Validate DSN data:
 	err = db.Ping()
@@ -51,20 +81,172 @@ func main() {
 		panic(err.Error())
 	}
 
-	// args here
-	argsWithProg := os.Args[1:]
-	MAX_DB_CONNECTIONS := int(stringToInt64(argsWithProg[1]))
-	db.SetMaxOpenConns(MAX_DB_CONNECTIONS)
-	PORT := ":" + argsWithProg[0]
+	return db
+}
+
+// Open the configured storage backend with its connection pool.
+// db is nil for the memory backend.
+func openStore(c *Config) (store Store, db *sql.DB) {
+	switch c.Storage {
+	case "memory":
+		slog.Info("memory storage ok")
+		return NewMemoryStore(), nil
 
-	fmt.Printf("The server is running on http://localhost%s\n", PORT)
+	case "mysql":
+		db = openDB("mysql", c.DSN)
+		store = NewMysqlStore(db)
 
-	http.HandleFunc("/db/api/user/", makeHandler(db, userHandler))
-	http.HandleFunc("/db/api/forum/", makeHandler(db, forumHandler))
-	http.HandleFunc("/db/api/thread/", makeHandler(db, threadHandler))
-	http.HandleFunc("/db/api/post/", makeHandler(db, postHandler))
-	http.HandleFunc("/db/api/status/", makeHandler(db, statusHandler))
-	http.HandleFunc("/db/api/clear/", makeHandler(db, clearHandler))
+	case "postgres":
+		db = openDB("postgres", c.DSN)
+		store = NewPostgresStore(db)
+
+	case "sqlite":
+		db = openDB("sqlite3", "file:"+c.DSN+"?_foreign_keys=on&_busy_timeout=5000&_journal_mode=WAL&_txlock=immediate")
+		store = NewSqliteStore(db)
+
+	default:
+		panic(fmt.Sprintf("unknown storage %q", c.Storage))
+	}
+
+	db.SetMaxOpenConns(c.MaxOpenConns)
+	db.SetMaxIdleConns(c.MaxIdleConns)
+	db.SetConnMaxLifetime(c.ConnMaxLifetime)
+
+	return store, db
+}
+
+// Serve until SIGINT or SIGTERM, then stop accepting connections and wait
+// up to timeout for the requests in flight. A second signal kills at once.
+func serve(server *http.Server, timeout time.Duration) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	failed := make(chan error, 1)
+	go func() {
+		failed <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-failed:
+		return err
+	case <-ctx.Done():
+	}
+	stop()
+
+	slog.Info("shutdown: draining requests", "timeout", timeout.String())
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		server.Close()
+		return fmt.Errorf("shutdown: %v", err)
+	}
+
+	slog.Info("shutdown: all requests done")
+	return nil
+}
 
-	http.ListenAndServe(PORT, nil)
+func main() {
+	config, args, err := loadConfig(os.Args[1:])
+	if err == flag.ErrHelp {
+		return
+	} else if err != nil {
+		log.Fatal("config: ", err)
+	}
+
+	logFile, err := initLog(config)
+	if err != nil {
+		log.Fatal("log: ", err)
+	}
+
+	// migrate up|down|status
+	if len(args) > 0 && args[0] == "migrate" {
+		if err := migrateCommand(config, args[1:]); err != nil {
+			fatal("migrate", err)
+		}
+		return
+	}
+
+	// stress [replies] [workers]
+	if len(args) > 0 && args[0] == "stress" {
+		if err := stressCommand(config, args[1:]); err != nil {
+			fatal("stress", err)
+		}
+		return
+	}
+
+	if len(args) != 0 {
+		fatal("usage", fmt.Errorf("unknown command %q, see -help", args[0]))
+	}
+
+	store, db := openStore(config)
+	if db != nil {
+		checkSchema(config.Storage, db)
+		registerDBMetrics(db, config.Storage)
+
+		// the memory store is a cache of its own
+		if config.CacheSize > 0 {
+			store = NewCachedStore(store, config.CacheSize, config.CacheTTL)
+		}
+	}
+
+	var explain func(query string, args []interface{}) ([]string, error)
+	if db != nil && config.SlowQueryExplain {
+		explain = explainer(config.Storage, db)
+	}
+	slowQueries.configure(config.SlowQueryThreshold, config.SlowLogSize, config.SlowLogArgs, explain)
+
+	notifications.start(store, config.NotifyQueue, config.NotifyWorkers)
+	threadEvents.configure(config.StreamHistory)
+	gateway.configure(config.LiveMaxChannels, config.LiveSendBuffer)
+	anonymousVotes = config.AnonymousVotes
+
+	slog.Info("the server is running", "listen", config.Listen)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/db/api/user/", makeHandler(store, userHandler))
+	mux.HandleFunc("/db/api/forum/", makeHandler(store, forumHandler))
+	mux.HandleFunc("/db/api/thread/", makeHandler(store, threadHandler))
+	mux.HandleFunc("/db/api/post/", makeHandler(store, postHandler))
+	mux.HandleFunc("/db/api/status/", makeHandler(store, statusHandler))
+	mux.HandleFunc("/db/api/clear/", makeHandler(store, clearHandler))
+	mux.HandleFunc("/db/api/admin/", makeHandler(store, adminHandler))
+	mux.HandleFunc("/db/api/live/", makeHandler(store, liveHandler))
+	mux.Handle("/metrics", promhttp.Handler())
+
+	server := &http.Server{
+		Addr:         config.Listen,
+		Handler:      mux,
+		ReadTimeout:  config.ReadTimeout,
+		WriteTimeout: config.WriteTimeout,
+		IdleTimeout:  config.IdleTimeout,
+	}
+	// streams are never idle, Shutdown would wait them out, and it
+	// doesn't know the hijacked live connections at all
+	server.RegisterOnShutdown(threadEvents.close)
+	server.RegisterOnShutdown(gateway.close)
+
+	err = serve(server, config.ShutdownTimeout)
+	if err != nil {
+		slog.Error("serve", "error", err)
+	}
+
+	// requests are done (or cut off), the posts they queued are next
+	notifications.stop()
+
+	// nothing uses the pool any more
+	if db != nil {
+		if err := db.Close(); err != nil {
+			slog.Error("close db", "error", err)
+		}
+	}
+
+	if logFile != nil {
+		logFile.Close()
+	}
+
+	if err != nil {
+		os.Exit(1)
+	}
 }
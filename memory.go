@@ -0,0 +1,1601 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	rs "technopark-db/response"
+)
+
+// =================
+// In-memory storage here
+// =================
+
+type memoryPost struct {
+	details rs.PostDetails
+	path    string // base92 materialized path, as in post.parent
+}
+
+// MemoryStore keeps the whole forum in process memory. It mirrors the MySQL
+// schema: users by email, forums by short_name, posts with base92 paths.
+type MemoryStore struct {
+	*memoryData
+
+	mu   *sync.RWMutex
+	txMu *sync.Mutex // one unit of work, or one write outside of them, at a time
+
+	// Undo steps of the running unit of work, nil outside Tx
+	journal *[]func()
+}
+
+// Rows of a MemoryStore, shared with the stores handed to units of work
+type memoryData struct {
+	users   map[string]*rs.UserDetails
+	forums  map[string]*rs.ForumDetails
+	threads map[int64]*rs.ThreadDetails
+	posts   map[int64]*memoryPost
+
+	children map[string]int // path -> last child number
+
+	follows       map[string]map[string]bool // follower -> followees
+	subscriptions map[string]map[int64]bool  // user -> threads
+
+	votes         map[string]map[int64]map[string]*rs.VoteDetails // target -> id -> user
+	revisions     map[string]map[int64][]rs.Revision              // target -> id
+	notifications map[string][]*rs.Notification                   // user -> in id order
+	notifyPending map[int64]bool                                  // posts to notify of
+
+	threadIndex, postIndex textIndex // title and message of threads, message of posts
+
+	lastRevisionId map[string]int64 // numbered by target, as in their tables
+
+	lastUserId, lastForumId, lastThreadId, lastPostId, lastVoteId, lastNotificationId int64
+}
+
+func NewMemoryStore() *MemoryStore {
+	s := &MemoryStore{memoryData: &memoryData{}, mu: new(sync.RWMutex), txMu: new(sync.Mutex)}
+	s.reset()
+	return s
+}
+
+// Take mu for a write. Outside a unit of work the write waits for the
+// running unit too, so that a rollback of the unit can't take it back.
+func (s *MemoryStore) lock() func() {
+	if s.journal == nil {
+		s.txMu.Lock()
+	}
+	s.mu.Lock()
+
+	return func() {
+		s.mu.Unlock()
+		if s.journal == nil {
+			s.txMu.Unlock()
+		}
+	}
+}
+
+// Record how to take back a write, called with mu held
+func (s *MemoryStore) onRollback(undo func()) {
+	if s.journal != nil {
+		*s.journal = append(*s.journal, undo)
+	}
+}
+
+func (s *MemoryStore) reset() {
+	s.users = make(map[string]*rs.UserDetails)
+	s.forums = make(map[string]*rs.ForumDetails)
+	s.threads = make(map[int64]*rs.ThreadDetails)
+	s.posts = make(map[int64]*memoryPost)
+	s.children = make(map[string]int)
+	s.follows = make(map[string]map[string]bool)
+	s.subscriptions = make(map[string]map[int64]bool)
+	s.votes = map[string]map[int64]map[string]*rs.VoteDetails{
+		"thread": make(map[int64]map[string]*rs.VoteDetails),
+		"post":   make(map[int64]map[string]*rs.VoteDetails),
+	}
+	s.revisions = map[string]map[int64][]rs.Revision{
+		"thread": make(map[int64][]rs.Revision),
+		"post":   make(map[int64][]rs.Revision),
+	}
+	s.notifications = make(map[string][]*rs.Notification)
+	s.notifyPending = make(map[int64]bool)
+	s.lastRevisionId = make(map[string]int64)
+	s.threadIndex = newInvertedIndex()
+	s.postIndex = newInvertedIndex()
+}
+
+func duplicateError(key string) error { return fmt.Errorf("%w: '%s'", ErrDuplicate, key) }
+
+func foreignKeyError(key string) error { return fmt.Errorf("%w: '%s'", ErrForeignKey, key) }
+
+// Sort by (key, id) in the given order; an empty order keeps id order
+func sortRows(n int, order string, key func(i int) string, id func(i int) int64, swap func(i, j int)) {
+	sort.Sort(&rowSorter{n: n, desc: order == "desc", byKey: order != "", key: key, id: id, swap: swap})
+}
+
+type rowSorter struct {
+	n     int
+	desc  bool
+	byKey bool
+	key   func(i int) string
+	id    func(i int) int64
+	swap  func(i, j int)
+}
+
+func (r *rowSorter) Len() int           { return r.n }
+func (r *rowSorter) Swap(i, j int)      { r.swap(i, j) }
+func (r *rowSorter) Less(i, j int) bool { return r.before(r.key(i), r.id(i), r.key(j), r.id(j)) }
+
+func (r *rowSorter) before(ki string, idi int64, kj string, idj int64) bool {
+	if r.byKey && ki != kj {
+		return (ki < kj) != r.desc
+	}
+	if r.desc && r.byKey {
+		return idi > idj
+	}
+	return idi < idj
+}
+
+// Index of the first sorted row after the opts.After row, whose key is
+// afterKey. Rows after a missing row are none, as in SQL, unless they are
+// in id order.
+func rowsAfter(n int, opts ListOptions, key func(i int) string, id func(i int) int64, afterKey string, found bool) int {
+	if opts.After == 0 {
+		return 0
+	}
+	if !found && opts.Order != "" {
+		return n
+	}
+
+	r := &rowSorter{desc: opts.Order == "desc", byKey: opts.Order != ""}
+	return sort.Search(n, func(i int) bool { return r.before(afterKey, opts.After, key(i), id(i)) })
+}
+
+func limitRows(n int, limit int) int {
+	if limit >= 0 && limit < n {
+		return limit
+	}
+	return n
+}
+
+// ======================
+// Users here
+// ======================
+
+func (s *MemoryStore) CreateUser(user *rs.UserDetails) error {
+	defer s.lock()()
+
+	if _, ok := s.users[user.Email]; ok {
+		return duplicateError(user.Email)
+	}
+
+	s.lastUserId++
+	user.Id = s.lastUserId
+
+	newUser := *user
+	s.users[user.Email] = &newUser
+
+	email := user.Email
+	s.onRollback(func() {
+		delete(s.users, email)
+		s.lastUserId--
+	})
+
+	return nil
+}
+
+func (s *MemoryStore) GetUser(email string) (*rs.UserDetails, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[email]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	result := *user
+	return &result, nil
+}
+
+func (s *MemoryStore) GetUsers(emails []string) ([]rs.UserDetails, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := make([]rs.UserDetails, 0, len(emails))
+	for _, email := range emails {
+		if user, ok := s.users[email]; ok {
+			users = append(users, *user)
+		}
+	}
+
+	return users, nil
+}
+
+func (s *MemoryStore) UpdateUser(email, about, name string) error {
+	defer s.lock()()
+
+	if user, ok := s.users[email]; ok {
+		oldAbout, oldName := user.About, user.Name
+		s.onRollback(func() { user.About, user.Name = oldAbout, oldName })
+
+		user.About = &about
+		user.Name = &name
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) listUsers(emails []string, opts ListOptions, key func(user *rs.UserDetails) string) []rs.UserDetails {
+	users := make([]rs.UserDetails, 0, len(emails))
+	for _, email := range emails {
+		user, ok := s.users[email]
+		if !ok || user.Id < opts.SinceId {
+			continue
+		}
+		users = append(users, *user)
+	}
+
+	sortRows(len(users), opts.Order,
+		func(i int) string { return key(&users[i]) },
+		func(i int) int64 { return users[i].Id },
+		func(i, j int) { users[i], users[j] = users[j], users[i] })
+
+	var afterKey string
+	after := s.userById(opts.After)
+	if after != nil {
+		afterKey = key(after)
+	}
+	users = users[rowsAfter(len(users), opts,
+		func(i int) string { return key(&users[i]) },
+		func(i int) int64 { return users[i].Id },
+		afterKey, after != nil):]
+
+	return users[:limitRows(len(users), opts.Limit)]
+}
+
+// Users are kept by email, nil when there is no user with id
+func (s *MemoryStore) userById(id int64) *rs.UserDetails {
+	for _, user := range s.users {
+		if user.Id == id {
+			return user
+		}
+	}
+	return nil
+}
+
+// Users have no explicit date, creation order is id order
+func userDateKey(user *rs.UserDetails) string { return fmt.Sprintf("%020d", user.Id) }
+
+func (s *MemoryStore) ListFollowers(email string, opts ListOptions) ([]rs.UserDetails, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.listUsers(s.followers(email), opts, userDateKey), nil
+}
+
+func (s *MemoryStore) ListFollowing(email string, opts ListOptions) ([]rs.UserDetails, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.listUsers(s.following(email), opts, userDateKey), nil
+}
+
+// ======================
+// Follows here
+// ======================
+
+func (s *MemoryStore) Follow(follower, followee string) error {
+	defer s.lock()()
+
+	if _, ok := s.users[follower]; !ok {
+		return foreignKeyError(follower)
+	}
+	if _, ok := s.users[followee]; !ok {
+		return foreignKeyError(followee)
+	}
+	if s.follows[follower][followee] {
+		return duplicateError(follower + "-" + followee)
+	}
+
+	if s.follows[follower] == nil {
+		s.follows[follower] = make(map[string]bool)
+	}
+	s.follows[follower][followee] = true
+	s.onRollback(func() { delete(s.follows[follower], followee) })
+
+	return nil
+}
+
+func (s *MemoryStore) Unfollow(follower, followee string) error {
+	defer s.lock()()
+
+	if !s.follows[follower][followee] {
+		return nil
+	}
+
+	delete(s.follows[follower], followee)
+	s.onRollback(func() { s.follows[follower][followee] = true })
+
+	return nil
+}
+
+func (s *MemoryStore) followers(followee string) []string {
+	listFollowers := make([]string, 0)
+	for follower, followees := range s.follows {
+		if followees[followee] {
+			listFollowers = append(listFollowers, follower)
+		}
+	}
+	sort.Strings(listFollowers)
+
+	return listFollowers
+}
+
+func (s *MemoryStore) following(follower string) []string {
+	listFollowing := make([]string, 0, len(s.follows[follower]))
+	for followee := range s.follows[follower] {
+		listFollowing = append(listFollowing, followee)
+	}
+	sort.Strings(listFollowing)
+
+	return listFollowing
+}
+
+func (s *MemoryStore) GetFollowers(email string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.followers(email), nil
+}
+
+func (s *MemoryStore) GetFollowing(email string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.following(email), nil
+}
+
+func (s *MemoryStore) GetFollowersOf(emails []string) (map[string][]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	groups := make(map[string][]string)
+	for _, email := range emails {
+		if list := s.followers(email); len(list) != 0 {
+			groups[email] = list
+		}
+	}
+
+	return groups, nil
+}
+
+func (s *MemoryStore) GetFollowingOf(emails []string) (map[string][]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	groups := make(map[string][]string)
+	for _, email := range emails {
+		if list := s.following(email); len(list) != 0 {
+			groups[email] = list
+		}
+	}
+
+	return groups, nil
+}
+
+// ======================
+// Forums here
+// ======================
+
+func (s *MemoryStore) CreateForum(forum *rs.ForumCreate) error {
+	defer s.lock()()
+
+	if _, ok := s.users[forum.User]; !ok {
+		return foreignKeyError(forum.User)
+	}
+	if _, ok := s.forums[forum.Short_Name]; ok {
+		return duplicateError(forum.Short_Name)
+	}
+	for _, value := range s.forums {
+		if value.Name == forum.Name {
+			return duplicateError(forum.Name)
+		}
+	}
+
+	s.lastForumId++
+	forum.Id = s.lastForumId
+
+	s.forums[forum.Short_Name] = &rs.ForumDetails{
+		Id:         forum.Id,
+		Name:       forum.Name,
+		Short_Name: forum.Short_Name,
+		User:       forum.User,
+	}
+
+	shortName := forum.Short_Name
+	s.onRollback(func() {
+		delete(s.forums, shortName)
+		s.lastForumId--
+	})
+
+	return nil
+}
+
+func (s *MemoryStore) GetForum(shortName string) (*rs.ForumDetails, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	forum, ok := s.forums[shortName]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	result := *forum
+	return &result, nil
+}
+
+func (s *MemoryStore) GetForums(shortNames []string) ([]rs.ForumDetails, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	forums := make([]rs.ForumDetails, 0, len(shortNames))
+	for _, shortName := range shortNames {
+		if forum, ok := s.forums[shortName]; ok {
+			forums = append(forums, *forum)
+		}
+	}
+
+	return forums, nil
+}
+
+func (s *MemoryStore) ListForumUsers(forum string, opts ListOptions) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	authors := make(map[string]bool)
+	for _, post := range s.posts {
+		if post.details.Forum == forum {
+			authors[post.details.User.(string)] = true
+		}
+	}
+
+	emails := make([]string, 0, len(authors))
+	for email := range authors {
+		emails = append(emails, email)
+	}
+
+	// NULL names sort as '', first on asc as in MySQL
+	users := s.listUsers(emails, opts, func(user *rs.UserDetails) string {
+		if user.Name == nil {
+			return ""
+		}
+		return *user.Name
+	})
+
+	result := make([]string, 0, len(users))
+	for _, user := range users {
+		result = append(result, user.Email)
+	}
+
+	return result, nil
+}
+
+// ======================
+// Threads here
+// ======================
+
+func (s *MemoryStore) CreateThread(thread *rs.ThreadCreate) error {
+	defer s.lock()()
+
+	if _, ok := s.forums[thread.Forum]; !ok {
+		return foreignKeyError(thread.Forum)
+	}
+	if _, ok := s.users[thread.User]; !ok {
+		return foreignKeyError(thread.User)
+	}
+
+	s.lastThreadId++
+	thread.Id = s.lastThreadId
+
+	s.threads[thread.Id] = &rs.ThreadDetails{
+		Date:      thread.Date,
+		Forum:     thread.Forum,
+		Id:        thread.Id,
+		IsClosed:  thread.IsClosed,
+		IsDeleted: thread.IsDeleted,
+		Message:   thread.Message,
+		Slug:      thread.Slug,
+		Title:     thread.Title,
+		User:      thread.User,
+	}
+	s.threadIndex.add(thread.Id, thread.Title+" "+thread.Message)
+
+	id, text := thread.Id, thread.Title+" "+thread.Message
+	s.onRollback(func() {
+		s.threadIndex.remove(id, text)
+		delete(s.threads, id)
+		s.lastThreadId--
+	})
+
+	return nil
+}
+
+func (s *MemoryStore) GetThread(id int64) (*rs.ThreadDetails, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	thread, ok := s.threads[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	result := *thread
+	return &result, nil
+}
+
+func (s *MemoryStore) GetThreads(ids []int64) ([]rs.ThreadDetails, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	threads := make([]rs.ThreadDetails, 0, len(ids))
+	for _, id := range ids {
+		if thread, ok := s.threads[id]; ok {
+			threads = append(threads, *thread)
+		}
+	}
+
+	return threads, nil
+}
+
+func (s *MemoryStore) ListThreads(field, value string, opts ListOptions) ([]rs.ThreadDetails, error) {
+	if field != "user" && field != "forum" {
+		return nil, fmt.Errorf("can't list threads by %q", field)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	threads := make([]rs.ThreadDetails, 0)
+	for _, thread := range s.threads {
+		if field == "user" && thread.User != value || field == "forum" && thread.Forum != value {
+			continue
+		}
+		if thread.Id < opts.SinceId || opts.Since != "" && thread.Date <= opts.Since {
+			continue
+		}
+		threads = append(threads, *thread)
+	}
+
+	sortRows(len(threads), opts.Order,
+		func(i int) string { return threads[i].Date },
+		func(i int) int64 { return threads[i].Id },
+		func(i, j int) { threads[i], threads[j] = threads[j], threads[i] })
+
+	var afterKey string
+	after, found := s.threads[opts.After]
+	if found {
+		afterKey = after.Date
+	}
+	threads = threads[rowsAfter(len(threads), opts,
+		func(i int) string { return threads[i].Date },
+		func(i int) int64 { return threads[i].Id },
+		afterKey, found):]
+
+	return threads[:limitRows(len(threads), opts.Limit)], nil
+}
+
+func (s *MemoryStore) UpdateThread(id int64, message, slug string, editor *string) error {
+	defer s.lock()()
+
+	thread, ok := s.threads[id]
+	if !ok || thread.Message == message && thread.Slug == slug {
+		return nil
+	}
+
+	oldSlug := thread.Slug
+	if err := s.addRevision("thread", id, thread.Message, &oldSlug, editor); err != nil {
+		return err
+	}
+
+	s.threadIndex.remove(id, thread.Title+" "+thread.Message)
+	s.threadIndex.add(id, thread.Title+" "+message)
+
+	oldMessage := thread.Message
+	s.onRollback(func() {
+		s.threadIndex.remove(id, thread.Title+" "+message)
+		s.threadIndex.add(id, thread.Title+" "+oldMessage)
+		thread.Message, thread.Slug = oldMessage, oldSlug
+	})
+
+	thread.Message = message
+	thread.Slug = slug
+	return nil
+}
+
+func (s *MemoryStore) VoteThread(id int64, vote int) error {
+	defer s.lock()()
+
+	if thread, ok := s.threads[id]; ok {
+		likes, dislikes, points := thread.Likes, thread.Dislikes, thread.Points
+		s.onRollback(func() { thread.Likes, thread.Dislikes, thread.Points = likes, dislikes, points })
+
+		if vote > 0 {
+			thread.Likes++
+		} else {
+			thread.Dislikes++
+		}
+		thread.Points += int64(vote)
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) SetThreadClosed(id int64, closed bool) (bool, error) {
+	defer s.lock()()
+
+	thread, ok := s.threads[id]
+	if !ok || thread.IsClosed == closed {
+		return false, nil
+	}
+
+	thread.IsClosed = closed
+	s.onRollback(func() { thread.IsClosed = !closed })
+	return true, nil
+}
+
+func (s *MemoryStore) setThreadPostsDeleted(id int64, deleted bool) int64 {
+	var count int64
+	for _, post := range s.posts {
+		if post.details.Thread.(int64) == id {
+			if post.details.IsDeleted != deleted {
+				post := post
+				s.onRollback(func() { post.details.IsDeleted = !deleted })
+			}
+			post.details.IsDeleted = deleted
+			count++
+		}
+	}
+	return count
+}
+
+func (s *MemoryStore) RemoveThread(id int64) (bool, error) {
+	defer s.lock()()
+
+	thread, ok := s.threads[id]
+	if !ok {
+		return false, nil
+	}
+
+	changed := !thread.IsDeleted || thread.Posts != 0
+	isDeleted, posts := thread.IsDeleted, thread.Posts
+	s.onRollback(func() { thread.IsDeleted, thread.Posts = isDeleted, posts })
+
+	thread.IsDeleted = true
+	thread.Posts = 0
+
+	s.setThreadPostsDeleted(id, true)
+
+	return changed, nil
+}
+
+func (s *MemoryStore) RestoreThread(id int64) (bool, error) {
+	defer s.lock()()
+
+	count := s.setThreadPostsDeleted(id, false)
+
+	thread, ok := s.threads[id]
+	if !ok {
+		return false, nil
+	}
+
+	changed := thread.IsDeleted || thread.Posts != count
+	isDeleted, posts := thread.IsDeleted, thread.Posts
+	s.onRollback(func() { thread.IsDeleted, thread.Posts = isDeleted, posts })
+
+	thread.IsDeleted = false
+	thread.Posts = count
+
+	return changed, nil
+}
+
+func (s *MemoryStore) UpdateThreadPosts(id int64, delta int) error {
+	defer s.lock()()
+
+	if thread, ok := s.threads[id]; ok {
+		thread.Posts += int64(delta)
+		s.onRollback(func() { thread.Posts -= int64(delta) })
+	}
+
+	return nil
+}
+
+// ======================
+// Subscriptions here
+// ======================
+
+func (s *MemoryStore) Subscribe(thread int64, user string) error {
+	defer s.lock()()
+
+	if _, ok := s.threads[thread]; !ok {
+		return foreignKeyError(int64ToString(thread))
+	}
+	if _, ok := s.users[user]; !ok {
+		return foreignKeyError(user)
+	}
+	if s.subscriptions[user][thread] {
+		return duplicateError(user)
+	}
+
+	if s.subscriptions[user] == nil {
+		s.subscriptions[user] = make(map[int64]bool)
+	}
+	s.subscriptions[user][thread] = true
+	s.onRollback(func() { delete(s.subscriptions[user], thread) })
+
+	return nil
+}
+
+func (s *MemoryStore) Unsubscribe(thread int64, user string) (bool, error) {
+	defer s.lock()()
+
+	if !s.subscriptions[user][thread] {
+		return false, nil
+	}
+
+	delete(s.subscriptions[user], thread)
+	s.onRollback(func() { s.subscriptions[user][thread] = true })
+	return true, nil
+}
+
+func (s *MemoryStore) subscriptionsOf(email string) []int {
+	listSubscriptions := make([]int, 0, len(s.subscriptions[email]))
+	for thread := range s.subscriptions[email] {
+		listSubscriptions = append(listSubscriptions, int(thread))
+	}
+	sort.Ints(listSubscriptions)
+
+	return listSubscriptions
+}
+
+func (s *MemoryStore) GetSubscriptions(email string) ([]int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.subscriptionsOf(email), nil
+}
+
+func (s *MemoryStore) GetSubscriptionsOf(emails []string) (map[string][]int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	groups := make(map[string][]int)
+	for _, email := range emails {
+		if list := s.subscriptionsOf(email); len(list) != 0 {
+			groups[email] = list
+		}
+	}
+
+	return groups, nil
+}
+
+// ======================
+// Posts here
+// ======================
+
+func (s *MemoryStore) CreatePost(post *rs.PostCreate, parent *int64) error {
+	defer s.lock()()
+
+	thread := int64(post.Thread)
+
+	if _, ok := s.threads[thread]; !ok {
+		return foreignKeyError(int64ToString(thread))
+	}
+	if _, ok := s.users[post.User]; !ok {
+		return foreignKeyError(post.User)
+	}
+	if _, ok := s.forums[post.Forum]; !ok {
+		return foreignKeyError(post.Forum)
+	}
+
+	// search place for child
+	var path string
+	var parentId *int64
+	if parent != nil {
+		parentPost, ok := s.posts[*parent]
+		if !ok {
+			return ErrNotFound
+		}
+
+		s.children[parentPost.path]++
+		path = parentPost.path + toBase92(s.children[parentPost.path])
+
+		parentPath := parentPost.path
+		s.onRollback(func() { s.children[parentPath]-- })
+
+		id := *parent
+		parentId = &id
+	}
+
+	s.lastPostId++
+	post.Id = s.lastPostId
+
+	// root posts start their own path
+	if parent == nil {
+		path = toBase92(int(post.Id))
+	}
+
+	s.posts[post.Id] = &memoryPost{
+		details: rs.PostDetails{
+			Date:          post.Date,
+			Forum:         post.Forum,
+			Id:            post.Id,
+			IsApproved:    post.IsApproved,
+			IsHighlighted: post.IsHighlighted,
+			IsEdited:      post.IsEdited,
+			IsSpam:        post.IsSpam,
+			IsDeleted:     post.IsDeleted,
+			Message:       post.Message,
+			Parent:        parentId,
+			Thread:        thread,
+			User:          post.User,
+		},
+		path: path,
+	}
+	s.postIndex.add(post.Id, post.Message)
+
+	id, message := post.Id, post.Message
+	s.onRollback(func() {
+		s.postIndex.remove(id, message)
+		delete(s.posts, id)
+		s.lastPostId--
+	})
+
+	return nil
+}
+
+func (post *memoryPost) copyDetails() rs.PostDetails {
+	details := post.details
+	if post.details.Parent != nil {
+		parent := *post.details.Parent
+		details.Parent = &parent
+	}
+	return details
+}
+
+func (s *MemoryStore) GetPost(id int64) (*rs.PostDetails, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	post, ok := s.posts[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	details := post.copyDetails()
+	return &details, nil
+}
+
+// Posts of one thread/user/forum matching since options
+func (s *MemoryStore) filterPosts(field, value string, opts ListOptions) []*memoryPost {
+	posts := make([]*memoryPost, 0)
+	for _, post := range s.posts {
+		switch field {
+		case "thread":
+			if int64ToString(post.details.Thread.(int64)) != value {
+				continue
+			}
+		case "user":
+			if post.details.User != value {
+				continue
+			}
+		case "forum":
+			if post.details.Forum != value {
+				continue
+			}
+		}
+		if post.details.Id < opts.SinceId || opts.Since != "" && post.details.Date <= opts.Since {
+			continue
+		}
+		posts = append(posts, post)
+	}
+
+	return posts
+}
+
+func copyPosts(posts []*memoryPost, limit int) []rs.PostDetails {
+	result := make([]rs.PostDetails, 0, len(posts))
+	for _, post := range posts[:limitRows(len(posts), limit)] {
+		result = append(result, post.copyDetails())
+	}
+	return result
+}
+
+func (s *MemoryStore) ListPosts(field, value string, opts ListOptions) ([]rs.PostDetails, error) {
+	if field != "thread" && field != "user" && field != "forum" {
+		return nil, fmt.Errorf("can't list posts by %q", field)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	posts := s.filterPosts(field, value, opts)
+
+	sortRows(len(posts), opts.Order,
+		func(i int) string { return posts[i].details.Date },
+		func(i int) int64 { return posts[i].details.Id },
+		func(i, j int) { posts[i], posts[j] = posts[j], posts[i] })
+
+	var afterKey string
+	after, found := s.posts[opts.After]
+	if found {
+		afterKey = after.details.Date
+	}
+	posts = posts[rowsAfter(len(posts), opts,
+		func(i int) string { return posts[i].details.Date },
+		func(i int) int64 { return posts[i].details.Id },
+		afterKey, found):]
+
+	return copyPosts(posts, opts.Limit), nil
+}
+
+// Order posts by root path in the given order, then by full path
+func sortTree(posts []*memoryPost, order string) {
+	sort.Slice(posts, func(i, j int) bool { return treeBefore(posts[i].path, posts[j].path, order) })
+}
+
+func treeBefore(pi, pj string, order string) bool {
+	if ri, rj := pi[:5], pj[:5]; ri != rj {
+		return (ri < rj) != (order == "desc")
+	}
+	return pi < pj
+}
+
+func (s *MemoryStore) ListPostsTree(thread int64, opts ListOptions) ([]rs.PostDetails, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	posts := s.filterPosts("thread", int64ToString(thread), opts)
+	sortTree(posts, opts.Order)
+
+	if opts.After != 0 {
+		start := len(posts)
+		if after, ok := s.posts[opts.After]; ok {
+			start = sort.Search(len(posts), func(i int) bool { return treeBefore(after.path, posts[i].path, opts.Order) })
+		}
+		posts = posts[start:]
+	}
+
+	return copyPosts(posts, opts.Limit), nil
+}
+
+func (s *MemoryStore) ListPostsParentTree(thread int64, opts ListOptions) ([]rs.PostDetails, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// limit applies to root posts
+	roots := make(map[string]bool)
+	for _, post := range s.filterPosts("thread", int64ToString(thread), opts) {
+		if len(post.path) == 5 {
+			roots[post.path] = true
+		}
+	}
+
+	rootPaths := make([]string, 0, len(roots))
+	for path := range roots {
+		rootPaths = append(rootPaths, path)
+	}
+	sort.Strings(rootPaths)
+	if opts.Order == "desc" {
+		sort.Sort(sort.Reverse(sort.StringSlice(rootPaths)))
+	}
+	if opts.After != 0 {
+		start := len(rootPaths)
+		if after, ok := s.posts[opts.After]; ok {
+			start = sort.Search(len(rootPaths), func(i int) bool { return treeBefore(after.path, rootPaths[i], opts.Order) })
+		}
+		rootPaths = rootPaths[start:]
+	}
+	rootPaths = rootPaths[:limitRows(len(rootPaths), opts.Limit)]
+
+	selected := make(map[string]bool, len(rootPaths))
+	for _, path := range rootPaths {
+		selected[path] = true
+	}
+
+	// whole subtrees of the selected roots
+	subtrees := make([]*memoryPost, 0)
+	for _, post := range s.filterPosts("thread", int64ToString(thread), ListOptions{}) {
+		if selected[post.path[:5]] {
+			subtrees = append(subtrees, post)
+		}
+	}
+	sortTree(subtrees, opts.Order)
+
+	return copyPosts(subtrees, -1), nil
+}
+
+func (s *MemoryStore) UpdatePost(id int64, message string, editor *string) error {
+	defer s.lock()()
+
+	post, ok := s.posts[id]
+	if !ok || post.details.Message == message {
+		return nil
+	}
+
+	if err := s.addRevision("post", id, post.details.Message, nil, editor); err != nil {
+		return err
+	}
+
+	s.postIndex.remove(id, post.details.Message)
+	s.postIndex.add(id, message)
+
+	oldMessage, isEdited := post.details.Message, post.details.IsEdited
+	s.onRollback(func() {
+		s.postIndex.remove(id, message)
+		s.postIndex.add(id, oldMessage)
+		post.details.Message, post.details.IsEdited = oldMessage, isEdited
+	})
+
+	post.details.Message = message
+	post.details.IsEdited = true
+	return nil
+}
+
+func (s *MemoryStore) VotePost(id int64, vote int) error {
+	defer s.lock()()
+
+	if post, ok := s.posts[id]; ok {
+		likes, dislikes, points := post.details.Likes, post.details.Dislikes, post.details.Points
+		s.onRollback(func() { post.details.Likes, post.details.Dislikes, post.details.Points = likes, dislikes, points })
+
+		if vote > 0 {
+			post.details.Likes++
+		} else {
+			post.details.Dislikes++
+		}
+		post.details.Points += int64(vote)
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) SetPostDeleted(id int64, deleted bool) (bool, error) {
+	defer s.lock()()
+
+	post, ok := s.posts[id]
+	if !ok || post.details.IsDeleted == deleted {
+		return false, nil
+	}
+
+	post.details.IsDeleted = deleted
+	s.onRollback(func() { post.details.IsDeleted = !deleted })
+	return true, nil
+}
+
+// ======================
+// Votes here
+// ======================
+
+func (s *MemoryStore) SetVote(target string, id int64, user string, vote int) error {
+	if _, err := voteTable(target); err != nil {
+		return err
+	}
+
+	defer s.lock()()
+
+	var likes, dislikes, points *int64
+	switch target {
+	case "thread":
+		thread, ok := s.threads[id]
+		if !ok {
+			return ErrNotFound
+		}
+		likes, dislikes, points = &thread.Likes, &thread.Dislikes, &thread.Points
+	case "post":
+		post, ok := s.posts[id]
+		if !ok {
+			return ErrNotFound
+		}
+		likes, dislikes, points = &post.details.Likes, &post.details.Dislikes, &post.details.Points
+	}
+
+	votes := s.votes[target][id]
+	var old int
+	var oldVote *rs.VoteDetails
+	if current, ok := votes[user]; ok {
+		old = current.Vote
+		saved := *current
+		oldVote = &saved
+	}
+	oldLikes, oldDislikes, oldPoints, lastVoteId := *likes, *dislikes, *points, s.lastVoteId
+
+	switch {
+	case vote == old:
+		return nil
+	case vote == 0:
+		delete(votes, user)
+	case old == 0:
+		if _, ok := s.users[user]; !ok {
+			return foreignKeyError(user)
+		}
+		if votes == nil {
+			votes = make(map[string]*rs.VoteDetails)
+			s.votes[target][id] = votes
+		}
+		s.lastVoteId++
+		votes[user] = &rs.VoteDetails{Id: s.lastVoteId, User: user, Vote: vote, Date: now()}
+	default:
+		votes[user].Vote, votes[user].Date = vote, now()
+	}
+
+	dLikes, dDislikes, dPoints := voteDelta(old, vote)
+	*likes += int64(dLikes)
+	*dislikes += int64(dDislikes)
+	*points += int64(dPoints)
+
+	s.onRollback(func() {
+		*likes, *dislikes, *points, s.lastVoteId = oldLikes, oldDislikes, oldPoints, lastVoteId
+		if oldVote != nil {
+			s.votes[target][id][user] = oldVote
+		} else {
+			delete(s.votes[target][id], user)
+		}
+	})
+	return nil
+}
+
+func now() string { return time.Now().Format("2006-01-02 15:04:05") }
+
+func (s *MemoryStore) ListVotes(target string, id int64, opts ListOptions) ([]rs.VoteDetails, error) {
+	if _, err := voteTable(target); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var afterKey string
+	found := false
+
+	votes := make([]rs.VoteDetails, 0)
+	for _, vote := range s.votes[target][id] {
+		if vote.Id == opts.After {
+			afterKey, found = vote.Date, true
+		}
+		if vote.Id < opts.SinceId || opts.Since != "" && vote.Date <= opts.Since {
+			continue
+		}
+		votes = append(votes, *vote)
+	}
+
+	sortRows(len(votes), opts.Order,
+		func(i int) string { return votes[i].Date },
+		func(i int) int64 { return votes[i].Id },
+		func(i, j int) { votes[i], votes[j] = votes[j], votes[i] })
+
+	votes = votes[rowsAfter(len(votes), opts,
+		func(i int) string { return votes[i].Date },
+		func(i int) int64 { return votes[i].Id },
+		afterKey, found):]
+
+	return votes[:limitRows(len(votes), opts.Limit)], nil
+}
+
+// ======================
+// Revisions here
+// ======================
+
+// Keep the text of a target from before an edit, called with mu held
+func (s *MemoryStore) addRevision(target string, id int64, message string, slug, editor *string) error {
+	if editor != nil {
+		if _, ok := s.users[*editor]; !ok {
+			return foreignKeyError(*editor)
+		}
+	}
+
+	s.lastRevisionId[target]++
+	s.revisions[target][id] = append(s.revisions[target][id],
+		rs.Revision{Id: s.lastRevisionId[target], Message: message, Slug: slug, Editor: editor, Date: now()})
+
+	s.onRollback(func() {
+		list := s.revisions[target][id]
+		s.revisions[target][id] = list[:len(list)-1]
+		s.lastRevisionId[target]--
+	})
+	return nil
+}
+
+func (s *MemoryStore) ListRevisions(target string, id int64, opts ListOptions) ([]rs.Revision, error) {
+	if _, _, err := revisionTable(target); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var afterKey string
+	found := false
+
+	revisions := make([]rs.Revision, 0)
+	for _, revision := range s.revisions[target][id] {
+		if revision.Id == opts.After {
+			afterKey, found = revision.Date, true
+		}
+		if revision.Id < opts.SinceId || opts.Since != "" && revision.Date <= opts.Since {
+			continue
+		}
+		revisions = append(revisions, revision)
+	}
+
+	sortRows(len(revisions), opts.Order,
+		func(i int) string { return revisions[i].Date },
+		func(i int) int64 { return revisions[i].Id },
+		func(i, j int) { revisions[i], revisions[j] = revisions[j], revisions[i] })
+
+	revisions = revisions[rowsAfter(len(revisions), opts,
+		func(i int) string { return revisions[i].Date },
+		func(i int) int64 { return revisions[i].Id },
+		afterKey, found):]
+
+	return revisions[:limitRows(len(revisions), opts.Limit)], nil
+}
+
+func (s *MemoryStore) GetRevision(target string, id, revision int64) (*rs.Revision, error) {
+	if _, _, err := revisionTable(target); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, r := range s.revisions[target][id] {
+		if r.Id == revision {
+			return &r, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// ======================
+// Feed here
+// ======================
+
+func (s *MemoryStore) ListFeed(email string, opts ListOptions) ([]rs.FeedItem, error) {
+	opts.Order = "desc"
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	followees := s.follows[email]
+	keep := func(user interface{}, date string, deleted bool) bool {
+		return followees[user.(string)] && !deleted && (opts.Since == "" || date > opts.Since)
+	}
+
+	items := make([]rs.FeedItem, 0)
+	for id, thread := range s.threads {
+		if keep(thread.User, thread.Date, thread.IsDeleted) {
+			details := *thread
+			items = append(items, rs.FeedItem{Key: feedKey("thread", id), Type: "thread", Thread: &details})
+		}
+	}
+	for id, post := range s.posts {
+		if keep(post.details.User, post.details.Date, post.details.IsDeleted) {
+			details := post.copyDetails()
+			items = append(items, rs.FeedItem{Key: feedKey("post", id), Type: "post", Post: &details})
+		}
+	}
+
+	date := func(i int) string {
+		if items[i].Thread != nil {
+			return items[i].Thread.Date
+		}
+		return items[i].Post.Date
+	}
+	key := func(i int) int64 { return items[i].Key }
+
+	sortRows(len(items), "desc", date, key, func(i, j int) { items[i], items[j] = items[j], items[i] })
+
+	var afterKey string
+	found := false
+	if table, id := feedRow(opts.After); table == "thread" {
+		if thread, ok := s.threads[id]; ok {
+			afterKey, found = thread.Date, true
+		}
+	} else if post, ok := s.posts[id]; ok {
+		afterKey, found = post.details.Date, true
+	}
+	items = items[rowsAfter(len(items), opts, date, key, afterKey, found):]
+
+	return items[:limitRows(len(items), opts.Limit)], nil
+}
+
+// ======================
+// Notifications here
+// ======================
+
+func (s *MemoryStore) MarkNotify(post int64) error {
+	defer s.lock()()
+
+	if _, ok := s.posts[post]; !ok {
+		return foreignKeyError(int64ToString(post))
+	}
+	if s.notifyPending[post] {
+		return duplicateError(int64ToString(post))
+	}
+
+	s.notifyPending[post] = true
+	s.onRollback(func() { delete(s.notifyPending, post) })
+
+	return nil
+}
+
+func (s *MemoryStore) PendingNotify(after int64, limit int) ([]int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	posts := make([]int64, 0)
+	for post := range s.notifyPending {
+		if post > after {
+			posts = append(posts, post)
+		}
+	}
+	sort.Slice(posts, func(i, j int) bool { return posts[i] < posts[j] })
+
+	return posts[:limitRows(len(posts), limit)], nil
+}
+
+func (s *MemoryStore) NotifySubscribers(post int64) (int64, error) {
+	defer s.lock()()
+
+	// whoever takes the mark notifies
+	if !s.notifyPending[post] {
+		return 0, nil
+	}
+	delete(s.notifyPending, post)
+	s.onRollback(func() { s.notifyPending[post] = true })
+
+	p, ok := s.posts[post]
+	if !ok {
+		return 0, nil
+	}
+	thread := p.details.Thread.(int64)
+	author := p.details.User.(string)
+
+	// in email order, so ids don't depend on the map
+	users := make([]string, 0)
+	for user, threads := range s.subscriptions {
+		if threads[thread] && user != author {
+			users = append(users, user)
+		}
+	}
+	sort.Strings(users)
+
+	lastNotificationId := s.lastNotificationId
+	s.onRollback(func() {
+		for _, user := range users {
+			list := s.notifications[user]
+			s.notifications[user] = list[:len(list)-1]
+		}
+		s.lastNotificationId = lastNotificationId
+	})
+
+	date := now()
+	for _, user := range users {
+		s.lastNotificationId++
+		s.notifications[user] = append(s.notifications[user], &rs.Notification{
+			Id: s.lastNotificationId, Thread: thread, Post: post, Author: author, Date: date,
+		})
+	}
+
+	return int64(len(users)), nil
+}
+
+func (s *MemoryStore) ListNotifications(email string, unread bool, opts ListOptions) ([]rs.Notification, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	notifications := make([]rs.Notification, 0)
+	for _, notification := range s.notifications[email] {
+		if unread && notification.IsRead {
+			continue
+		}
+		if notification.Id < opts.SinceId || opts.Since != "" && notification.Date <= opts.Since {
+			continue
+		}
+		notifications = append(notifications, *notification)
+	}
+
+	// listed by id alone, as if id were the key
+	key := func(i int) string { return "" }
+	id := func(i int) int64 { return notifications[i].Id }
+
+	sortRows(len(notifications), opts.Order, key, id,
+		func(i, j int) { notifications[i], notifications[j] = notifications[j], notifications[i] })
+
+	notifications = notifications[rowsAfter(len(notifications), opts, key, id, "", true):]
+
+	return notifications[:limitRows(len(notifications), opts.Limit)], nil
+}
+
+func (s *MemoryStore) CountUnread(email string) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var count int64
+	for _, notification := range s.notifications[email] {
+		if !notification.IsRead {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *MemoryStore) MarkRead(email string, ids []int64) (int64, error) {
+	defer s.lock()()
+
+	marked := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		marked[id] = true
+	}
+
+	var count int64
+	for _, notification := range s.notifications[email] {
+		if !notification.IsRead && (ids == nil || marked[notification.Id]) {
+			notification := notification
+			s.onRollback(func() { notification.IsRead = false })
+
+			notification.IsRead = true
+			count++
+		}
+	}
+	return count, nil
+}
+
+// ======================
+// Search here
+// ======================
+
+// Whether a row passes the forum, user and date filters of opts
+func searchFilter(opts SearchOptions, forum, user, date string) bool {
+	return (opts.Forum == "" || forum == opts.Forum) &&
+		(opts.User == "" || user == opts.User) &&
+		(opts.Since == "" || date > opts.Since) &&
+		(opts.Until == "" || date <= opts.Until)
+}
+
+// Cut ranked hits to the ones after opts.After and to opts.Limit. A hit
+// that is gone, or no longer found, has nothing after it.
+func searchPage(n int, opts SearchOptions, id func(i int) int64) (int, int) {
+	start := 0
+	if opts.After != 0 {
+		start = n
+		for i := 0; i < n; i++ {
+			if id(i) == opts.After {
+				start = i + 1
+				break
+			}
+		}
+	}
+	return start, start + limitRows(n-start, opts.Limit)
+}
+
+func (s *MemoryStore) SearchThreads(opts SearchOptions) ([]rs.ThreadHit, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	hits := make([]rs.ThreadHit, 0)
+	for id, score := range s.threadIndex.search(opts.Terms) {
+		thread := s.threads[id]
+		if thread.IsDeleted || !searchFilter(opts, thread.Forum.(string), thread.User.(string), thread.Date) {
+			continue
+		}
+		hits = append(hits, rs.ThreadHit{ThreadDetails: *thread, Score: score})
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].Id > hits[j].Id
+	})
+
+	start, end := searchPage(len(hits), opts, func(i int) int64 { return hits[i].Id })
+	return hits[start:end], nil
+}
+
+func (s *MemoryStore) SearchPosts(opts SearchOptions) ([]rs.PostHit, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	hits := make([]rs.PostHit, 0)
+	for id, score := range s.postIndex.search(opts.Terms) {
+		post := s.posts[id]
+		if post.details.IsDeleted || post.details.IsSpam ||
+			!searchFilter(opts, post.details.Forum.(string), post.details.User.(string), post.details.Date) {
+			continue
+		}
+		hits = append(hits, rs.PostHit{PostDetails: post.copyDetails(), Score: score})
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].Id > hits[j].Id
+	})
+
+	start, end := searchPage(len(hits), opts, func(i int) int64 { return hits[i].Id })
+	return hits[start:end], nil
+}
+
+// ======================
+// Units of work here
+// ======================
+
+// Units are serialized with each other and with the writes outside of them.
+// Every write of a unit records how to take it back; a unit that returns an
+// error or panics is rolled back, its last write first.
+func (s *MemoryStore) Tx(fn func(tx Store) error) (err error) {
+	// already in one, as the SQL stores do
+	if s.journal != nil {
+		return fn(s)
+	}
+
+	s.txMu.Lock()
+	defer s.txMu.Unlock()
+
+	var journal []func()
+	tx := *s
+	tx.journal = &journal
+
+	defer func() {
+		if failure := recover(); failure != nil {
+			s.rollback(journal)
+			panic(failure)
+		}
+		if err != nil {
+			s.rollback(journal)
+		}
+	}()
+
+	return fn(&tx)
+}
+
+func (s *MemoryStore) rollback(journal []func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := len(journal) - 1; i >= 0; i-- {
+		journal[i]()
+	}
+}
+
+// ======================
+// Information here
+// ======================
+
+func (s *MemoryStore) Status() (*rs.StatusHandler, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return &rs.StatusHandler{
+		User:   int64(len(s.users)),
+		Thread: int64(len(s.threads)),
+		Forum:  int64(len(s.forums)),
+		Post:   int64(len(s.posts)),
+	}, nil
+}
+
+func (s *MemoryStore) Clear() error {
+	defer s.lock()()
+
+	// reset makes new maps, the old ones are left as they were
+	old := *s.memoryData
+	s.onRollback(func() { *s.memoryData = old })
+
+	s.reset()
+
+	return nil
+}
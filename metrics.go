@@ -0,0 +1,199 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// =================
+// Metrics here
+// =================
+
+var (
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "technopark",
+		Name:      "requests_total",
+		Help:      "API requests by endpoint and method.",
+	}, []string{"endpoint", "method"})
+
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "technopark",
+		Name:      "request_duration_seconds",
+		Help:      "API request latency by endpoint.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"endpoint"})
+
+	responsesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "technopark",
+		Name:      "responses_total",
+		Help:      "API responses by endpoint and API code, 0 ok to 5 exist.",
+	}, []string{"endpoint", "code"})
+
+	queryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "technopark",
+		Name:      "query_duration_seconds",
+		Help:      "SQL statement latency by statement and first table.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"query"})
+
+	cacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "technopark",
+		Name:      "cache_requests_total",
+		Help:      "Cache lookups by cache and result, hit or miss.",
+	}, []string{"cache", "result"})
+
+	notifyPosts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "technopark",
+		Name:      "notify_posts_total",
+		Help:      "New posts by notification result: notified, deferred to the sweep on a full queue or failed.",
+	}, []string{"result"})
+
+	notificationsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "technopark",
+		Name:      "notifications_total",
+		Help:      "Notifications given to subscribers.",
+	})
+
+	notifyQueueLength = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "technopark",
+		Name:      "notify_queue_length",
+		Help:      "New posts waiting to notify subscribers.",
+	}, func() float64 { return float64(notifications.queued()) })
+
+	streamEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "technopark",
+		Name:      "stream_events_total",
+		Help:      "Thread events published to the streams by event.",
+	}, []string{"event"})
+
+	streamLagged = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "technopark",
+		Name:      "stream_lagged_total",
+		Help:      "Thread streams dropped for falling behind.",
+	})
+
+	streamClients = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "technopark",
+		Name:      "stream_clients",
+		Help:      "Open thread streams.",
+	}, func() float64 { return float64(threadEvents.clients()) })
+
+	liveClients = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "technopark",
+		Name:      "live_clients",
+		Help:      "Open live gateway connections.",
+	}, func() float64 { return float64(gateway.count()) })
+
+	liveDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "technopark",
+		Name:      "live_dropped_total",
+		Help:      "Live gateway messages dropped for clients falling behind.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(requestsTotal, requestDuration, responsesTotal, queryDuration, cacheRequests,
+		notifyPosts, notificationsTotal, notifyQueueLength, streamEvents, streamLagged, streamClients,
+		liveClients, liveDropped)
+}
+
+// Export the pool stats of db as go_sql_* metrics
+func registerDBMetrics(db *sql.DB, driver string) {
+	prometheus.MustRegister(collectors.NewDBStatsCollector(db, driver))
+}
+
+// Count a request once the response is written. Paths without an API
+// response are counted as "unknown" to keep the label set small.
+func observeRequest(r *http.Request, rec *responseRecorder, start time.Time) {
+	code := rec.code()
+
+	endpoint := r.URL.Path
+	if code < 0 {
+		endpoint = "unknown"
+	}
+
+	requestsTotal.WithLabelValues(endpoint, r.Method).Inc()
+	requestDuration.WithLabelValues(endpoint).Observe(time.Since(start).Seconds())
+	if code >= 0 {
+		responsesTotal.WithLabelValues(endpoint, strconv.Itoa(code)).Inc()
+	}
+}
+
+// ======================
+// Query timing here
+// ======================
+
+// timedQuerier observes the latency of every statement run through it and
+// hands it to the slow query log. For Query and QueryRow that is the time
+// to the first row.
+type timedQuerier struct {
+	db querier
+}
+
+func timed(db querier) querier { return timedQuerier{db: db} }
+
+func (t timedQuerier) Exec(query string, args ...interface{}) (sql.Result, error) {
+	defer observeQuery(query, args, time.Now())
+	return t.db.Exec(query, args...)
+}
+
+func (t timedQuerier) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	defer observeQuery(query, args, time.Now())
+	return t.db.Query(query, args...)
+}
+
+func (t timedQuerier) QueryRow(query string, args ...interface{}) *sql.Row {
+	defer observeQuery(query, args, time.Now())
+	return t.db.QueryRow(query, args...)
+}
+
+func observeQuery(query string, args []interface{}, start time.Time) {
+	d := time.Since(start)
+
+	queryDuration.WithLabelValues(queryLabel(query)).Observe(d.Seconds())
+	slowQueries.observe(query, args, d)
+}
+
+// query -> label, most queries are constants
+var queryLabels sync.Map
+
+// Short label of a query: the statement and its first table, as in
+// "SELECT post" or "UPDATE thread"
+func queryLabel(query string) string {
+	if label, ok := queryLabels.Load(query); ok {
+		return label.(string)
+	}
+
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return ""
+	}
+	label := strings.ToUpper(fields[0])
+
+	var after string
+	switch label {
+	case "SELECT", "DELETE":
+		after = "FROM"
+	case "INSERT":
+		after = "INTO"
+	case "UPDATE":
+		after = "UPDATE"
+	}
+
+	for i := 0; after != "" && i < len(fields)-1; i++ {
+		if strings.EqualFold(fields[i], after) {
+			label += " " + strings.Trim(fields[i+1], "`\"()")
+			break
+		}
+	}
+
+	queryLabels.Store(query, label)
+	return label
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// =================
+// Migrations here
+// =================
+
+// Schema of every SQL backend, migrations/<driver>/NNNN_name.{up,down}.sql
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// ErrSchemaVersion is returned when the database is not at the schema version of the binary
+var ErrSchemaVersion = errors.New("schema version mismatch")
+
+const schemaVersionTable = `CREATE TABLE IF NOT EXISTS schema_version (
+  version INT NOT NULL PRIMARY KEY,
+  name VARCHAR(255) NOT NULL,
+  applied TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`
+
+type migration struct {
+	version int
+	name    string
+	up      string
+	down    string
+}
+
+// Migrator applies the embedded migrations of one driver and records
+// them in the schema_version table, one row per applied migration.
+type Migrator struct {
+	db         *sql.DB
+	driver     string
+	migrations []migration
+}
+
+func NewMigrator(driver string, db *sql.DB) (*Migrator, error) {
+	migrations, err := loadMigrations(driver)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Migrator{db: db, driver: driver, migrations: migrations}
+
+	if _, err := db.Exec(schemaVersionTable); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Read migrations/<driver> sorted by version
+func loadMigrations(driver string) ([]migration, error) {
+	dir := path.Join("migrations", driver)
+
+	entries, err := migrationFiles.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for storage %q", driver)
+	}
+
+	byVersion := make(map[int]*migration)
+	for _, entry := range entries {
+		name := entry.Name()
+
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		i := strings.Index(base, "_")
+		if i < 0 {
+			return nil, fmt.Errorf("bad migration name %q", name)
+		}
+
+		version, err := strconv.Atoi(base[:i])
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("bad migration version %q", name)
+		}
+
+		body, err := migrationFiles.ReadFile(path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &migration{version: version, name: base}
+			byVersion[version] = m
+		} else if m.name != base {
+			return nil, fmt.Errorf("migrations %q and %q share version %d", m.name, base, version)
+		}
+
+		if direction == "up" {
+			m.up = string(body)
+		} else {
+			m.down = string(body)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("migration %q needs both up and down files", m.name)
+		}
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+
+	return migrations, nil
+}
+
+// Split a migration file into statements, dropping "--" comment lines.
+// Migrations must not have ';' inside literals; a CREATE TRIGGER runs to
+// the END of its body.
+func splitStatements(body string) []string {
+	var lines []string
+	for _, line := range strings.Split(body, "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "--") {
+			lines = append(lines, line)
+		}
+	}
+
+	var statements []string
+	var trigger string // statements of a trigger body so far
+	for _, statement := range strings.Split(strings.Join(lines, "\n"), ";") {
+		if trigger != "" {
+			statement = trigger + ";" + statement
+			trigger = ""
+		}
+
+		statement = strings.TrimSpace(statement)
+		upper := strings.ToUpper(statement)
+		if strings.HasPrefix(upper, "CREATE TRIGGER") && !strings.HasSuffix(upper, "END") {
+			trigger = statement
+			continue
+		}
+
+		if statement != "" {
+			statements = append(statements, statement)
+		}
+	}
+	return statements
+}
+
+func (m *Migrator) bind(query string) string {
+	if m.driver == "postgres" {
+		return rebind(query)
+	}
+	return query
+}
+
+// Latest version known to the binary
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].version
+}
+
+// Latest version applied to the database, 0 for an empty one
+func (m *Migrator) Version() (int, error) {
+	var version int
+	err := m.db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version)
+	return version, err
+}
+
+// Run the statements and record the new version in one transaction.
+// MySQL commits DDL implicitly, so a failed MySQL migration may be half applied.
+func (m *Migrator) run(body, record string, args ...interface{}) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, statement := range splitStatements(body) {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(m.bind(record), args...); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Apply all pending migrations
+func (m *Migrator) Up(w io.Writer) error {
+	current, err := m.Version()
+	if err != nil {
+		return err
+	}
+
+	for _, mg := range m.migrations {
+		if mg.version <= current {
+			continue
+		}
+
+		if err := m.run(mg.up, "INSERT INTO schema_version (version, name) VALUES(?, ?)", mg.version, mg.name); err != nil {
+			return fmt.Errorf("migration %s: %v", mg.name, err)
+		}
+		fmt.Fprintf(w, "applied %s\n", mg.name)
+	}
+
+	return nil
+}
+
+// Revert the latest applied migration
+func (m *Migrator) Down(w io.Writer) error {
+	current, err := m.Version()
+	if err != nil {
+		return err
+	}
+
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		mg := m.migrations[i]
+		if mg.version != current {
+			continue
+		}
+
+		if err := m.run(mg.down, "DELETE FROM schema_version WHERE version = ?", mg.version); err != nil {
+			return fmt.Errorf("migration %s: %v", mg.name, err)
+		}
+		fmt.Fprintf(w, "reverted %s\n", mg.name)
+		return nil
+	}
+
+	if current == 0 {
+		fmt.Fprintln(w, "nothing to revert")
+		return nil
+	}
+	return fmt.Errorf("database version %d is unknown to this binary", current)
+}
+
+// Record version as applied without running any SQL, for databases
+// created by hand before schema_version existed
+func (m *Migrator) Force(version int) error {
+	if _, err := m.db.Exec("DELETE FROM schema_version"); err != nil {
+		return err
+	}
+
+	for _, mg := range m.migrations {
+		if mg.version > version {
+			break
+		}
+
+		_, err := m.db.Exec(m.bind("INSERT INTO schema_version (version, name) VALUES(?, ?)"), mg.version, mg.name)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Print every migration with the time it was applied
+func (m *Migrator) Status(w io.Writer) error {
+	rows, err := m.db.Query("SELECT version, applied FROM schema_version")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]string)
+	for rows.Next() {
+		var version int
+		var date string
+		if err := rows.Scan(&version, &date); err != nil {
+			return err
+		}
+		applied[version] = date
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, mg := range m.migrations {
+		date, ok := applied[mg.version]
+		if !ok {
+			date = "pending"
+		}
+		fmt.Fprintf(w, "%-24s %s\n", mg.name, date)
+	}
+
+	return nil
+}
+
+// Return ErrSchemaVersion unless the database is at the latest version
+func (m *Migrator) Check() error {
+	current, err := m.Version()
+	if err != nil {
+		return err
+	}
+
+	if current < m.Latest() {
+		return fmt.Errorf("%w: database is at version %d, binary expects %d, run \"migrate up\"", ErrSchemaVersion, current, m.Latest())
+	} else if current > m.Latest() {
+		return fmt.Errorf("%w: database is at version %d, newer than %d of this binary", ErrSchemaVersion, current, m.Latest())
+	}
+	return nil
+}
+
+// Refuse to start on a schema mismatch. SQLite creates its own schema.
+func checkSchema(driver string, db *sql.DB) {
+	m, err := NewMigrator(driver, db)
+	if err != nil {
+		fatal("schema", err)
+	}
+
+	if driver == "sqlite" {
+		if err := m.Up(os.Stdout); err != nil {
+			fatal("schema", err)
+		}
+	}
+
+	if err := m.Check(); err != nil {
+		fatal("schema", err)
+	}
+}
+
+// migrate up|down|status|force <version> against the configured database
+func migrateCommand(config *Config, args []string) error {
+	if config.Storage == "memory" {
+		return fmt.Errorf("storage %q has no schema to migrate", config.Storage)
+	}
+
+	_, db := openStore(config)
+	defer db.Close()
+
+	m, err := NewMigrator(config.Storage, db)
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		return errors.New("usage: migrate up|down|status|force <version>")
+	}
+
+	switch args[0] {
+	case "up":
+		return m.Up(os.Stdout)
+	case "down":
+		return m.Down(os.Stdout)
+	case "status":
+		return m.Status(os.Stdout)
+	case "force":
+		if len(args) != 2 {
+			return errors.New("usage: migrate force <version>")
+		}
+		version, err := strconv.Atoi(args[1])
+		if err != nil || version < 0 || version > m.Latest() {
+			return fmt.Errorf("bad version %q", args[1])
+		}
+		return m.Force(version)
+	}
+
+	return fmt.Errorf("unknown migrate command %q", args[0])
+}
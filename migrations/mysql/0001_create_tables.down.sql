@@ -0,0 +1,6 @@
+DROP TABLE `post`;
+DROP TABLE `subscribe`;
+DROP TABLE `thread`;
+DROP TABLE `follow`;
+DROP TABLE `forum`;
+DROP TABLE `user`;
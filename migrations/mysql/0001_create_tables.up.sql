@@ -1,22 +1,18 @@
-SET @OLD_UNIQUE_CHECKS=@@UNIQUE_CHECKS, UNIQUE_CHECKS=0;
-SET @OLD_FOREIGN_KEY_CHECKS=@@FOREIGN_KEY_CHECKS, FOREIGN_KEY_CHECKS=0;
-SET @OLD_SQL_MODE=@@SQL_MODE, SQL_MODE='TRADITIONAL,ALLOW_INVALID_DATES';
-
-CREATE SCHEMA IF NOT EXISTS `mydb` DEFAULT CHARACTER SET utf8 COLLATE utf8_general_ci ;
-USE `mydb` ;
-
 -- -----------------------------------------------------
--- Table `mydb`.`user`
+-- Tables for -storage=mysql
+--
+-- post.parent holds the base92 materialized path. It is binary so that
+-- case and trailing spaces count in comparisons and ordering.
 -- -----------------------------------------------------
-CREATE TABLE IF NOT EXISTS `mydb`.`user` (
+
+CREATE TABLE `user` (
   `id` INT NOT NULL AUTO_INCREMENT,
   `username` VARCHAR(32) NULL,
   `about` TEXT NULL,
   `name` VARCHAR(32) NULL,
   `email` VARCHAR(255) NOT NULL,
   `isAnonymous` TINYINT(1) NOT NULL DEFAULT 0,
-  `date` TIMESTAMP NOT NULL,
-  UNIQUE INDEX `email_UNIQUE` (`email` ASC),
+  `date` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
   PRIMARY KEY (`email`),
   UNIQUE INDEX `id_UNIQUE` (`id` ASC))
 ENGINE = InnoDB
@@ -24,122 +20,92 @@ DEFAULT CHARACTER SET = utf8
 COLLATE = utf8_general_ci;
 
 
--- -----------------------------------------------------
--- Table `mydb`.`forum`
--- -----------------------------------------------------
-CREATE TABLE IF NOT EXISTS `mydb`.`forum` (
+CREATE TABLE `forum` (
   `id` INT NOT NULL AUTO_INCREMENT,
   `name` VARCHAR(255) NOT NULL,
   `short_name` VARCHAR(255) NOT NULL,
   `user` VARCHAR(255) NOT NULL,
   `date` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
-  INDEX `user_idx` (`user` ASC),
   PRIMARY KEY (`short_name`),
-  UNIQUE INDEX `short_name_UNIQUE` (`short_name` ASC),
   UNIQUE INDEX `name_UNIQUE` (`name` ASC),
   UNIQUE INDEX `id_UNIQUE` (`id` ASC),
+  INDEX `user_idx` (`user` ASC),
   CONSTRAINT `fk_forum_user`
     FOREIGN KEY (`user`)
-    REFERENCES `mydb`.`user` (`email`)
-    ON DELETE NO ACTION
-    ON UPDATE NO ACTION)
+    REFERENCES `user` (`email`))
 ENGINE = InnoDB
 DEFAULT CHARACTER SET = utf8
-COLLATE = utf8_general_ci
-PACK_KEYS = DEFAULT;
+COLLATE = utf8_general_ci;
 
 
--- -----------------------------------------------------
--- Table `mydb`.`follow`
--- -----------------------------------------------------
-CREATE TABLE IF NOT EXISTS `mydb`.`follow` (
+CREATE TABLE `follow` (
   `follower` VARCHAR(255) NOT NULL,
   `followee` VARCHAR(255) NOT NULL,
   PRIMARY KEY (`followee`, `follower`),
   INDEX `fk_follow_1_idx` (`follower` ASC),
   CONSTRAINT `fk_follow_follower`
     FOREIGN KEY (`follower`)
-    REFERENCES `mydb`.`user` (`email`)
-    ON DELETE NO ACTION
-    ON UPDATE NO ACTION,
+    REFERENCES `user` (`email`),
   CONSTRAINT `fk_follow_followee`
     FOREIGN KEY (`followee`)
-    REFERENCES `mydb`.`user` (`email`)
-    ON DELETE NO ACTION
-    ON UPDATE NO ACTION)
+    REFERENCES `user` (`email`))
 ENGINE = InnoDB
 DEFAULT CHARACTER SET = utf8
 COLLATE = utf8_general_ci;
 
 
--- -----------------------------------------------------
--- Table `mydb`.`thread`
--- -----------------------------------------------------
-CREATE TABLE IF NOT EXISTS `mydb`.`thread` (
+CREATE TABLE `thread` (
   `id` INT NOT NULL AUTO_INCREMENT,
   `forum` VARCHAR(255) NOT NULL,
-  `title` VARCHAR(45) NOT NULL,
+  `title` VARCHAR(255) NOT NULL,
   `isClosed` TINYINT(1) NOT NULL,
   `user` VARCHAR(255) NOT NULL,
   `date` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
   `message` TEXT NOT NULL,
-  `slug` VARCHAR(45) NOT NULL,
+  `slug` VARCHAR(255) NOT NULL,
   `isDeleted` TINYINT(1) NOT NULL DEFAULT 0,
   `likes` INT NOT NULL DEFAULT 0,
   `dislikes` INT NOT NULL DEFAULT 0,
   `points` INT NOT NULL DEFAULT 0,
+  `posts` INT NOT NULL DEFAULT 0,
   PRIMARY KEY (`id`),
+  INDEX `fk_thread_forum_idx` (`forum` ASC),
   INDEX `fk_user_idx` (`user` ASC),
-  UNIQUE INDEX `id_UNIQUE` (`id` ASC),
   CONSTRAINT `fk_thread_forum`
     FOREIGN KEY (`forum`)
-    REFERENCES `mydb`.`forum` (`short_name`)
-    ON DELETE NO ACTION
-    ON UPDATE NO ACTION,
+    REFERENCES `forum` (`short_name`),
   CONSTRAINT `fk_thread_user`
     FOREIGN KEY (`user`)
-    REFERENCES `mydb`.`user` (`email`)
-    ON DELETE NO ACTION
-    ON UPDATE NO ACTION)
+    REFERENCES `user` (`email`))
 ENGINE = InnoDB
 DEFAULT CHARACTER SET = utf8
 COLLATE = utf8_general_ci;
 
 
--- -----------------------------------------------------
--- Table `mydb`.`subscribe`
--- -----------------------------------------------------
-CREATE TABLE IF NOT EXISTS `mydb`.`subscribe` (
+CREATE TABLE `subscribe` (
   `thread` INT NOT NULL,
   `user` VARCHAR(255) NOT NULL,
   PRIMARY KEY (`thread`, `user`),
   INDEX `fk_subscribe_user_idx` (`user` ASC),
   CONSTRAINT `fk_subscribe_thread`
     FOREIGN KEY (`thread`)
-    REFERENCES `mydb`.`thread` (`id`)
-    ON DELETE NO ACTION
-    ON UPDATE NO ACTION,
+    REFERENCES `thread` (`id`),
   CONSTRAINT `fk_subscribe_user`
     FOREIGN KEY (`user`)
-    REFERENCES `mydb`.`user` (`email`)
-    ON DELETE NO ACTION
-    ON UPDATE NO ACTION)
+    REFERENCES `user` (`email`))
 ENGINE = InnoDB
 DEFAULT CHARACTER SET = utf8
 COLLATE = utf8_general_ci;
 
 
--- -----------------------------------------------------
--- Table `mydb`.`post`
--- -----------------------------------------------------
-CREATE TABLE IF NOT EXISTS `mydb`.`post` (
+CREATE TABLE `post` (
   `id` INT NOT NULL AUTO_INCREMENT,
-  `date` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '		',
+  `date` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
   `thread` INT NOT NULL,
   `message` TEXT NOT NULL,
   `user` VARCHAR(255) NOT NULL,
   `forum` VARCHAR(255) NOT NULL,
-  `parent` VARCHAR(255) NULL DEFAULT 0,
+  `parent` VARBINARY(255) NULL,
   `isApproved` TINYINT(1) NOT NULL DEFAULT 0,
   `isHighlighted` TINYINT(1) NOT NULL DEFAULT 0,
   `isEdited` TINYINT(1) NOT NULL DEFAULT 0,
@@ -149,31 +115,18 @@ CREATE TABLE IF NOT EXISTS `mydb`.`post` (
   `dislikes` INT NOT NULL DEFAULT 0,
   `points` INT NOT NULL DEFAULT 0,
   PRIMARY KEY (`id`),
+  INDEX `fk_post_thread_idx` (`thread` ASC),
   INDEX `fk_post_user_idx` (`user` ASC),
   INDEX `fk_post_forum_idx` (`forum` ASC),
-  UNIQUE INDEX `id_UNIQUE` (`id` ASC),
-  INDEX `fk_post_thread_idx` (`thread` ASC),
   CONSTRAINT `fk_post_thread`
     FOREIGN KEY (`thread`)
-    REFERENCES `mydb`.`thread` (`id`)
-    ON DELETE NO ACTION
-    ON UPDATE NO ACTION,
+    REFERENCES `thread` (`id`),
   CONSTRAINT `fk_post_user`
     FOREIGN KEY (`user`)
-    REFERENCES `mydb`.`user` (`email`)
-    ON DELETE NO ACTION
-    ON UPDATE NO ACTION,
+    REFERENCES `user` (`email`),
   CONSTRAINT `fk_post_forum`
     FOREIGN KEY (`forum`)
-    REFERENCES `mydb`.`forum` (`short_name`)
-    ON DELETE NO ACTION
-    ON UPDATE NO ACTION)
+    REFERENCES `forum` (`short_name`))
 ENGINE = InnoDB
 DEFAULT CHARACTER SET = utf8
-COLLATE = utf8_general_ci
-PACK_KEYS = DEFAULT;
-
-
-SET SQL_MODE=@OLD_SQL_MODE;
-SET FOREIGN_KEY_CHECKS=@OLD_FOREIGN_KEY_CHECKS;
-SET UNIQUE_CHECKS=@OLD_UNIQUE_CHECKS;
+COLLATE = utf8_general_ci;
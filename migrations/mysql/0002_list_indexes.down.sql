@@ -0,0 +1,7 @@
+DROP INDEX `post_user_date_idx` ON `post`;
+DROP INDEX `post_forum_date_idx` ON `post`;
+DROP INDEX `post_parent_idx` ON `post`;
+DROP INDEX `post_thread_parent_idx` ON `post`;
+DROP INDEX `post_thread_date_idx` ON `post`;
+DROP INDEX `thread_user_date_idx` ON `thread`;
+DROP INDEX `thread_forum_date_idx` ON `thread`;
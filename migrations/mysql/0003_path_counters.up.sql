@@ -0,0 +1,37 @@
+-- -----------------------------------------------------
+-- Race-free reply paths
+--
+-- post.children counts the replies of a post. A new reply bumps the
+-- counter of its parent, which locks the parent row until the reply is
+-- committed, and takes the counter as its last path segment.
+--
+-- The old allocator could hand out a path twice, such duplicates have to
+-- be renumbered by hand before the unique index can be built.
+-- -----------------------------------------------------
+
+ALTER TABLE `post` ADD `children` INT NOT NULL DEFAULT 0;
+
+-- The counter starts at the largest segment in use, the number of replies
+-- can be lower than that. parent is binary, MAX compares bytes, and base92
+-- digits go up in ASCII order: ' ' to '~' but for '%', '\' and '_'.
+UPDATE `post` p JOIN (
+  SELECT `path`,
+    ASCII(SUBSTRING(`segment`, 1, 1)) AS `d1`,
+    ASCII(SUBSTRING(`segment`, 2, 1)) AS `d2`,
+    ASCII(SUBSTRING(`segment`, 3, 1)) AS `d3`,
+    ASCII(SUBSTRING(`segment`, 4, 1)) AS `d4`,
+    ASCII(SUBSTRING(`segment`, 5, 1)) AS `d5`
+  FROM (
+    SELECT SUBSTRING(`parent`, 1, LENGTH(`parent`) - 5) AS `path`, MAX(SUBSTRING(`parent`, -5)) AS `segment`
+    FROM `post`
+    WHERE LENGTH(`parent`) > 5
+    GROUP BY `path`) l) c ON c.`path` = p.`parent`
+SET p.`children` =
+    (c.`d1` - 32 - (c.`d1` > 37) - (c.`d1` > 92) - (c.`d1` > 95)) * 71639296
+  + (c.`d2` - 32 - (c.`d2` > 37) - (c.`d2` > 92) - (c.`d2` > 95)) * 778688
+  + (c.`d3` - 32 - (c.`d3` > 37) - (c.`d3` > 92) - (c.`d3` > 95)) * 8464
+  + (c.`d4` - 32 - (c.`d4` > 37) - (c.`d4` > 92) - (c.`d4` > 95)) * 92
+  + (c.`d5` - 32 - (c.`d5` > 37) - (c.`d5` > 92) - (c.`d5` > 95)) * 1;
+
+DROP INDEX `post_thread_parent_idx` ON `post`;
+CREATE UNIQUE INDEX `post_thread_parent_idx` ON `post` (`thread`, `parent`);
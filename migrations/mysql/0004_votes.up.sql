@@ -0,0 +1,46 @@
+-- -----------------------------------------------------
+-- Votes of users on threads and posts
+--
+-- One row per user and target, vote is 1 or -1. likes, dislikes and
+-- points of the target count these rows plus the anonymous votes, those
+-- cast without a user field and those from before this table.
+-- -----------------------------------------------------
+
+CREATE TABLE `thread_vote` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `thread` INT NOT NULL,
+  `user` VARCHAR(255) NOT NULL,
+  `vote` TINYINT NOT NULL,
+  `date` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `thread_vote_thread_user_idx` (`thread`, `user`),
+  INDEX `fk_thread_vote_user_idx` (`user` ASC),
+  CONSTRAINT `fk_thread_vote_thread`
+    FOREIGN KEY (`thread`)
+    REFERENCES `thread` (`id`),
+  CONSTRAINT `fk_thread_vote_user`
+    FOREIGN KEY (`user`)
+    REFERENCES `user` (`email`))
+ENGINE = InnoDB
+DEFAULT CHARACTER SET = utf8
+COLLATE = utf8_general_ci;
+
+
+CREATE TABLE `post_vote` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `post` INT NOT NULL,
+  `user` VARCHAR(255) NOT NULL,
+  `vote` TINYINT NOT NULL,
+  `date` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `post_vote_post_user_idx` (`post`, `user`),
+  INDEX `fk_post_vote_user_idx` (`user` ASC),
+  CONSTRAINT `fk_post_vote_post`
+    FOREIGN KEY (`post`)
+    REFERENCES `post` (`id`),
+  CONSTRAINT `fk_post_vote_user`
+    FOREIGN KEY (`user`)
+    REFERENCES `user` (`email`))
+ENGINE = InnoDB
+DEFAULT CHARACTER SET = utf8
+COLLATE = utf8_general_ci;
@@ -0,0 +1,2 @@
+DROP TABLE `post_revision`;
+DROP TABLE `thread_revision`;
@@ -0,0 +1,46 @@
+-- -----------------------------------------------------
+-- Revisions of thread and post texts
+--
+-- A row per edit with the text from before it, who made it (NULL when the
+-- request didn't say) and when. The current text stays in thread and post.
+-- -----------------------------------------------------
+
+CREATE TABLE `thread_revision` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `thread` INT NOT NULL,
+  `message` TEXT NOT NULL,
+  `slug` VARCHAR(255) NOT NULL,
+  `editor` VARCHAR(255) NULL,
+  `date` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  INDEX `thread_revision_thread_date_idx` (`thread`, `date`),
+  INDEX `fk_thread_revision_editor_idx` (`editor` ASC),
+  CONSTRAINT `fk_thread_revision_thread`
+    FOREIGN KEY (`thread`)
+    REFERENCES `thread` (`id`),
+  CONSTRAINT `fk_thread_revision_editor`
+    FOREIGN KEY (`editor`)
+    REFERENCES `user` (`email`))
+ENGINE = InnoDB
+DEFAULT CHARACTER SET = utf8
+COLLATE = utf8_general_ci;
+
+
+CREATE TABLE `post_revision` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `post` INT NOT NULL,
+  `message` TEXT NOT NULL,
+  `editor` VARCHAR(255) NULL,
+  `date` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  INDEX `post_revision_post_date_idx` (`post`, `date`),
+  INDEX `fk_post_revision_editor_idx` (`editor` ASC),
+  CONSTRAINT `fk_post_revision_post`
+    FOREIGN KEY (`post`)
+    REFERENCES `post` (`id`),
+  CONSTRAINT `fk_post_revision_editor`
+    FOREIGN KEY (`editor`)
+    REFERENCES `user` (`email`))
+ENGINE = InnoDB
+DEFAULT CHARACTER SET = utf8
+COLLATE = utf8_general_ci;
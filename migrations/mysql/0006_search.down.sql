@@ -0,0 +1,2 @@
+DROP INDEX `post_message_ft_idx` ON `post`;
+DROP INDEX `thread_title_message_ft_idx` ON `thread`;
@@ -0,0 +1,9 @@
+-- -----------------------------------------------------
+-- Full-text search of threads and posts
+--
+-- The search queries match these columns exactly, in boolean mode. Words
+-- shorter than innodb_ft_min_token_size and stopwords are not indexed.
+-- -----------------------------------------------------
+
+CREATE FULLTEXT INDEX `thread_title_message_ft_idx` ON `thread` (`title`, `message`);
+CREATE FULLTEXT INDEX `post_message_ft_idx` ON `post` (`message`);
@@ -0,0 +1,31 @@
+-- -----------------------------------------------------
+-- Notifications of subscribers
+--
+-- A row per subscriber of a thread and post created in it, the author of
+-- the post left out. Rows are read newest first per user, and counted
+-- unread.
+-- -----------------------------------------------------
+
+CREATE TABLE `notification` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `user` VARCHAR(255) NOT NULL,
+  `thread` INT NOT NULL,
+  `post` INT NOT NULL,
+  `isRead` TINYINT(1) NOT NULL DEFAULT 0,
+  `date` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  INDEX `notification_user_read_idx` (`user`, `isRead`),
+  INDEX `fk_notification_thread_idx` (`thread` ASC),
+  INDEX `fk_notification_post_idx` (`post` ASC),
+  CONSTRAINT `fk_notification_user`
+    FOREIGN KEY (`user`)
+    REFERENCES `user` (`email`),
+  CONSTRAINT `fk_notification_thread`
+    FOREIGN KEY (`thread`)
+    REFERENCES `thread` (`id`),
+  CONSTRAINT `fk_notification_post`
+    FOREIGN KEY (`post`)
+    REFERENCES `post` (`id`))
+ENGINE = InnoDB
+DEFAULT CHARACTER SET = utf8
+COLLATE = utf8_general_ci;
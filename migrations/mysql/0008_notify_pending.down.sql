@@ -0,0 +1 @@
+DROP TABLE `notify_pending`;
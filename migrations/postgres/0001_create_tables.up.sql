@@ -0,0 +1,76 @@
+-- -----------------------------------------------------
+-- Tables for -storage=postgres:<dsn>
+--
+-- post.path is the array of ancestor ids ending with the post's own id,
+-- so ORDER BY path[1], path gives tree order without base92 strings.
+-- -----------------------------------------------------
+
+CREATE TABLE users (
+  id SERIAL NOT NULL UNIQUE,
+  username VARCHAR(32) NULL,
+  about TEXT NULL,
+  name VARCHAR(32) NULL,
+  email VARCHAR(255) NOT NULL PRIMARY KEY,
+  isanonymous BOOLEAN NOT NULL DEFAULT false,
+  date TIMESTAMP NOT NULL DEFAULT now()
+);
+
+
+CREATE TABLE forum (
+  id SERIAL NOT NULL UNIQUE,
+  name VARCHAR(255) NOT NULL UNIQUE,
+  short_name VARCHAR(255) NOT NULL PRIMARY KEY,
+  "user" VARCHAR(255) NOT NULL REFERENCES users (email),
+  date TIMESTAMP NOT NULL DEFAULT now()
+);
+
+
+CREATE TABLE follow (
+  follower VARCHAR(255) NOT NULL REFERENCES users (email),
+  followee VARCHAR(255) NOT NULL REFERENCES users (email),
+  PRIMARY KEY (followee, follower)
+);
+
+
+CREATE TABLE thread (
+  id SERIAL NOT NULL PRIMARY KEY,
+  forum VARCHAR(255) NOT NULL REFERENCES forum (short_name),
+  title VARCHAR(255) NOT NULL,
+  isclosed BOOLEAN NOT NULL,
+  "user" VARCHAR(255) NOT NULL REFERENCES users (email),
+  date TIMESTAMP NOT NULL DEFAULT now(),
+  message TEXT NOT NULL,
+  slug VARCHAR(255) NOT NULL,
+  isdeleted BOOLEAN NOT NULL DEFAULT false,
+  likes INT NOT NULL DEFAULT 0,
+  dislikes INT NOT NULL DEFAULT 0,
+  points INT NOT NULL DEFAULT 0,
+  posts INT NOT NULL DEFAULT 0
+);
+
+
+CREATE TABLE subscribe (
+  thread INT NOT NULL REFERENCES thread (id),
+  "user" VARCHAR(255) NOT NULL REFERENCES users (email),
+  PRIMARY KEY (thread, "user")
+);
+
+
+CREATE TABLE post (
+  id SERIAL NOT NULL PRIMARY KEY,
+  date TIMESTAMP NOT NULL DEFAULT now(),
+  thread INT NOT NULL REFERENCES thread (id),
+  message TEXT NOT NULL,
+  "user" VARCHAR(255) NOT NULL REFERENCES users (email),
+  forum VARCHAR(255) NOT NULL REFERENCES forum (short_name),
+  parent INT NULL REFERENCES post (id),
+  path INT[] NOT NULL,
+  isapproved BOOLEAN NOT NULL DEFAULT false,
+  ishighlighted BOOLEAN NOT NULL DEFAULT false,
+  isedited BOOLEAN NOT NULL DEFAULT false,
+  isspam BOOLEAN NOT NULL DEFAULT false,
+  isdeleted BOOLEAN NOT NULL DEFAULT false,
+  likes INT NOT NULL DEFAULT 0,
+  dislikes INT NOT NULL DEFAULT 0,
+  points INT NOT NULL DEFAULT 0
+);
@@ -0,0 +1 @@
+DROP INDEX post_thread_path_key;
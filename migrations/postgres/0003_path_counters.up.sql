@@ -0,0 +1,9 @@
+-- -----------------------------------------------------
+-- Race-free reply paths
+--
+-- post.path ends with the post's own id, taken from the sequence, so
+-- concurrent replies never share a path. The unique index makes that a
+-- constraint, as (thread, parent) is for the base92 backends.
+-- -----------------------------------------------------
+
+CREATE UNIQUE INDEX post_thread_path_key ON post (thread, path);
@@ -0,0 +1,25 @@
+-- -----------------------------------------------------
+-- Votes of users on threads and posts
+--
+-- One row per user and target, vote is 1 or -1. likes, dislikes and
+-- points of the target count these rows plus the anonymous votes.
+-- -----------------------------------------------------
+
+CREATE TABLE thread_vote (
+  id SERIAL NOT NULL PRIMARY KEY,
+  thread INT NOT NULL REFERENCES thread (id),
+  "user" VARCHAR(255) NOT NULL REFERENCES users (email),
+  vote SMALLINT NOT NULL,
+  date TIMESTAMP NOT NULL DEFAULT now(),
+  UNIQUE (thread, "user")
+);
+
+
+CREATE TABLE post_vote (
+  id SERIAL NOT NULL PRIMARY KEY,
+  post INT NOT NULL REFERENCES post (id),
+  "user" VARCHAR(255) NOT NULL REFERENCES users (email),
+  vote SMALLINT NOT NULL,
+  date TIMESTAMP NOT NULL DEFAULT now(),
+  UNIQUE (post, "user")
+);
@@ -0,0 +1,28 @@
+-- -----------------------------------------------------
+-- Revisions of thread and post texts
+--
+-- A row per edit with the text from before it, who made it (NULL when the
+-- request didn't say) and when. The current text stays in thread and post.
+-- -----------------------------------------------------
+
+CREATE TABLE thread_revision (
+  id SERIAL NOT NULL PRIMARY KEY,
+  thread INT NOT NULL REFERENCES thread (id),
+  message TEXT NOT NULL,
+  slug VARCHAR(255) NOT NULL,
+  editor VARCHAR(255) NULL REFERENCES users (email),
+  date TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX thread_revision_thread_date_idx ON thread_revision (thread, date);
+
+
+CREATE TABLE post_revision (
+  id SERIAL NOT NULL PRIMARY KEY,
+  post INT NOT NULL REFERENCES post (id),
+  message TEXT NOT NULL,
+  editor VARCHAR(255) NULL REFERENCES users (email),
+  date TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX post_revision_post_date_idx ON post_revision (post, date);
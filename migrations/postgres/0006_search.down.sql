@@ -0,0 +1,2 @@
+DROP INDEX post_message_fts_idx;
+DROP INDEX thread_title_message_fts_idx;
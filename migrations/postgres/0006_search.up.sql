@@ -0,0 +1,9 @@
+-- -----------------------------------------------------
+-- Full-text search of threads and posts
+--
+-- The search queries use these very expressions. The simple configuration
+-- only lowercases, as the other backends do: no stemming, no stopwords.
+-- -----------------------------------------------------
+
+CREATE INDEX thread_title_message_fts_idx ON thread USING GIN (to_tsvector('simple', title || ' ' || message));
+CREATE INDEX post_message_fts_idx ON post USING GIN (to_tsvector('simple', message));
@@ -0,0 +1,18 @@
+-- -----------------------------------------------------
+-- Notifications of subscribers
+--
+-- A row per subscriber of a thread and post created in it, the author of
+-- the post left out. Rows are read newest first per user, and counted
+-- unread.
+-- -----------------------------------------------------
+
+CREATE TABLE notification (
+  id SERIAL NOT NULL PRIMARY KEY,
+  "user" VARCHAR(255) NOT NULL REFERENCES users (email),
+  thread INT NOT NULL REFERENCES thread (id),
+  post INT NOT NULL REFERENCES post (id),
+  isRead BOOLEAN NOT NULL DEFAULT FALSE,
+  date TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX notification_user_read_idx ON notification ("user", isRead, id);
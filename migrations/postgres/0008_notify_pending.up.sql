@@ -0,0 +1,11 @@
+-- -----------------------------------------------------
+-- Posts waiting to notify their subscribers
+--
+-- post/create writes the row along with the post, a notify worker gives
+-- the notifications and deletes it in one unit. A post the queue had no
+-- room for, or that a restart cut off, is still here for the next sweep.
+-- -----------------------------------------------------
+
+CREATE TABLE notify_pending (
+  post INT NOT NULL PRIMARY KEY REFERENCES post (id)
+);
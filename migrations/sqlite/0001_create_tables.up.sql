@@ -0,0 +1,75 @@
+-- -----------------------------------------------------
+-- Tables for -storage=sqlite:<file>
+--
+-- post.parent holds the base92 materialized path, as in the MySQL schema.
+-- Dates are TEXT so the driver returns them as they were written.
+-- -----------------------------------------------------
+
+CREATE TABLE user (
+  id INTEGER NOT NULL UNIQUE,
+  username TEXT NULL,
+  about TEXT NULL,
+  name TEXT NULL,
+  email TEXT NOT NULL PRIMARY KEY,
+  isAnonymous INTEGER NOT NULL DEFAULT 0,
+  date TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+
+CREATE TABLE forum (
+  id INTEGER NOT NULL UNIQUE,
+  name TEXT NOT NULL UNIQUE,
+  short_name TEXT NOT NULL PRIMARY KEY,
+  user TEXT NOT NULL REFERENCES user (email),
+  date TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+
+CREATE TABLE follow (
+  follower TEXT NOT NULL REFERENCES user (email),
+  followee TEXT NOT NULL REFERENCES user (email),
+  PRIMARY KEY (followee, follower)
+);
+
+
+CREATE TABLE thread (
+  id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+  forum TEXT NOT NULL REFERENCES forum (short_name),
+  title TEXT NOT NULL,
+  isClosed INTEGER NOT NULL,
+  user TEXT NOT NULL REFERENCES user (email),
+  date TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  message TEXT NOT NULL,
+  slug TEXT NOT NULL,
+  isDeleted INTEGER NOT NULL DEFAULT 0,
+  likes INTEGER NOT NULL DEFAULT 0,
+  dislikes INTEGER NOT NULL DEFAULT 0,
+  points INTEGER NOT NULL DEFAULT 0,
+  posts INTEGER NOT NULL DEFAULT 0
+);
+
+
+CREATE TABLE subscribe (
+  thread INTEGER NOT NULL REFERENCES thread (id),
+  user TEXT NOT NULL REFERENCES user (email),
+  PRIMARY KEY (thread, user)
+);
+
+
+CREATE TABLE post (
+  id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+  date TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  thread INTEGER NOT NULL REFERENCES thread (id),
+  message TEXT NOT NULL,
+  user TEXT NOT NULL REFERENCES user (email),
+  forum TEXT NOT NULL REFERENCES forum (short_name),
+  parent TEXT NULL,
+  isApproved INTEGER NOT NULL DEFAULT 0,
+  isHighlighted INTEGER NOT NULL DEFAULT 0,
+  isEdited INTEGER NOT NULL DEFAULT 0,
+  isSpam INTEGER NOT NULL DEFAULT 0,
+  isDeleted INTEGER NOT NULL DEFAULT 0,
+  likes INTEGER NOT NULL DEFAULT 0,
+  dislikes INTEGER NOT NULL DEFAULT 0,
+  points INTEGER NOT NULL DEFAULT 0
+);
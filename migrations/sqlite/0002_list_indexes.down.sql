@@ -0,0 +1,9 @@
+DROP INDEX post_user_date_idx;
+DROP INDEX post_forum_date_idx;
+DROP INDEX post_parent_idx;
+DROP INDEX post_thread_parent_idx;
+DROP INDEX post_thread_date_idx;
+DROP INDEX subscribe_user_idx;
+DROP INDEX thread_user_date_idx;
+DROP INDEX thread_forum_date_idx;
+DROP INDEX follow_follower_idx;
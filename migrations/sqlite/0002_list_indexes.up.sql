@@ -0,0 +1,13 @@
+-- -----------------------------------------------------
+-- Indexes for the list and tree queries
+-- -----------------------------------------------------
+
+CREATE INDEX follow_follower_idx ON follow (follower);
+CREATE INDEX thread_forum_date_idx ON thread (forum, date);
+CREATE INDEX thread_user_date_idx ON thread (user, date);
+CREATE INDEX subscribe_user_idx ON subscribe (user);
+CREATE INDEX post_thread_date_idx ON post (thread, date);
+CREATE INDEX post_thread_parent_idx ON post (thread, parent);
+CREATE INDEX post_parent_idx ON post (parent);
+CREATE INDEX post_forum_date_idx ON post (forum, date);
+CREATE INDEX post_user_date_idx ON post (user, date);
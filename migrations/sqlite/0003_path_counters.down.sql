@@ -0,0 +1,4 @@
+DROP INDEX post_thread_parent_idx;
+CREATE INDEX post_thread_parent_idx ON post (thread, parent);
+
+ALTER TABLE post DROP COLUMN children;
@@ -0,0 +1,33 @@
+-- -----------------------------------------------------
+-- Race-free reply paths
+--
+-- post.children counts the replies of a post, a new reply bumps the
+-- counter of its parent and takes it as its last path segment.
+-- -----------------------------------------------------
+
+ALTER TABLE post ADD children INTEGER NOT NULL DEFAULT 0;
+
+-- The counter starts at the largest segment in use, the number of replies
+-- can be lower than that. Base92 digits go up in ASCII order: ' ' to '~'
+-- but for '%', '\' and '_'.
+UPDATE post SET children = ifnull((
+  SELECT
+      (d1 - 32 - (d1 > 37) - (d1 > 92) - (d1 > 95)) * 71639296
+    + (d2 - 32 - (d2 > 37) - (d2 > 92) - (d2 > 95)) * 778688
+    + (d3 - 32 - (d3 > 37) - (d3 > 92) - (d3 > 95)) * 8464
+    + (d4 - 32 - (d4 > 37) - (d4 > 92) - (d4 > 95)) * 92
+    + (d5 - 32 - (d5 > 37) - (d5 > 92) - (d5 > 95)) * 1
+  FROM (
+    SELECT
+      unicode(substr(max(substr(c.parent, -5)), 1, 1)) AS d1,
+      unicode(substr(max(substr(c.parent, -5)), 2, 1)) AS d2,
+      unicode(substr(max(substr(c.parent, -5)), 3, 1)) AS d3,
+      unicode(substr(max(substr(c.parent, -5)), 4, 1)) AS d4,
+      unicode(substr(max(substr(c.parent, -5)), 5, 1)) AS d5
+    FROM post c
+    WHERE c.thread = post.thread
+      AND length(c.parent) = length(post.parent) + 5
+      AND substr(c.parent, 1, length(post.parent)) = post.parent)), 0);
+
+DROP INDEX post_thread_parent_idx;
+CREATE UNIQUE INDEX post_thread_parent_idx ON post (thread, parent);
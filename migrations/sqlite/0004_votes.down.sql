@@ -0,0 +1,2 @@
+DROP TABLE post_vote;
+DROP TABLE thread_vote;
@@ -0,0 +1,25 @@
+-- -----------------------------------------------------
+-- Votes of users on threads and posts
+--
+-- One row per user and target, vote is 1 or -1. likes, dislikes and
+-- points of the target count these rows plus the anonymous votes.
+-- -----------------------------------------------------
+
+CREATE TABLE thread_vote (
+  id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+  thread INTEGER NOT NULL REFERENCES thread (id),
+  user TEXT NOT NULL REFERENCES user (email),
+  vote INTEGER NOT NULL,
+  date TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE (thread, user)
+);
+
+
+CREATE TABLE post_vote (
+  id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+  post INTEGER NOT NULL REFERENCES post (id),
+  user TEXT NOT NULL REFERENCES user (email),
+  vote INTEGER NOT NULL,
+  date TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE (post, user)
+);
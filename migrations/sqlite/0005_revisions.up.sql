@@ -0,0 +1,28 @@
+-- -----------------------------------------------------
+-- Revisions of thread and post texts
+--
+-- A row per edit with the text from before it, who made it (NULL when the
+-- request didn't say) and when. The current text stays in thread and post.
+-- -----------------------------------------------------
+
+CREATE TABLE thread_revision (
+  id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+  thread INTEGER NOT NULL REFERENCES thread (id),
+  message TEXT NOT NULL,
+  slug TEXT NOT NULL,
+  editor TEXT NULL REFERENCES user (email),
+  date TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX thread_revision_thread_date_idx ON thread_revision (thread, date);
+
+
+CREATE TABLE post_revision (
+  id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+  post INTEGER NOT NULL REFERENCES post (id),
+  message TEXT NOT NULL,
+  editor TEXT NULL REFERENCES user (email),
+  date TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX post_revision_post_date_idx ON post_revision (post, date);
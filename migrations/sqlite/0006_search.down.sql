@@ -0,0 +1,11 @@
+DROP TRIGGER post_fts_delete;
+DROP TRIGGER post_fts_after_update;
+DROP TRIGGER post_fts_before_update;
+DROP TRIGGER post_fts_insert;
+DROP TABLE post_fts;
+
+DROP TRIGGER thread_fts_delete;
+DROP TRIGGER thread_fts_after_update;
+DROP TRIGGER thread_fts_before_update;
+DROP TRIGGER thread_fts_insert;
+DROP TABLE thread_fts;
@@ -0,0 +1,45 @@
+-- -----------------------------------------------------
+-- Full-text search of threads and posts
+--
+-- FTS4 tables over the texts of thread and post, docid is the id of the
+-- row. The triggers keep them in step with the writes.
+-- -----------------------------------------------------
+
+CREATE VIRTUAL TABLE thread_fts USING fts4 (content="thread", title, message, tokenize=unicode61);
+INSERT INTO thread_fts (thread_fts) VALUES ('rebuild');
+
+CREATE TRIGGER thread_fts_insert AFTER INSERT ON thread BEGIN
+  INSERT INTO thread_fts (docid, title, message) VALUES (new.id, new.title, new.message);
+END;
+
+CREATE TRIGGER thread_fts_before_update BEFORE UPDATE OF title, message ON thread BEGIN
+  DELETE FROM thread_fts WHERE docid = old.id;
+END;
+
+CREATE TRIGGER thread_fts_after_update AFTER UPDATE OF title, message ON thread BEGIN
+  INSERT INTO thread_fts (docid, title, message) VALUES (new.id, new.title, new.message);
+END;
+
+CREATE TRIGGER thread_fts_delete BEFORE DELETE ON thread BEGIN
+  DELETE FROM thread_fts WHERE docid = old.id;
+END;
+
+
+CREATE VIRTUAL TABLE post_fts USING fts4 (content="post", message, tokenize=unicode61);
+INSERT INTO post_fts (post_fts) VALUES ('rebuild');
+
+CREATE TRIGGER post_fts_insert AFTER INSERT ON post BEGIN
+  INSERT INTO post_fts (docid, message) VALUES (new.id, new.message);
+END;
+
+CREATE TRIGGER post_fts_before_update BEFORE UPDATE OF message ON post BEGIN
+  DELETE FROM post_fts WHERE docid = old.id;
+END;
+
+CREATE TRIGGER post_fts_after_update AFTER UPDATE OF message ON post BEGIN
+  INSERT INTO post_fts (docid, message) VALUES (new.id, new.message);
+END;
+
+CREATE TRIGGER post_fts_delete BEFORE DELETE ON post BEGIN
+  DELETE FROM post_fts WHERE docid = old.id;
+END;
@@ -0,0 +1,18 @@
+-- -----------------------------------------------------
+-- Notifications of subscribers
+--
+-- A row per subscriber of a thread and post created in it, the author of
+-- the post left out. Rows are read newest first per user, and counted
+-- unread.
+-- -----------------------------------------------------
+
+CREATE TABLE notification (
+  id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+  user TEXT NOT NULL REFERENCES user (email),
+  thread INTEGER NOT NULL REFERENCES thread (id),
+  post INTEGER NOT NULL REFERENCES post (id),
+  isRead INTEGER NOT NULL DEFAULT 0,
+  date TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX notification_user_read_idx ON notification (user, isRead);
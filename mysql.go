@@ -0,0 +1,853 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	rs "technopark-db/response"
+
+	mysql "github.com/go-sql-driver/mysql"
+)
+
+// =================
+// MySQL storage here
+// =================
+
+type MysqlStore struct {
+	db   querier
+	conn *sql.DB // nil inside a unit of work
+}
+
+func NewMysqlStore(db *sql.DB) *MysqlStore {
+	return &MysqlStore{db: timed(db), conn: db}
+}
+
+// Run fn on a store bound to one transaction, or on s when it already is
+func (s *MysqlStore) atomic(fn func(tx *MysqlStore) error) error {
+	if s.conn == nil {
+		return fn(s)
+	}
+	return runTx(s.conn, func(tx *sql.Tx) error { return fn(&MysqlStore{db: timed(tx)}) })
+}
+
+func (s *MysqlStore) Tx(fn func(tx Store) error) error {
+	return s.atomic(func(tx *MysqlStore) error { return fn(tx) })
+}
+
+// Map MySQL error numbers to storage errors
+func mysqlError(err error) error {
+	if driverErr, ok := err.(*mysql.MySQLError); ok { // Now the error number is accessible directly
+		switch driverErr.Number {
+		case 1062:
+			return fmt.Errorf("%w: %v", ErrDuplicate, err)
+
+		// Error 1452: Cannot add or update a child row: a foreign key constraint fails
+		case 1452:
+			return fmt.Errorf("%w: %v", ErrForeignKey, err)
+		}
+	}
+	return err
+}
+
+func (s *MysqlStore) exec(query string, args ...interface{}) (*ExecResponse, error) {
+	resp, err := execQuery(query, &args, s.db)
+	if err != nil {
+		return nil, mysqlError(err)
+	}
+	return resp, nil
+}
+
+// Post columns with the parent id resolved from the path of the parent post
+const (
+	mysqlPostFrom = " FROM post" +
+		" LEFT JOIN post pp ON LENGTH(post.parent) > 5 AND pp.parent = SUBSTRING(post.parent, 1, LENGTH(post.parent) - 5)"
+	mysqlPostSelect = "SELECT " + postColumns + ", pp.id" + mysqlPostFrom
+)
+
+// Append since clauses to query
+func sinceClauses(query string, args *[]interface{}, opts ListOptions, sinceId, since string) string {
+	if opts.SinceId != 0 {
+		query += fmt.Sprintf(" AND %s >= ?", sinceId)
+		*args = append(*args, opts.SinceId)
+	}
+	if opts.Since != "" {
+		query += fmt.Sprintf(" AND %s > ?", since)
+		*args = append(*args, opts.Since)
+	}
+
+	return query
+}
+
+func limitClause(limit int) string {
+	if limit < 0 {
+		return ""
+	}
+	return fmt.Sprintf(" LIMIT %d", limit)
+}
+
+// Append the clause that keeps the rows after opts.After in list order: by
+// key and id, with the key of that row read from table, or by id alone
+func afterClause(query string, args *[]interface{}, opts ListOptions, table, id, key string) string {
+	if opts.After == 0 {
+		return query
+	}
+
+	op := ">"
+	if opts.Order == "desc" {
+		op = "<"
+	}
+
+	if opts.Order == "" || key == id {
+		query += fmt.Sprintf(" AND %s %s ?", id, op)
+	} else {
+		query += fmt.Sprintf(" AND (%s, %s) %s (SELECT %s, %s FROM %s WHERE %s = ?)", key, id, op, key, id, table, id)
+	}
+	*args = append(*args, opts.After)
+
+	return query
+}
+
+// Append the clause that keeps the posts after the opts.After post in tree
+// order: roots in opts.Order, each subtree by path. after selects the path
+// of that post, root gives the root part of a path.
+func treeAfterClause(query string, args *[]interface{}, opts ListOptions, path, after string, root func(path string) string) string {
+	if opts.After == 0 {
+		return query
+	}
+
+	clause := path + " > " + after
+	if opts.Order == "desc" {
+		clause = fmt.Sprintf("(%s < %s OR %s = %s AND %s)", root(path), root(after), root(path), root(after), clause)
+	}
+
+	for i := strings.Count(clause, "?"); i > 0; i-- {
+		*args = append(*args, opts.After)
+	}
+	return query + " AND " + clause
+}
+
+// Append since, cursor, order and limit clauses to query. table is the
+// table of the rows as it is named in the columns, e.g. "user u" for u.id.
+func listClauses(query string, args *[]interface{}, opts ListOptions, table, id, since, key string) string {
+	query = sinceClauses(query, args, opts, id, since)
+	query = afterClause(query, args, opts, table, id, key)
+
+	if opts.Order != "" {
+		query += fmt.Sprintf(" ORDER BY %s %s, %s %s", key, opts.Order, id, opts.Order)
+	} else {
+		query += " ORDER BY " + id
+	}
+
+	return query + limitClause(opts.Limit)
+}
+
+// ======================
+// Users here
+// ======================
+
+func (s *MysqlStore) CreateUser(user *rs.UserDetails) error {
+	query := "INSERT INTO user (username, about, name, email, isAnonymous) VALUES(?, ?, ?, ?, ?)"
+
+	dbResp, err := s.exec(query, user.Username, user.About, user.Name, user.Email, user.IsAnonymous)
+	if err != nil {
+		return err
+	}
+
+	user.Id = dbResp.lastId
+	return nil
+}
+
+func (s *MysqlStore) GetUser(email string) (*rs.UserDetails, error) {
+	user, err := scanUser(s.db.QueryRow("SELECT "+userColumns+" FROM user WHERE email = ?", email))
+	return user, notFound(err)
+}
+
+func (s *MysqlStore) GetUsers(emails []string) ([]rs.UserDetails, error) {
+	if len(emails) == 0 {
+		return []rs.UserDetails{}, nil
+	}
+	return queryUsers(s.db, "SELECT "+userColumns+" FROM user WHERE email IN "+inList(len(emails)), stringArgs(emails)...)
+}
+
+func (s *MysqlStore) UpdateUser(email, about, name string) error {
+	_, err := s.exec("UPDATE user SET about = ?, name = ? WHERE email =  ?", about, name, email)
+	return err
+}
+
+func (s *MysqlStore) listUsers(query string, email string, opts ListOptions) ([]rs.UserDetails, error) {
+	args := []interface{}{email}
+	query = listClauses(query, &args, opts, "user", "user.id", "user.date", "user.date")
+
+	return queryUsers(s.db, query, args...)
+}
+
+func (s *MysqlStore) ListFollowers(email string, opts ListOptions) ([]rs.UserDetails, error) {
+	query := "SELECT " + userColumns + " FROM user JOIN follow ON user.email = follow.follower WHERE followee = ?"
+
+	return s.listUsers(query, email, opts)
+}
+
+func (s *MysqlStore) ListFollowing(email string, opts ListOptions) ([]rs.UserDetails, error) {
+	query := "SELECT " + userColumns + " FROM user JOIN follow ON user.email = follow.followee WHERE follower = ?"
+
+	return s.listUsers(query, email, opts)
+}
+
+// ======================
+// Follows here
+// ======================
+
+func (s *MysqlStore) Follow(follower, followee string) error {
+	_, err := s.exec("INSERT INTO follow (follower, followee) VALUES(?, ?)", follower, followee)
+	return err
+}
+
+func (s *MysqlStore) Unfollow(follower, followee string) error {
+	_, err := s.exec("DELETE FROM follow WHERE follower = ? AND followee = ?", follower, followee)
+	return err
+}
+
+func (s *MysqlStore) GetFollowers(email string) ([]string, error) {
+	return queryStrings(s.db, "SELECT follower FROM follow WHERE followee = ?", email)
+}
+
+func (s *MysqlStore) GetFollowing(email string) ([]string, error) {
+	return queryStrings(s.db, "SELECT followee FROM follow WHERE follower = ?", email)
+}
+
+func (s *MysqlStore) GetFollowersOf(emails []string) (map[string][]string, error) {
+	if len(emails) == 0 {
+		return map[string][]string{}, nil
+	}
+	query := "SELECT followee, follower FROM follow WHERE followee IN " + inList(len(emails)) + " ORDER BY follower"
+	return queryStringGroups(s.db, query, stringArgs(emails)...)
+}
+
+func (s *MysqlStore) GetFollowingOf(emails []string) (map[string][]string, error) {
+	if len(emails) == 0 {
+		return map[string][]string{}, nil
+	}
+	query := "SELECT follower, followee FROM follow WHERE follower IN " + inList(len(emails)) + " ORDER BY followee"
+	return queryStringGroups(s.db, query, stringArgs(emails)...)
+}
+
+// ======================
+// Forums here
+// ======================
+
+func (s *MysqlStore) CreateForum(forum *rs.ForumCreate) error {
+	query := "INSERT INTO forum (name, short_name, user) VALUES(?, ?, ?)"
+
+	dbResp, err := s.exec(query, forum.Name, forum.Short_Name, forum.User)
+	if err != nil {
+		return err
+	}
+
+	forum.Id = dbResp.lastId
+	return nil
+}
+
+func (s *MysqlStore) GetForum(shortName string) (*rs.ForumDetails, error) {
+	forum, err := scanForum(s.db.QueryRow("SELECT "+forumColumns+" FROM forum WHERE short_name = ?", shortName))
+	return forum, notFound(err)
+}
+
+func (s *MysqlStore) GetForums(shortNames []string) ([]rs.ForumDetails, error) {
+	if len(shortNames) == 0 {
+		return []rs.ForumDetails{}, nil
+	}
+	return queryForums(s.db, "SELECT "+forumColumns+" FROM forum WHERE short_name IN "+inList(len(shortNames)), stringArgs(shortNames)...)
+}
+
+func (s *MysqlStore) ListForumUsers(forum string, opts ListOptions) ([]string, error) {
+	query := "SELECT u.email FROM user u WHERE email IN (SELECT DISTINCT p.user FROM post p WHERE p.forum = ?)"
+	args := []interface{}{forum}
+	query = listClauses(query, &args, opts, "user u", "u.id", "u.date", "COALESCE(u.name, '')")
+
+	return queryStrings(s.db, query, args...)
+}
+
+// ======================
+// Threads here
+// ======================
+
+func (s *MysqlStore) CreateThread(thread *rs.ThreadCreate) error {
+	query := "INSERT INTO thread (forum, title, isClosed, user, date, message, slug, isDeleted) VALUES(?, ?, ?, ?, ?, ?, ?, ?)"
+
+	dbResp, err := s.exec(query, thread.Forum, thread.Title, thread.IsClosed, thread.User, thread.Date, thread.Message, thread.Slug, thread.IsDeleted)
+	if err != nil {
+		return err
+	}
+
+	thread.Id = dbResp.lastId
+	return nil
+}
+
+func (s *MysqlStore) GetThread(id int64) (*rs.ThreadDetails, error) {
+	thread, err := scanThread(s.db.QueryRow("SELECT "+threadColumns+" FROM thread WHERE id = ?", id))
+	return thread, notFound(err)
+}
+
+func (s *MysqlStore) GetThreads(ids []int64) ([]rs.ThreadDetails, error) {
+	if len(ids) == 0 {
+		return []rs.ThreadDetails{}, nil
+	}
+	return queryThreads(s.db, "SELECT "+threadColumns+" FROM thread WHERE id IN "+inList(len(ids)), int64Args(ids)...)
+}
+
+func (s *MysqlStore) ListThreads(field, value string, opts ListOptions) ([]rs.ThreadDetails, error) {
+	if field != "user" && field != "forum" {
+		return nil, fmt.Errorf("can't list threads by %q", field)
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM thread WHERE thread.%s = ?", threadColumns, field)
+	args := []interface{}{value}
+	query = listClauses(query, &args, opts, "thread", "thread.id", "thread.date", "thread.date")
+
+	return queryThreads(s.db, query, args...)
+}
+
+func (s *MysqlStore) UpdateThread(id int64, message, slug string, editor *string) error {
+	return s.atomic(func(tx *MysqlStore) error {
+		var oldMessage, oldSlug string
+		err := tx.db.QueryRow("SELECT message, slug FROM thread WHERE id = ? FOR UPDATE", id).Scan(&oldMessage, &oldSlug)
+		if err == sql.ErrNoRows || err == nil && oldMessage == message && oldSlug == slug {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.exec("INSERT INTO thread_revision (thread, message, slug, editor) VALUES(?, ?, ?, ?)", id, oldMessage, oldSlug, editor)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.exec("UPDATE thread SET message = ?, slug = ? WHERE id = ?", message, slug, id)
+		return err
+	})
+}
+
+func (s *MysqlStore) VoteThread(id int64, vote int) error {
+	var query string
+
+	if vote > 0 {
+		query = "UPDATE thread SET likes = likes + 1, points = points + 1 WHERE id = ?"
+	} else {
+		query = "UPDATE thread SET dislikes = dislikes + 1, points = points - 1 WHERE id = ?"
+	}
+
+	_, err := s.exec(query, id)
+	return err
+}
+
+func (s *MysqlStore) SetThreadClosed(id int64, closed bool) (bool, error) {
+	dbResp, err := s.exec("UPDATE thread SET isClosed = ? WHERE id = ?", closed, id)
+	if err != nil {
+		return false, err
+	}
+	return dbResp.rowCount != 0, nil
+}
+
+func (s *MysqlStore) RemoveThread(id int64) (bool, error) {
+	var changed bool
+
+	err := s.atomic(func(tx *MysqlStore) error {
+		dbResp, err := tx.exec("UPDATE thread SET isDeleted = ?, posts = 0 WHERE id = ?", true, id)
+		if err != nil {
+			return err
+		}
+		changed = dbResp.rowCount != 0
+
+		_, err = tx.exec("UPDATE post SET isDeleted = ? WHERE thread = ?", true, id)
+		return err
+	})
+
+	return changed, err
+}
+
+func (s *MysqlStore) RestoreThread(id int64) (bool, error) {
+	var changed bool
+
+	err := s.atomic(func(tx *MysqlStore) error {
+		_, err := tx.exec("UPDATE post SET isDeleted = ? WHERE thread = ?", false, id)
+		if err != nil {
+			return err
+		}
+
+		query := "UPDATE thread t SET t.isDeleted = ?, t.posts = (SELECT COUNT(*) FROM post p WHERE p.thread = t.id AND p.isDeleted = false) WHERE t.id = ?"
+		dbResp, err := tx.exec(query, false, id)
+		if err != nil {
+			return err
+		}
+		changed = dbResp.rowCount != 0
+
+		return nil
+	})
+
+	return changed, err
+}
+
+func (s *MysqlStore) UpdateThreadPosts(id int64, delta int) error {
+	_, err := s.exec("UPDATE thread SET posts = posts + ? WHERE id = ?", delta, id)
+	return err
+}
+
+// ======================
+// Subscriptions here
+// ======================
+
+func (s *MysqlStore) Subscribe(thread int64, user string) error {
+	_, err := s.exec("INSERT INTO subscribe (thread, user) VALUES(?, ?)", thread, user)
+	return err
+}
+
+func (s *MysqlStore) Unsubscribe(thread int64, user string) (bool, error) {
+	dbResp, err := s.exec("DELETE FROM subscribe WHERE thread = ? AND user = ?", thread, user)
+	if err != nil {
+		return false, err
+	}
+	return dbResp.rowCount != 0, nil
+}
+
+func (s *MysqlStore) GetSubscriptions(email string) ([]int, error) {
+	return queryInts(s.db, "SELECT thread FROM subscribe WHERE user = ? ORDER BY thread asc", email)
+}
+
+func (s *MysqlStore) GetSubscriptionsOf(emails []string) (map[string][]int, error) {
+	if len(emails) == 0 {
+		return map[string][]int{}, nil
+	}
+	query := "SELECT user, thread FROM subscribe WHERE user IN " + inList(len(emails)) + " ORDER BY thread asc"
+	return queryIntGroups(s.db, query, stringArgs(emails)...)
+}
+
+// ======================
+// Posts here
+// ======================
+
+// Materialized path of a new child of parent: parent path + next base92
+// segment. Bumping the child counter locks the parent row, concurrent
+// replies to one parent wait here until the unit holding it commits.
+func (s *MysqlStore) childPath(parent int64) (string, error) {
+	_, err := s.exec("UPDATE post SET children = children + 1 WHERE id = ?", parent)
+	if err != nil {
+		return "", err
+	}
+
+	var parentPath string
+	var children int
+
+	err = s.db.QueryRow("SELECT parent, children FROM post WHERE id = ?", parent).Scan(&parentPath, &children)
+	if err != nil {
+		return "", notFound(err)
+	}
+
+	return parentPath + toBase92(children), nil
+}
+
+// Insert and path update are one unit, a post never keeps a NULL path
+func (s *MysqlStore) CreatePost(post *rs.PostCreate, parent *int64) error {
+	return s.atomic(func(tx *MysqlStore) error {
+		var path interface{}
+
+		if parent != nil {
+			child, err := tx.childPath(*parent)
+			if err != nil {
+				return err
+			}
+			path = child
+		}
+
+		query := "INSERT INTO post (thread, message, user, forum, date, isApproved, isHighlighted, isEdited, isSpam, isDeleted, parent) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+
+		dbResp, err := tx.exec(query, int64(post.Thread), post.Message, post.User, post.Forum, post.Date,
+			post.IsApproved, post.IsHighlighted, post.IsEdited, post.IsSpam, post.IsDeleted, path)
+		if err != nil {
+			return err
+		}
+
+		post.Id = dbResp.lastId
+
+		// root posts start their own path
+		if parent == nil {
+			_, err = tx.exec("UPDATE post SET parent = ? WHERE id = ?", toBase92(int(post.Id)), post.Id)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s *MysqlStore) GetPost(id int64) (*rs.PostDetails, error) {
+	var parent sql.NullInt64
+
+	post, err := scanPost(s.db.QueryRow(mysqlPostSelect+" WHERE post.id = ?", id), &parent)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	post.Parent = nullInt64(parent)
+	return post, nil
+}
+
+func (s *MysqlStore) ListPosts(field, value string, opts ListOptions) ([]rs.PostDetails, error) {
+	if field != "thread" && field != "user" && field != "forum" {
+		return nil, fmt.Errorf("can't list posts by %q", field)
+	}
+
+	query := fmt.Sprintf("%s WHERE post.%s = ?", mysqlPostSelect, field)
+	args := []interface{}{value}
+	query = listClauses(query, &args, opts, "post", "post.id", "post.date", "post.date")
+
+	return queryPosts(s.db, query, args...)
+}
+
+func mysqlRoot(path string) string { return "SUBSTRING(" + path + ", 1, 5)" }
+
+func (s *MysqlStore) ListPostsTree(thread int64, opts ListOptions) ([]rs.PostDetails, error) {
+	query := mysqlPostSelect + " WHERE post.thread = ?"
+	args := []interface{}{thread}
+
+	// roots in requested order, children by path
+	query = sinceClauses(query, &args, opts, "post.id", "post.date")
+	query = treeAfterClause(query, &args, opts, "post.parent", "(SELECT a.parent FROM post a WHERE a.id = ?)", mysqlRoot)
+	query += " ORDER BY SUBSTRING(post.parent, 1, 5) " + opts.Order + ", post.parent asc"
+	query += limitClause(opts.Limit)
+
+	return queryPosts(s.db, query, args...)
+}
+
+func (s *MysqlStore) ListPostsParentTree(thread int64, opts ListOptions) ([]rs.PostDetails, error) {
+	// limit and cursor apply to root posts, the page of roots is joined
+	// to its subtrees in one query (MySQL has no LIMIT in IN subqueries)
+	roots := "SELECT parent FROM post WHERE thread = ? AND LENGTH(parent) = 5"
+	args := []interface{}{thread}
+	roots = sinceClauses(roots, &args, opts, "id", "date")
+	roots = afterClause(roots, &args, opts, "post", "id", "parent")
+	roots += " ORDER BY parent " + opts.Order
+	roots += limitClause(opts.Limit)
+
+	query := mysqlPostSelect + " JOIN (" + roots + ") r ON SUBSTRING(post.parent, 1, 5) = r.parent" +
+		" WHERE post.thread = ?" +
+		" ORDER BY SUBSTRING(post.parent, 1, 5) " + opts.Order + ", post.parent asc"
+	args = append(args, thread)
+
+	return queryPosts(s.db, query, args...)
+}
+
+func (s *MysqlStore) UpdatePost(id int64, message string, editor *string) error {
+	return s.atomic(func(tx *MysqlStore) error {
+		var oldMessage string
+		err := tx.db.QueryRow("SELECT message FROM post WHERE id = ? FOR UPDATE", id).Scan(&oldMessage)
+		if err == sql.ErrNoRows || err == nil && oldMessage == message {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.exec("INSERT INTO post_revision (post, message, editor) VALUES(?, ?, ?)", id, oldMessage, editor)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.exec("UPDATE post SET message = ?, isEdited = true WHERE id = ?", message, id)
+		return err
+	})
+}
+
+func (s *MysqlStore) VotePost(id int64, vote int) error {
+	var query string
+
+	if vote > 0 {
+		query = "UPDATE post SET likes = likes + 1, points = points + 1 WHERE id = ?"
+	} else {
+		query = "UPDATE post SET dislikes = dislikes + 1, points = points - 1 WHERE id = ?"
+	}
+
+	_, err := s.exec(query, id)
+	return err
+}
+
+func (s *MysqlStore) SetPostDeleted(id int64, deleted bool) (bool, error) {
+	dbResp, err := s.exec("UPDATE post SET isDeleted = ? WHERE id = ?", deleted, id)
+	if err != nil {
+		return false, err
+	}
+	return dbResp.rowCount != 0, nil
+}
+
+// ======================
+// Votes here
+// ======================
+
+// The target row stays locked until the counters have moved, so votes of
+// one user can't race on the old vote
+func (s *MysqlStore) SetVote(target string, id int64, user string, vote int) error {
+	table, err := voteTable(target)
+	if err != nil {
+		return err
+	}
+
+	return s.atomic(func(tx *MysqlStore) error {
+		err := tx.db.QueryRow(fmt.Sprintf("SELECT id FROM %s WHERE id = ? FOR UPDATE", target), id).Scan(new(int64))
+		if err != nil {
+			return notFound(err)
+		}
+
+		var old int
+		err = tx.db.QueryRow(fmt.Sprintf("SELECT vote FROM %s WHERE %s = ? AND user = ?", table, target), id, user).Scan(&old)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+
+		switch {
+		case vote == old:
+			return nil
+		case vote == 0:
+			_, err = tx.exec(fmt.Sprintf("DELETE FROM %s WHERE %s = ? AND user = ?", table, target), id, user)
+		case old == 0:
+			_, err = tx.exec(fmt.Sprintf("INSERT INTO %s (%s, user, vote) VALUES(?, ?, ?)", table, target), id, user, vote)
+		default:
+			_, err = tx.exec(fmt.Sprintf("UPDATE %s SET vote = ?, date = CURRENT_TIMESTAMP WHERE %s = ? AND user = ?", table, target), vote, id, user)
+		}
+		if err != nil {
+			return err
+		}
+
+		likes, dislikes, points := voteDelta(old, vote)
+		_, err = tx.exec(fmt.Sprintf("UPDATE %s SET likes = likes + ?, dislikes = dislikes + ?, points = points + ? WHERE id = ?", target),
+			likes, dislikes, points, id)
+		return err
+	})
+}
+
+func (s *MysqlStore) ListVotes(target string, id int64, opts ListOptions) ([]rs.VoteDetails, error) {
+	table, err := voteTable(target)
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf("SELECT v.id, v.user, v.vote, v.date FROM %s v WHERE v.%s = ?", table, target)
+	args := []interface{}{id}
+	query = listClauses(query, &args, opts, table+" v", "v.id", "v.date", "v.date")
+
+	return queryVotes(s.db, query, args...)
+}
+
+// ======================
+// Revisions here
+// ======================
+
+func (s *MysqlStore) ListRevisions(target string, id int64, opts ListOptions) ([]rs.Revision, error) {
+	table, columns, err := revisionTable(target)
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf("SELECT %s, r.date FROM %s r WHERE r.%s = ?", columns, table, target)
+	args := []interface{}{id}
+	query = listClauses(query, &args, opts, table+" r", "r.id", "r.date", "r.date")
+
+	return queryRevisions(s.db, query, args...)
+}
+
+func (s *MysqlStore) GetRevision(target string, id, revision int64) (*rs.Revision, error) {
+	table, columns, err := revisionTable(target)
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf("SELECT %s, r.date FROM %s r WHERE r.id = ? AND r.%s = ?", columns, table, target)
+	result, err := scanRevision(s.db.QueryRow(query, revision, id))
+	return result, notFound(err)
+}
+
+// ======================
+// Feed here
+// ======================
+
+func (s *MysqlStore) ListFeed(email string, opts ListOptions) ([]rs.FeedItem, error) {
+	var afterDate string
+	if opts.After != 0 {
+		table, id := feedRow(opts.After)
+		err := s.db.QueryRow("SELECT date FROM "+table+" WHERE id = ?", id).Scan(&afterDate)
+		if err == sql.ErrNoRows {
+			return []rs.FeedItem{}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var args []interface{}
+	keys, err := queryInt64s(s.db, feedQuery(&args, email, opts, afterDate, "user"), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return feedItems(keys, s.GetThreads, func(ids []int64) ([]rs.PostDetails, error) {
+		return queryPosts(s.db, mysqlPostSelect+" WHERE post.id IN "+inList(len(ids)), int64Args(ids)...)
+	})
+}
+
+// ======================
+// Notifications here
+// ======================
+
+func (s *MysqlStore) MarkNotify(post int64) error {
+	_, err := s.exec("INSERT INTO notify_pending (post) VALUES (?)", post)
+	return err
+}
+
+func (s *MysqlStore) PendingNotify(after int64, limit int) ([]int64, error) {
+	return queryInt64s(s.db, "SELECT post FROM notify_pending WHERE post > ? ORDER BY post LIMIT ?", after, limit)
+}
+
+func (s *MysqlStore) NotifySubscribers(post int64) (int64, error) {
+	var count int64
+	err := s.atomic(func(tx *MysqlStore) error {
+		// whoever deletes the mark notifies
+		dbResp, err := tx.exec("DELETE FROM notify_pending WHERE post = ?", post)
+		if err != nil || dbResp.rowCount == 0 {
+			return err
+		}
+
+		dbResp, err = tx.exec("INSERT INTO notification (user, thread, post)"+
+			" SELECT subscribe.user, post.thread, post.id FROM post"+
+			" JOIN subscribe ON subscribe.thread = post.thread"+
+			" WHERE post.id = ? AND subscribe.user <> post.user", post)
+		if err != nil {
+			return err
+		}
+		count = dbResp.rowCount
+		return nil
+	})
+	return count, err
+}
+
+func (s *MysqlStore) ListNotifications(email string, unread bool, opts ListOptions) ([]rs.Notification, error) {
+	query := "SELECT n.id, n.thread, n.post, post.user, n.isRead, n.date FROM notification n" +
+		" JOIN post ON post.id = n.post WHERE n.user = ?"
+	if unread {
+		query += " AND NOT n.isRead"
+	}
+	args := []interface{}{email}
+	query = listClauses(query, &args, opts, "notification n", "n.id", "n.date", "n.id")
+
+	return queryNotifications(s.db, query, args...)
+}
+
+func (s *MysqlStore) CountUnread(email string) (int64, error) {
+	return queryCount(s.db, "SELECT COUNT(*) FROM notification WHERE user = ? AND NOT isRead", email)
+}
+
+func (s *MysqlStore) MarkRead(email string, ids []int64) (int64, error) {
+	query := "UPDATE notification SET isRead = 1 WHERE user = ? AND NOT isRead"
+	args := []interface{}{email}
+	if ids != nil {
+		if len(ids) == 0 {
+			return 0, nil
+		}
+		query += " AND id IN " + inList(len(ids))
+		args = append(args, int64Args(ids)...)
+	}
+
+	dbResp, err := s.exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return dbResp.rowCount, nil
+}
+
+// ======================
+// Search here
+// ======================
+
+// Boolean mode query that wants all terms
+func mysqlAgainst(terms []string) string {
+	return "+" + strings.Join(terms, " +")
+}
+
+func (s *MysqlStore) SearchThreads(opts SearchOptions) ([]rs.ThreadHit, error) {
+	against := mysqlAgainst(opts.Terms)
+	score := "MATCH(thread.title, thread.message) AGAINST(? IN BOOLEAN MODE)"
+
+	query := "SELECT " + threadColumns + ", " + score + " AS score FROM thread" +
+		" WHERE " + score + " AND NOT thread.isDeleted"
+	args := []interface{}{against, against}
+	query = searchClauses(query, &args, opts, "thread.forum", "thread.user", "thread.date")
+
+	if opts.After != 0 {
+		query += " AND (" + score + ", thread.id) < (SELECT " + score + ", thread.id FROM thread WHERE thread.id = ?)"
+		args = append(args, against, against, opts.After)
+	}
+
+	query += " ORDER BY score DESC, thread.id DESC" + limitClause(opts.Limit)
+	return queryThreadHits(s.db, query, args...)
+}
+
+func (s *MysqlStore) SearchPosts(opts SearchOptions) ([]rs.PostHit, error) {
+	against := mysqlAgainst(opts.Terms)
+	score := "MATCH(post.message) AGAINST(? IN BOOLEAN MODE)"
+
+	query := "SELECT " + postColumns + ", pp.id, " + score + " AS score" + mysqlPostFrom +
+		" WHERE " + score + " AND NOT post.isDeleted AND NOT post.isSpam"
+	args := []interface{}{against, against}
+	query = searchClauses(query, &args, opts, "post.forum", "post.user", "post.date")
+
+	if opts.After != 0 {
+		query += " AND (" + score + ", post.id) < (SELECT " + score + ", post.id FROM post WHERE post.id = ?)"
+		args = append(args, against, against, opts.After)
+	}
+
+	query += " ORDER BY score DESC, post.id DESC" + limitClause(opts.Limit)
+	return queryPostHits(s.db, query, args...)
+}
+
+// ======================
+// Information here
+// ======================
+
+func (s *MysqlStore) Status() (*rs.StatusHandler, error) {
+	status := &rs.StatusHandler{}
+
+	counts := map[string]*int64{"user": &status.User, "thread": &status.Thread, "forum": &status.Forum, "post": &status.Post}
+	for table, count := range counts {
+		var err error
+		if *count, err = queryCount(s.db, "SELECT COUNT(*) FROM "+table); err != nil {
+			return nil, err
+		}
+	}
+
+	return status, nil
+}
+
+func (s *MysqlStore) Clear() error {
+	queries := []string{
+		"DELETE FROM follow",
+		"DELETE FROM subscribe",
+		"DELETE FROM notify_pending WHERE post > 0",
+		"DELETE FROM notification WHERE id > 0",
+		"DELETE FROM post_revision WHERE id > 0",
+		"DELETE FROM thread_revision WHERE id > 0",
+		"DELETE FROM post_vote WHERE id > 0",
+		"DELETE FROM thread_vote WHERE id > 0",
+		"DELETE FROM post WHERE id > 0",
+		"DELETE FROM thread WHERE id > 0",
+		"DELETE FROM forum WHERE id > 0",
+		"DELETE FROM user WHERE id > 0",
+	}
+
+	for _, query := range queries {
+		if _, err := s.exec(query); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	rs "technopark-db/response"
+)
+
+// =================
+// Notifications here
+// =================
+
+// notifier writes the notifications of new posts off the request path:
+// post/create marks the post pending along with it (see MarkNotify), queues
+// it and answers, workers give its subscribers their rows and take the
+// mark. A post that finds the queue full is deferred, not dropped: it stays
+// marked, as does one a restart cut off, and a sweep queues the pending
+// posts once the queue has drained. Posting never waits for the
+// subscribers of a thread, a deferred post only comes late.
+type notifier struct {
+	mu    sync.RWMutex
+	queue chan int64    // nil when stopped or never started
+	quit  chan struct{} // closed on stop, ends the sweep
+	swept sync.WaitGroup
+	done  sync.WaitGroup
+}
+
+// How often pending posts are looked for, when the queue is empty
+const notifySweepPeriod = 10 * time.Second
+
+// post/create queues here, main starts and stops the workers
+var notifications = &notifier{}
+
+// Start workers that notify through store, size posts may wait for them
+func (n *notifier) start(store Store, size, workers int) {
+	if workers == 0 {
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.queue = make(chan int64, size)
+	n.quit = make(chan struct{})
+	for i := 0; i < workers; i++ {
+		n.done.Add(1)
+		go n.work(store, n.queue)
+	}
+
+	n.swept.Add(1)
+	go n.sweep(store, n.queue, n.quit)
+}
+
+func (n *notifier) work(store Store, queue chan int64) {
+	defer n.done.Done()
+
+	for post := range queue {
+		count, err := store.NotifySubscribers(post)
+		if err != nil {
+			slog.Error("can't notify subscribers", "post", post, "error", err)
+			notifyPosts.WithLabelValues("failed").Inc()
+			continue
+		}
+
+		slog.Debug("subscribers notified", "post", post, "notifications", count)
+		notifyPosts.WithLabelValues("notified").Inc()
+		notificationsTotal.Add(float64(count))
+	}
+}
+
+// Queue the pending posts at start and every notifySweepPeriod after. The
+// queue has to be empty, a post still in it is pending too; one a worker
+// has taken may come again, NotifySubscribers skips it then.
+func (n *notifier) sweep(store Store, queue chan int64, quit chan struct{}) {
+	defer n.swept.Done()
+
+	ticker := time.NewTicker(notifySweepPeriod)
+	defer ticker.Stop()
+
+	for {
+		if len(queue) == 0 && !n.queuePending(store, queue, quit) {
+			return
+		}
+
+		select {
+		case <-ticker.C:
+		case <-quit:
+			return
+		}
+	}
+}
+
+// Queue all pending posts, a page of the queue size at a time. false when
+// the notifier stops meanwhile.
+func (n *notifier) queuePending(store Store, queue chan int64, quit chan struct{}) bool {
+	var after int64
+	queued := 0
+	defer func() {
+		if queued > 0 {
+			slog.Info("pending posts queued", "posts", queued)
+		}
+	}()
+
+	for {
+		posts, err := store.PendingNotify(after, cap(queue))
+		if err != nil {
+			slog.Error("can't list pending posts", "error", err)
+			return true
+		}
+
+		for _, post := range posts {
+			select {
+			case queue <- post:
+				queued++
+				after = post
+			case <-quit:
+				return false
+			}
+		}
+
+		if len(posts) < cap(queue) {
+			return true
+		}
+	}
+}
+
+// Whether posts are to be marked for notifications
+func (n *notifier) running() bool {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	return n.queue != nil
+}
+
+// Queue post to notify its subscribers. false when it is deferred to the
+// sweep, the queue being full or the notifier stopped.
+func (n *notifier) enqueue(post int64) bool {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	if n.queue == nil {
+		return false
+	}
+
+	select {
+	case n.queue <- post:
+		return true
+	default:
+		slog.Warn("notify queue full, post deferred", "post", post)
+		notifyPosts.WithLabelValues("deferred").Inc()
+		return false
+	}
+}
+
+// Stop taking posts and wait for the workers to notify the queued ones.
+// Posts still pending are notified after the next start.
+func (n *notifier) stop() {
+	n.mu.Lock()
+	if n.quit != nil {
+		close(n.quit)
+		n.quit = nil
+	}
+	n.mu.Unlock()
+
+	// the sweep sends to the queue, it is closed after
+	n.swept.Wait()
+
+	n.mu.Lock()
+	if n.queue != nil {
+		close(n.queue)
+		n.queue = nil
+	}
+	n.mu.Unlock()
+
+	n.done.Wait()
+}
+
+func (n *notifier) queued() int {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	return len(n.queue)
+}
+
+// ======================
+// Handlers here
+// ======================
+
+func (u *User) notifications() string {
+	// Validate query values
+	if len(u.inputRequest.query["user"]) != 1 {
+		return createInvalidResponse()
+	}
+	email := u.inputRequest.query["user"][0]
+
+	var unread bool
+	if len(u.inputRequest.query["unread"]) >= 1 {
+		var err error
+		if unread, err = strconv.ParseBool(u.inputRequest.query["unread"][0]); err != nil {
+			return createInvalidResponse()
+		}
+	}
+
+	// Optional params, newest first unless asked
+	opts, ok := u.inputRequest.listOptions("desc", "since")
+	if !ok {
+		return createInvalidResponse()
+	}
+	page := newPager(&opts)
+
+	if _, err := u.store.GetUser(email); err != nil {
+		return createErrorResponse(u.inputRequest, err)
+	}
+
+	list, err := u.store.ListNotifications(email, unread, opts)
+	if err != nil {
+		return createErrorResponse(u.inputRequest, err)
+	}
+
+	list = list[:page.cut(len(list), func(i int) int64 { return list[i].Id })]
+
+	count, err := u.store.CountUnread(email)
+	if err != nil {
+		return createErrorResponse(u.inputRequest, err)
+	}
+
+	return page.objectResponse(0, &rs.Notifications{Unread: count, Notifications: list})
+}
+
+// Mark the notifications in the optional list read, all of them without one
+func (u *User) markRead() string {
+	if !validateJson(u.inputRequest, "user") {
+		return createInvalidJsonResponse(u.inputRequest)
+	}
+	email, ok := u.inputRequest.json["user"].(string)
+	if !ok {
+		return createInvalidJsonResponse(u.inputRequest)
+	}
+
+	var ids []int64
+	if u.inputRequest.json["notifications"] != nil {
+		list, ok := u.inputRequest.json["notifications"].([]interface{})
+		if !ok {
+			return createInvalidJsonResponse(u.inputRequest)
+		}
+
+		ids = make([]int64, 0, len(list))
+		for _, value := range list {
+			if !checkFloat64Type(value) {
+				return createInvalidJsonResponse(u.inputRequest)
+			}
+			ids = append(ids, int64(value.(float64)))
+		}
+	}
+
+	if _, err := u.store.GetUser(email); err != nil {
+		return createErrorResponse(u.inputRequest, err)
+	}
+
+	marked, err := u.store.MarkRead(email, ids)
+	if err != nil {
+		return createErrorResponse(u.inputRequest, err)
+	}
+
+	count, err := u.store.CountUnread(email)
+	if err != nil {
+		return createErrorResponse(u.inputRequest, err)
+	}
+
+	return createResponse(0, &rs.NotificationsRead{User: email, Marked: marked, Unread: count})
+}
@@ -1,11 +1,8 @@
 package main
 
 import (
-	"database/sql"
-	"fmt"
 	"io"
 	"net/http"
-	"strconv"
 
 	rs "technopark-db/response"
 )
@@ -15,175 +12,121 @@ import (
 // =================
 type Post struct {
 	inputRequest *InputRequest
-	db           *sql.DB
+	store        Store
 }
 
-func (p *Post) threadCounter(operation string, thread string, isDeleted bool) {
-	var query string
-	args := Args{}
-	args.append(thread)
+func (p *Post) threadCounter(operation string, thread int64, isDeleted bool) error {
+	var delta int
 
 	switch operation {
 	case "create":
 		if isDeleted == false {
-			query = "UPDATE thread SET posts = posts + 1 WHERE id = ?"
+			delta = 1
 		}
 	case "remove":
-		query = "UPDATE thread SET posts = posts - 1 WHERE id = ?"
+		delta = -1
 	case "restore":
-		query = "UPDATE thread SET posts = posts + 1 WHERE id = ?"
+		delta = 1
+	}
 
+	if delta == 0 {
+		return nil
 	}
-	_, _ = execQuery(query, &args.data, p.db)
+
+	return p.store.UpdateThreadPosts(thread, delta)
 }
 
 func (p *Post) create() string {
 	args := Args{}
 
-	query := "INSERT INTO post (thread, message, user, forum, date, isApproved, isHighlighted, isEdited, isSpam, isDeleted, parent) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
-
 	if !validateJson(p.inputRequest, "thread", "message", "user", "forum", "date") {
 		return createInvalidJsonResponse(p.inputRequest)
 	}
 
-	args.generateFromJson(&p.inputRequest.json, "thread", "message", "user", "forum", "date")
+	if !checkStringParams(p.inputRequest.json, "message", "user", "forum", "date") {
+		return createInvalidJsonResponse(p.inputRequest)
+	}
+
+	if !checkFloat64Type(p.inputRequest.json["thread"]) {
+		return createInvalidJsonResponse(p.inputRequest)
+	}
 
 	if !validateBoolParams(p.inputRequest.json, &args, "isApproved", "isHighlighted", "isEdited", "isSpam", "isDeleted") {
 		return createInvalidJsonResponse(p.inputRequest)
 	}
-	var boolParent bool
 
 	// parent here
+	var parent *int64
 	if p.inputRequest.json["parent"] != nil {
 		if checkFloat64Type(p.inputRequest.json["parent"]) == false {
 			return createInvalidResponse()
 		}
 
-		// find parent and last child
-		parent := p.inputRequest.json["parent"].(float64)
-
-		fmt.Println("Need parent:\t", parent)
-
-		parentQuery := "SELECT id, parent FROM post WHERE id = ?"
-
-		parentArgs := Args{}
-		parentArgs.append(parent)
-
-		getThread := selectQuery(parentQuery, &parentArgs.data, p.db)
-
-		// check query
-		if getThread.rows == 0 {
-			return createNotExistResponse()
-		}
-
-		parentArgs.clear()
-
-		// search place for child
-		var child string
-		getParent := getThread.values[0]["parent"]
-
-		parentQuery = "SELECT parent FROM post WHERE parent LIKE ? ORDER BY parent desc LIMIT 1"
-		parentArgs.append(getParent + "%")
-
-		getThread = selectQuery(parentQuery, &parentArgs.data, p.db)
-
-		if getThread.values[0]["parent"] == getParent {
-			newParent := getParent
-			newChild := toBase92(1)
-
-			child = newParent + newChild
-		} else {
-			lastChild := getThread.values[0]["parent"]
-			newParent := getParent
-			oldChild := fromBase92(lastChild[len(lastChild)-5:])
-
-			oldChild++
-
-			newChild := toBase92(oldChild)
-
-			child = newParent + newChild
-		}
-
-		args.append(child)
-		boolParent = false
-	} else {
-		args.append(nil)
-		boolParent = true
-	}
-
-	dbResp, err := execQuery(query, &args.data, p.db)
-	if err != nil {
-		return createErrorResponse(err)
-	}
-
-	fmt.Println("Create post with id:\t", dbResp.lastId)
-
-	// maybe goroutine?
-	if boolParent {
-		boolParentQuery := "UPDATE post SET parent = ? WHERE id = ?"
-		boolParentArgs := Args{}
-
-		parent := toBase92(int(dbResp.lastId))
-		boolParentArgs.append(parent)
-		boolParentArgs.append(dbResp.lastId)
-
-		_, _ = execQuery(boolParentQuery, &boolParentArgs.data, p.db)
+		parentId := int64(p.inputRequest.json["parent"].(float64))
+		parent = &parentId
 	}
 
-	// thread + isDeleted
-	isDeleted := p.inputRequest.json["isDeleted"].(bool)
-	thread := floatToString(p.inputRequest.json["thread"].(float64))
-	p.threadCounter("create", thread, isDeleted)
-
-	tempCounter := 6
 	responseCode := 0
 	responseMsg := &rs.PostCreate{
 		Date:          p.inputRequest.json["date"].(string),
 		Forum:         p.inputRequest.json["forum"].(string),
-		Id:            dbResp.lastId,
-		IsApproved:    args.data[tempCounter].(bool),
-		IsHighlighted: args.data[tempCounter+0].(bool),
-		IsEdited:      args.data[tempCounter+1].(bool),
-		IsSpam:        args.data[tempCounter+2].(bool),
-		IsDeleted:     args.data[tempCounter+3].(bool),
+		IsApproved:    args.data[0].(bool),
+		IsHighlighted: args.data[1].(bool),
+		IsEdited:      args.data[2].(bool),
+		IsSpam:        args.data[3].(bool),
+		IsDeleted:     args.data[4].(bool),
 		Message:       p.inputRequest.json["message"].(string),
 		Parent:        nil,
 		Thread:        p.inputRequest.json["thread"].(float64),
 		User:          p.inputRequest.json["user"].(string),
 	}
 
-	if !boolParent {
-		tempParent := floatToString(p.inputRequest.json["parent"].(float64))
-		responseMsg.Parent = &tempParent
-	}
-
-	return createResponse(responseCode, responseMsg)
-}
+	// post, thread counter and notify mark in one unit
+	notify := !responseMsg.IsDeleted && notifications.running()
+	err := p.store.Tx(func(tx Store) error {
+		if err := tx.CreatePost(responseMsg, parent); err != nil {
+			return err
+		}
 
-func (p *Post) getParentId(id int64, path string) int {
-	if len(path) == 5 {
-		return int(id)
-	} else if len(path) == 10 {
-		return fromBase92(path[len(path)-10 : len(path)-5])
-	} else {
-		parentId := path[:len(path)-5]
+		// thread + isDeleted
+		post := &Post{inputRequest: p.inputRequest, store: tx}
+		if err := post.threadCounter("create", int64(responseMsg.Thread), responseMsg.IsDeleted); err != nil {
+			return err
+		}
 
-		query := "SELECT id FROM post WHERE parent = ?"
-		args := Args{}
-		args.append(parentId)
+		// pending until its subscribers have their notifications
+		if notify {
+			return tx.MarkNotify(responseMsg.Id)
+		}
+		return nil
+	})
+	if err == ErrNotFound {
+		return createNotExistResponse()
+	} else if err != nil {
+		return createErrorResponse(p.inputRequest, err)
+	}
 
-		getParent := selectQuery(query, &args.data, p.db)
+	p.inputRequest.log.Info("post created", "post", responseMsg.Id, "thread", int64(responseMsg.Thread))
 
-		respId := stringToInt64(getParent.values[0]["id"])
+	// subscribers hear of it off this request
+	if notify {
+		notifications.enqueue(responseMsg.Id)
+	}
 
-		return int(respId)
+	if parent != nil {
+		tempParent := floatToString(p.inputRequest.json["parent"].(float64))
+		responseMsg.Parent = &tempParent
 	}
+
+	threadEvents.publish(int64(responseMsg.Thread), "post_create", responseMsg)
+	gateway.publish("post_create", responseMsg,
+		forumChannel(responseMsg.Forum), threadChannel(int64(responseMsg.Thread)), userChannel(responseMsg.User))
+
+	return createResponse(responseCode, responseMsg)
 }
 
 // Return true if need threadCounter()
-func (p *Post) updateBoolBasic(query string, value bool) (bool, string) {
-	args := Args{}
-
+func (p *Post) updateBoolBasic(update func(id int64) (bool, error)) (bool, string) {
 	if !validateJson(p.inputRequest, "post") {
 		return false, createInvalidJsonResponse(p.inputRequest)
 	}
@@ -194,18 +137,16 @@ func (p *Post) updateBoolBasic(query string, value bool) (bool, string) {
 
 	postId := p.inputRequest.json["post"].(float64)
 
-	args.append(value, postId)
-
-	dbResp, err := execQuery(query, &args.data, p.db)
+	changed, err := update(int64(postId))
 	if err != nil {
-		return false, createErrorResponse(err)
+		return false, createErrorResponse(p.inputRequest, err)
 	}
 
-	if dbResp.rowCount == 0 {
-		postArgs := Args{}
-		postArgs.append(postId)
-
-		responseCode, responseMsg := p._getPostDetails(postArgs)
+	if !changed {
+		responseCode, responseMsg, err := p._getPostDetails(int64(postId))
+		if err != nil {
+			return false, createErrorResponse(p.inputRequest, err)
+		}
 
 		if responseCode != 0 {
 			return false, createNotExistResponse()
@@ -222,57 +163,33 @@ func (p *Post) updateBoolBasic(query string, value bool) (bool, string) {
 	return true, createResponse(responseCode, responseMsg)
 }
 
-func (p *Post) _getPostDetails(args Args) (int, *rs.PostDetails) {
-	query := "SELECT * FROM post WHERE id = ?"
+// Code 1 and empty details for a missing post, storage errors are returned
+func (p *Post) _getPostDetails(id int64) (int, *rs.PostDetails, error) {
+	responseMsg, err := p.store.GetPost(id)
 
-	getPost := selectQuery(query, &args.data, p.db)
-
-	if getPost.rows == 0 {
+	if err == ErrNotFound {
 		responseCode := 1
 		errorMessage := &rs.PostDetails{}
 
-		return responseCode, errorMessage
+		return responseCode, errorMessage, nil
+	} else if err != nil {
+		return 0, nil, err
 	}
 
-	respId := stringToInt64(getPost.values[0]["id"])
-
 	responseCode := 0
-	responseMsg := &rs.PostDetails{
-		Date:          getPost.values[0]["date"],
-		Dislikes:      stringToInt64(getPost.values[0]["dislikes"]),
-		Forum:         getPost.values[0]["forum"],
-		Id:            respId,
-		IsApproved:    stringToBool(getPost.values[0]["isApproved"]),
-		IsHighlighted: stringToBool(getPost.values[0]["isHighlighted"]),
-		IsEdited:      stringToBool(getPost.values[0]["isEdited"]),
-		IsSpam:        stringToBool(getPost.values[0]["isSpam"]),
-		IsDeleted:     stringToBool(getPost.values[0]["isDeleted"]),
-		Likes:         stringToInt64(getPost.values[0]["likes"]),
-		Message:       getPost.values[0]["message"],
-		Parent:        nil,
-		Points:        stringToInt64(getPost.values[0]["points"]),
-		Thread:        stringToInt64(getPost.values[0]["thread"]),
-		User:          getPost.values[0]["user"],
-	}
-
-	if parent := p.getParentId(respId, getPost.values[0]["parent"]); parent == int(respId) {
-		responseMsg.Parent = nil
-	} else {
-		tempParent := int64(parent)
-		responseMsg.Parent = &tempParent
-	}
-
-	return responseCode, responseMsg
+	return responseCode, responseMsg, nil
 }
 
 func (p *Post) details() string {
 	var relatedUser, relatedThread, relatedForum bool
-	args := Args{}
 
 	if len(p.inputRequest.query["post"]) != 1 {
 		return createInvalidResponse()
 	}
-	args.append(p.inputRequest.query["post"][0])
+	postId, ok := parseId(p.inputRequest.query["post"][0])
+	if !ok {
+		return createInvalidResponse()
+	}
 
 	if len(p.inputRequest.query["related"]) >= 1 && stringInSlice("user", p.inputRequest.query["related"]) {
 		relatedUser = true
@@ -284,37 +201,43 @@ func (p *Post) details() string {
 		relatedForum = true
 	}
 
-	responseCode, responseMsg := p._getPostDetails(args)
+	responseCode, responseMsg, err := p._getPostDetails(postId)
+	if err != nil {
+		return createErrorResponse(p.inputRequest, err)
+	}
 	if responseCode != 0 {
 		return createResponse(responseCode, responseMsg)
 	}
 
 	if relatedUser {
-		u := User{inputRequest: p.inputRequest, db: p.db}
+		u := User{inputRequest: p.inputRequest, store: p.store}
 
-		userArgs := Args{}
-		userArgs.append(responseMsg.User)
-		_, userDetails := u._getUserDetails(userArgs)
+		_, userDetails, err := u._getUserDetails(responseMsg.User.(string))
+		if err != nil {
+			return createErrorResponse(p.inputRequest, err)
+		}
 
 		responseMsg.User = userDetails
 	}
 
 	if relatedThread {
-		t := Thread{inputRequest: p.inputRequest, db: p.db}
+		t := Thread{inputRequest: p.inputRequest, store: p.store}
 
-		threadArgs := Args{}
-		threadArgs.append(responseMsg.Thread)
-		_, threadDetails := t._getThreadDetails(threadArgs)
+		_, threadDetails, err := t._getThreadDetails(responseMsg.Thread.(int64))
+		if err != nil {
+			return createErrorResponse(p.inputRequest, err)
+		}
 
 		responseMsg.Thread = threadDetails
 	}
 
 	if relatedForum {
-		f := Forum{inputRequest: p.inputRequest, db: p.db}
+		f := Forum{inputRequest: p.inputRequest, store: p.store}
 
-		forumArgs := Args{}
-		forumArgs.append(responseMsg.Forum)
-		_, forumDetails := f._getForumDetails(forumArgs)
+		_, forumDetails, err := f._getForumDetails(responseMsg.Forum.(string))
+		if err != nil {
+			return createErrorResponse(p.inputRequest, err)
+		}
 
 		responseMsg.Forum = forumDetails
 	}
@@ -322,118 +245,60 @@ func (p *Post) details() string {
 	return createResponse(responseCode, responseMsg)
 }
 
-func (p *Post) _getArrayPostDetails(query string, args Args) (int, *rs.PostList) {
-	getPost := selectQuery(query, &args.data, p.db)
-
-	if getPost.rows == 0 {
-		responseCode := 1
-		errorMessage := &rs.PostList{}
-
-		return responseCode, errorMessage
-	}
-
-	responseCode := 0
-	responseArray := make([]rs.PostDetails, 0)
-	responseMsg := &rs.PostList{Posts: responseArray}
-
-	for _, value := range getPost.values {
-		respId := stringToInt64(value["id"])
-
-		tempMsg := &rs.PostDetails{
-			Date:          value["date"],
-			Dislikes:      stringToInt64(value["dislikes"]),
-			Forum:         value["forum"],
-			Id:            respId,
-			IsApproved:    stringToBool(value["isApproved"]),
-			IsHighlighted: stringToBool(value["isHighlighted"]),
-			IsEdited:      stringToBool(value["isEdited"]),
-			IsSpam:        stringToBool(value["isSpam"]),
-			IsDeleted:     stringToBool(value["isDeleted"]),
-			Likes:         stringToInt64(value["likes"]),
-			Message:       value["message"],
-			Parent:        nil,
-			Points:        stringToInt64(value["points"]),
-			Thread:        stringToInt64(value["thread"]),
-			User:          value["user"],
-		}
-
-		parent := p.getParentId(respId, value["parent"])
-		if parent == int(respId) {
-			tempMsg.Parent = nil
-		} else {
-			tempParent := int64(parent)
-			tempMsg.Parent = &tempParent
-		}
-
-		responseMsg.Posts = append(responseMsg.Posts, *tempMsg)
+func (p *Post) _getList(field, value string) (int, *rs.PostList, *pager, error) {
+	// Check and validate optional params
+	opts, ok := p.inputRequest.listOptions("desc", "since")
+	if !ok {
+		return 100500, nil, nil, nil
 	}
+	page := newPager(&opts)
 
-	return responseCode, responseMsg
-}
-
-func (p *Post) _getList(query string, order string, args Args) (int, *rs.PostList) {
-	// Check and validate optional params
-	if len(p.inputRequest.query["since"]) >= 1 {
-		query += " AND date > ?"
-		args.append(p.inputRequest.query["since"][0])
+	posts, err := p.store.ListPosts(field, value, opts)
+	if err != nil {
+		return 0, nil, nil, err
 	}
 
-	query += order
+	if len(posts) == 0 {
+		responseCode := 1
+		errorMessage := &rs.PostList{}
 
-	if len(p.inputRequest.query["limit"]) >= 1 {
-		i, err := strconv.Atoi(p.inputRequest.query["limit"][0])
-		if err != nil || i < 0 {
-			return 100500, nil
-		}
-		query += fmt.Sprintf(" LIMIT %d", i)
+		return responseCode, errorMessage, page, nil
 	}
 
-	fmt.Println("_getList: ", query, args.data)
+	posts = posts[:page.cut(len(posts), func(i int) int64 { return posts[i].Id })]
 
-	responseCode, responseMsg := p._getArrayPostDetails(query, args)
+	responseCode := 0
+	responseMsg := &rs.PostList{Posts: posts}
 
-	return responseCode, responseMsg
+	return responseCode, responseMsg, page, nil
 }
 
 func (p *Post) list() string {
-	var query, order, resp string
-	args := Args{}
+	var field, resp string
 
 	// Validate query values
 	if len(p.inputRequest.query["thread"]) == 1 {
-		query = "SELECT * FROM post WHERE thread = ?"
-		args.append(p.inputRequest.query["thread"][0])
+		field = "thread"
 	} else if len(p.inputRequest.query["user"]) == 1 {
-		query = "SELECT * FROM post WHERE user = ?"
-		args.append(p.inputRequest.query["user"][0])
+		field = "user"
 	} else if len(p.inputRequest.query["forum"]) == 1 {
-		query = "SELECT * FROM post WHERE forum = ?"
-		args.append(p.inputRequest.query["forum"][0])
+		field = "forum"
 	} else {
 		return createInvalidResponse()
 	}
 
-	// order by here
-	if len(p.inputRequest.query["order"]) >= 1 {
-		orderType := p.inputRequest.query["order"][0]
-		if orderType != "desc" && orderType != "asc" {
-			return createInvalidResponse()
-		}
-
-		order = fmt.Sprintf(" ORDER BY date %s", orderType)
-	} else {
-		order = " ORDER BY date DESC"
+	responseCode, responseMsg, page, err := p._getList(field, p.inputRequest.query[field][0])
+	if err != nil {
+		return createErrorResponse(p.inputRequest, err)
 	}
 
-	responseCode, responseMsg := p._getList(query, order, args)
-
 	// check responseCode
 	if responseCode == 0 {
 		responseInterface := make([]interface{}, len(responseMsg.Posts))
 		for i, v := range responseMsg.Posts {
 			responseInterface[i] = v
 		}
-		resp = createResponseFromArray(responseCode, responseInterface)
+		resp = page.response(responseCode, responseInterface)
 	} else if responseCode == 1 {
 		resp = becauseAPI()
 	} else {
@@ -443,120 +308,158 @@ func (p *Post) list() string {
 	return resp
 }
 
-func (p *Post) remove() string {
-	query := "UPDATE post SET isDeleted = ? WHERE id = ?"
+// Flag and thread counter in one unit
+func (p *Post) setDeleted(operation string, deleted bool) string {
+	var resp string
+	var check bool
+	var thread int64
 
-	check, resp := p.updateBoolBasic(query, true)
-	if check {
-		args := Args{}
-		args.append(p.inputRequest.json["post"])
-		_, responseMsg := p._getPostDetails(args)
-		thread := int64ToString(responseMsg.Thread.(int64))
-		p.threadCounter("remove", thread, true)
-	}
+	err := p.store.Tx(func(tx Store) error {
+		post := &Post{inputRequest: p.inputRequest, store: tx}
 
-	return resp
-}
+		check, resp = post.updateBoolBasic(func(id int64) (bool, error) {
+			return tx.SetPostDeleted(id, deleted)
+		})
+		if !check {
+			return nil
+		}
 
-func (p *Post) restore() string {
-	query := "UPDATE post SET isDeleted = ? WHERE id = ?"
+		_, responseMsg, err := post._getPostDetails(int64(p.inputRequest.json["post"].(float64)))
+		if err != nil {
+			return err
+		}
+		thread = responseMsg.Thread.(int64)
+		return post.threadCounter(operation, thread, deleted)
+	})
+	if err != nil {
+		return createErrorResponse(p.inputRequest, err)
+	}
 
-	check, resp := p.updateBoolBasic(query, false)
 	if check {
-		args := Args{}
-		args.append(p.inputRequest.json["post"])
-		_, responseMsg := p._getPostDetails(args)
-		thread := int64ToString(responseMsg.Thread.(int64))
-		p.threadCounter("restore", thread, false)
+		threadEvents.publish(thread, "post_"+operation, &rs.PostBoolBasic{Post: p.inputRequest.json["post"].(float64)})
 	}
 
 	return resp
 }
 
-func (p *Post) update() string {
-	query := "UPDATE post SET message = ? WHERE id = ?"
+func (p *Post) remove() string {
+	return p.setDeleted("remove", true)
+}
 
-	args := Args{}
+func (p *Post) restore() string {
+	return p.setDeleted("restore", false)
+}
 
+func (p *Post) update() string {
 	if !validateJson(p.inputRequest, "message", "post") {
 		return createInvalidJsonResponse(p.inputRequest)
 	}
 
+	if !checkStringParams(p.inputRequest.json, "message") {
+		return createInvalidJsonResponse(p.inputRequest)
+	}
+
 	if !checkFloat64Type(p.inputRequest.json["post"]) {
 		return createInvalidJsonResponse(p.inputRequest)
 	}
 
-	threadId := p.inputRequest.json["post"].(float64)
-	args.generateFromJson(&p.inputRequest.json, "message", "post")
+	postId := int64(p.inputRequest.json["post"].(float64))
 
-	dbResp, err := execQuery(query, &args.data, p.db)
-	if err != nil {
-		return createErrorResponse(err)
+	editor, ok := userParam(p.inputRequest)
+	if !ok {
+		return createInvalidJsonResponse(p.inputRequest)
 	}
 
-	if dbResp.rowCount == 0 {
-		query := "UPDATE post SET isEdited = false WHERE id = ?"
-		_, _ = execQuery(query, &args.data, p.db)
-	} else {
-		query := "UPDATE post SET isEdited = true WHERE id = ?"
-		_, _ = execQuery(query, &args.data, p.db)
+	err := p.store.UpdatePost(postId, p.inputRequest.json["message"].(string), editor)
+	if err != nil {
+		return createErrorResponse(p.inputRequest, err)
 	}
 
-	postArgs := Args{}
-	postArgs.append(threadId)
-	responseCode, responseMsg := p._getPostDetails(postArgs)
+	responseCode, responseMsg, err := p._getPostDetails(postId)
+	if err != nil {
+		return createErrorResponse(p.inputRequest, err)
+	}
 
 	if responseCode != 0 {
 		return createNotExistResponse()
 	}
 
+	threadEvents.publish(responseMsg.Thread.(int64), "post_update", responseMsg)
+
 	return createResponse(responseCode, responseMsg)
 }
 
-func (p *Post) vote() string {
-	var query string
-	args := Args{}
+func (p *Post) search() string {
+	return searchPosts(p.inputRequest, p.store)
+}
+
+func (p *Post) history() string {
+	return listRevisions(p.inputRequest, p.store, "post")
+}
+
+func (p *Post) revert() string {
+	return revert(p.inputRequest, p.store, "post", func(id int64) string {
+		responseCode, responseMsg, err := p._getPostDetails(id)
+		if err != nil {
+			return createErrorResponse(p.inputRequest, err)
+		}
 
+		if responseCode != 0 {
+			return createNotExistResponse()
+		}
+
+		threadEvents.publish(responseMsg.Thread.(int64), "post_update", responseMsg)
+
+		return createResponse(responseCode, responseMsg)
+	})
+}
+
+func (p *Post) listVotes() string {
+	return listVotes(p.inputRequest, p.store, "post")
+}
+
+func (p *Post) vote() string {
 	if !validateJson(p.inputRequest, "post", "vote") {
 		return createInvalidJsonResponse(p.inputRequest)
 	}
 
-	if !checkFloat64Type(p.inputRequest.json["post"]) || !checkFloat64Type(p.inputRequest.json["vote"]) {
+	if !checkFloat64Type(p.inputRequest.json["post"]) {
 		return createInvalidJsonResponse(p.inputRequest)
 	}
 
-	postId := p.inputRequest.json["post"].(float64)
-	vote := p.inputRequest.json["vote"].(float64)
-
-	if vote == 1 {
-		query = "UPDATE post SET likes = likes + 1, points = points + 1 WHERE id = ?"
-	} else if vote == -1 {
-		query = "UPDATE post SET dislikes = dislikes + 1, points = points - 1 WHERE id = ?"
-	} else {
+	postId := int64(p.inputRequest.json["post"].(float64))
+	user, vote, ok := voteParams(p.inputRequest)
+	if !ok {
 		return createInvalidJsonResponse(p.inputRequest)
 	}
 
-	args.append(p.inputRequest.json["post"])
-
-	_, err := execQuery(query, &args.data, p.db)
+	var err error
+	if user != nil {
+		err = p.store.SetVote("post", postId, *user, vote)
+	} else {
+		err = p.store.VotePost(postId, vote)
+	}
 	if err != nil {
-		return createErrorResponse(err)
+		return createErrorResponse(p.inputRequest, err)
 	}
 
-	postArgs := Args{}
-	postArgs.append(postId)
-	responseCode, responseMsg := p._getPostDetails(postArgs)
+	responseCode, responseMsg, err := p._getPostDetails(postId)
+	if err != nil {
+		return createErrorResponse(p.inputRequest, err)
+	}
 
 	if responseCode != 0 {
 		return createNotExistResponse()
 	}
 
+	threadEvents.publish(responseMsg.Thread.(int64), "post_vote", responseMsg)
+
 	return createResponse(responseCode, responseMsg)
 }
 
-func postHandler(w http.ResponseWriter, r *http.Request, inputRequest *InputRequest, db *sql.DB) {
+func postHandler(w http.ResponseWriter, r *http.Request, inputRequest *InputRequest, store Store) {
 	//t0 := time.Now()
-	post := Post{inputRequest: inputRequest, db: db}
+	post := Post{inputRequest: inputRequest, store: store}
 	var result string
 
 	if inputRequest.method == "GET" {
@@ -565,6 +468,12 @@ func postHandler(w http.ResponseWriter, r *http.Request, inputRequest *InputRequ
 			result = post.details()
 		case "/db/api/post/list/":
 			result = post.list()
+		case "/db/api/post/listVotes/":
+			result = post.listVotes()
+		case "/db/api/post/history/":
+			result = post.history()
+		case "/db/api/post/search/":
+			result = post.search()
 		}
 	} else if inputRequest.method == "POST" {
 		switch inputRequest.path {
@@ -578,6 +487,8 @@ func postHandler(w http.ResponseWriter, r *http.Request, inputRequest *InputRequ
 			result = post.remove()
 		case "/db/api/post/update/":
 			result = post.update()
+		case "/db/api/post/revert/":
+			result = post.revert()
 		}
 	}
 
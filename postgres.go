@@ -0,0 +1,711 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	rs "technopark-db/response"
+
+	"github.com/lib/pq"
+)
+
+// =================
+// PostgreSQL storage here
+// =================
+
+// PostgresStore keeps post trees as INT[] paths of ancestor ids, so tree
+// sorts are plain array comparisons (see
+// migrations/postgres/0001_create_tables.up.sql).
+type PostgresStore struct {
+	db   querier
+	conn *sql.DB // nil inside a unit of work
+}
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: timed(db), conn: db}
+}
+
+// Run fn on a store bound to one transaction, or on s when it already is
+func (s *PostgresStore) atomic(fn func(tx *PostgresStore) error) error {
+	if s.conn == nil {
+		return fn(s)
+	}
+	return runTx(s.conn, func(tx *sql.Tx) error { return fn(&PostgresStore{db: timed(tx)}) })
+}
+
+func (s *PostgresStore) Tx(fn func(tx Store) error) error {
+	return s.atomic(func(tx *PostgresStore) error { return fn(tx) })
+}
+
+// Columns in the order of the scan functions (see rows.go), post parent last
+const (
+	pgUserColumns   = `users.id, users.username, users.about, users.name, users.email, users.isanonymous`
+	pgForumColumns  = `forum.id, forum.name, forum.short_name, forum."user"`
+	pgThreadColumns = `thread.id, thread.forum, thread.title, thread.isclosed, thread."user", to_char(thread.date, 'YYYY-MM-DD HH24:MI:SS'), thread.message, thread.slug, thread.isdeleted, thread.likes, thread.dislikes, thread.points, thread.posts`
+	pgPostColumns   = `post.id, post.thread, post.message, post."user", post.forum, to_char(post.date, 'YYYY-MM-DD HH24:MI:SS'), post.isapproved, post.ishighlighted, post.isedited, post.isspam, post.isdeleted, post.likes, post.dislikes, post.points, post.parent`
+)
+
+// Map PostgreSQL error codes to storage errors
+func postgresError(err error) error {
+	if driverErr, ok := err.(*pq.Error); ok {
+		switch driverErr.Code {
+		case "23505": // unique_violation
+			return fmt.Errorf("%w: %v", ErrDuplicate, err)
+		case "23503": // foreign_key_violation
+			return fmt.Errorf("%w: %v", ErrForeignKey, err)
+		}
+	}
+	return err
+}
+
+// Replace ? placeholders with $1, $2, ...
+func rebind(query string) string {
+	var result strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			fmt.Fprintf(&result, "$%d", n)
+		} else {
+			result.WriteRune(c)
+		}
+	}
+	return result.String()
+}
+
+func (s *PostgresStore) exec(query string, args ...interface{}) (int64, error) {
+	res, err := s.db.Exec(rebind(query), args...)
+	if err != nil {
+		return 0, postgresError(err)
+	}
+	return res.RowsAffected()
+}
+
+func (s *PostgresStore) queryRow(query string, args ...interface{}) *sql.Row {
+	return s.db.QueryRow(rebind(query), args...)
+}
+
+// ======================
+// Users here
+// ======================
+
+func (s *PostgresStore) CreateUser(user *rs.UserDetails) error {
+	query := "INSERT INTO users (username, about, name, email, isanonymous) VALUES($1, $2, $3, $4, $5) RETURNING id"
+
+	err := s.db.QueryRow(query, user.Username, user.About, user.Name, user.Email, user.IsAnonymous).Scan(&user.Id)
+	return postgresError(err)
+}
+
+func (s *PostgresStore) GetUser(email string) (*rs.UserDetails, error) {
+	user, err := scanUser(s.queryRow("SELECT "+pgUserColumns+" FROM users WHERE email = ?", email))
+	return user, notFound(err)
+}
+
+func (s *PostgresStore) GetUsers(emails []string) ([]rs.UserDetails, error) {
+	if len(emails) == 0 {
+		return []rs.UserDetails{}, nil
+	}
+	return queryUsers(s.db, "SELECT "+pgUserColumns+" FROM users WHERE email = ANY($1)", pq.Array(emails))
+}
+
+func (s *PostgresStore) UpdateUser(email, about, name string) error {
+	_, err := s.exec("UPDATE users SET about = ?, name = ? WHERE email = ?", about, name, email)
+	return err
+}
+
+func (s *PostgresStore) listUsers(query string, email string, opts ListOptions) ([]rs.UserDetails, error) {
+	args := []interface{}{email}
+	query = listClauses(query, &args, opts, "users", "users.id", "users.date", "users.date")
+
+	return queryUsers(s.db, rebind(query), args...)
+}
+
+func (s *PostgresStore) ListFollowers(email string, opts ListOptions) ([]rs.UserDetails, error) {
+	query := "SELECT " + pgUserColumns + " FROM users JOIN follow f ON users.email = f.follower WHERE f.followee = ?"
+
+	return s.listUsers(query, email, opts)
+}
+
+func (s *PostgresStore) ListFollowing(email string, opts ListOptions) ([]rs.UserDetails, error) {
+	query := "SELECT " + pgUserColumns + " FROM users JOIN follow f ON users.email = f.followee WHERE f.follower = ?"
+
+	return s.listUsers(query, email, opts)
+}
+
+// ======================
+// Follows here
+// ======================
+
+func (s *PostgresStore) Follow(follower, followee string) error {
+	_, err := s.exec("INSERT INTO follow (follower, followee) VALUES(?, ?)", follower, followee)
+	return err
+}
+
+func (s *PostgresStore) Unfollow(follower, followee string) error {
+	_, err := s.exec("DELETE FROM follow WHERE follower = ? AND followee = ?", follower, followee)
+	return err
+}
+
+func (s *PostgresStore) GetFollowers(email string) ([]string, error) {
+	return queryStrings(s.db, "SELECT follower FROM follow WHERE followee = $1 ORDER BY follower", email)
+}
+
+func (s *PostgresStore) GetFollowing(email string) ([]string, error) {
+	return queryStrings(s.db, "SELECT followee FROM follow WHERE follower = $1 ORDER BY followee", email)
+}
+
+func (s *PostgresStore) GetFollowersOf(emails []string) (map[string][]string, error) {
+	if len(emails) == 0 {
+		return map[string][]string{}, nil
+	}
+	return queryStringGroups(s.db, "SELECT followee, follower FROM follow WHERE followee = ANY($1) ORDER BY follower", pq.Array(emails))
+}
+
+func (s *PostgresStore) GetFollowingOf(emails []string) (map[string][]string, error) {
+	if len(emails) == 0 {
+		return map[string][]string{}, nil
+	}
+	return queryStringGroups(s.db, "SELECT follower, followee FROM follow WHERE follower = ANY($1) ORDER BY followee", pq.Array(emails))
+}
+
+// ======================
+// Forums here
+// ======================
+
+func (s *PostgresStore) CreateForum(forum *rs.ForumCreate) error {
+	query := `INSERT INTO forum (name, short_name, "user") VALUES($1, $2, $3) RETURNING id`
+
+	err := s.db.QueryRow(query, forum.Name, forum.Short_Name, forum.User).Scan(&forum.Id)
+	return postgresError(err)
+}
+
+func (s *PostgresStore) GetForum(shortName string) (*rs.ForumDetails, error) {
+	forum, err := scanForum(s.queryRow("SELECT "+pgForumColumns+" FROM forum WHERE short_name = ?", shortName))
+	return forum, notFound(err)
+}
+
+func (s *PostgresStore) GetForums(shortNames []string) ([]rs.ForumDetails, error) {
+	if len(shortNames) == 0 {
+		return []rs.ForumDetails{}, nil
+	}
+	return queryForums(s.db, "SELECT "+pgForumColumns+" FROM forum WHERE short_name = ANY($1)", pq.Array(shortNames))
+}
+
+func (s *PostgresStore) ListForumUsers(forum string, opts ListOptions) ([]string, error) {
+	query := `SELECT u.email FROM users u WHERE u.email IN (SELECT DISTINCT p."user" FROM post p WHERE p.forum = ?)`
+	args := []interface{}{forum}
+	// NULL names sort as '', first on asc as in MySQL
+	query = listClauses(query, &args, opts, "users u", "u.id", "u.date", "COALESCE(u.name, '')")
+
+	return queryStrings(s.db, rebind(query), args...)
+}
+
+// ======================
+// Threads here
+// ======================
+
+func (s *PostgresStore) CreateThread(thread *rs.ThreadCreate) error {
+	query := `INSERT INTO thread (forum, title, isclosed, "user", date, message, slug, isdeleted) VALUES($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`
+
+	err := s.db.QueryRow(query, thread.Forum, thread.Title, thread.IsClosed, thread.User, thread.Date, thread.Message, thread.Slug, thread.IsDeleted).Scan(&thread.Id)
+	return postgresError(err)
+}
+
+func (s *PostgresStore) GetThread(id int64) (*rs.ThreadDetails, error) {
+	thread, err := scanThread(s.queryRow("SELECT "+pgThreadColumns+" FROM thread WHERE id = ?", id))
+	return thread, notFound(err)
+}
+
+func (s *PostgresStore) GetThreads(ids []int64) ([]rs.ThreadDetails, error) {
+	if len(ids) == 0 {
+		return []rs.ThreadDetails{}, nil
+	}
+	return queryThreads(s.db, "SELECT "+pgThreadColumns+" FROM thread WHERE id = ANY($1)", pq.Array(ids))
+}
+
+func (s *PostgresStore) ListThreads(field, value string, opts ListOptions) ([]rs.ThreadDetails, error) {
+	if field != "user" && field != "forum" {
+		return nil, fmt.Errorf("can't list threads by %q", field)
+	}
+
+	query := fmt.Sprintf(`SELECT %s FROM thread WHERE thread."%s" = ?`, pgThreadColumns, field)
+	args := []interface{}{value}
+	query = listClauses(query, &args, opts, "thread", "thread.id", "thread.date", "thread.date")
+
+	return queryThreads(s.db, rebind(query), args...)
+}
+
+func (s *PostgresStore) UpdateThread(id int64, message, slug string, editor *string) error {
+	return s.atomic(func(tx *PostgresStore) error {
+		var oldMessage, oldSlug string
+		err := tx.queryRow("SELECT message, slug FROM thread WHERE id = ? FOR UPDATE", id).Scan(&oldMessage, &oldSlug)
+		if err == sql.ErrNoRows || err == nil && oldMessage == message && oldSlug == slug {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.exec("INSERT INTO thread_revision (thread, message, slug, editor) VALUES(?, ?, ?, ?)", id, oldMessage, oldSlug, editor)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.exec("UPDATE thread SET message = ?, slug = ? WHERE id = ?", message, slug, id)
+		return err
+	})
+}
+
+func (s *PostgresStore) VoteThread(id int64, vote int) error {
+	var query string
+
+	if vote > 0 {
+		query = "UPDATE thread SET likes = likes + 1, points = points + 1 WHERE id = ?"
+	} else {
+		query = "UPDATE thread SET dislikes = dislikes + 1, points = points - 1 WHERE id = ?"
+	}
+
+	_, err := s.exec(query, id)
+	return err
+}
+
+// Updates only count changed rows, as MySQL does
+func (s *PostgresStore) SetThreadClosed(id int64, closed bool) (bool, error) {
+	rowCount, err := s.exec("UPDATE thread SET isclosed = ? WHERE id = ? AND isclosed <> ?", closed, id, closed)
+	return rowCount != 0, err
+}
+
+func (s *PostgresStore) RemoveThread(id int64) (bool, error) {
+	var rowCount int64
+
+	err := s.atomic(func(tx *PostgresStore) error {
+		var err error
+		rowCount, err = tx.exec("UPDATE thread SET isdeleted = true, posts = 0 WHERE id = ? AND (NOT isdeleted OR posts <> 0)", id)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.exec("UPDATE post SET isdeleted = true WHERE thread = ?", id)
+		return err
+	})
+
+	return rowCount != 0, err
+}
+
+func (s *PostgresStore) RestoreThread(id int64) (bool, error) {
+	var rowCount int64
+
+	err := s.atomic(func(tx *PostgresStore) error {
+		_, err := tx.exec("UPDATE post SET isdeleted = false WHERE thread = ?", id)
+		if err != nil {
+			return err
+		}
+
+		query := `UPDATE thread t SET isdeleted = false, posts = c.count
+			FROM (SELECT COUNT(*) AS count FROM post WHERE thread = ? AND NOT isdeleted) c
+			WHERE t.id = ? AND (t.isdeleted OR t.posts <> c.count)`
+		rowCount, err = tx.exec(query, id, id)
+		return err
+	})
+
+	return rowCount != 0, err
+}
+
+func (s *PostgresStore) UpdateThreadPosts(id int64, delta int) error {
+	_, err := s.exec("UPDATE thread SET posts = posts + ? WHERE id = ?", delta, id)
+	return err
+}
+
+// ======================
+// Subscriptions here
+// ======================
+
+func (s *PostgresStore) Subscribe(thread int64, user string) error {
+	_, err := s.exec(`INSERT INTO subscribe (thread, "user") VALUES(?, ?)`, thread, user)
+	return err
+}
+
+func (s *PostgresStore) Unsubscribe(thread int64, user string) (bool, error) {
+	rowCount, err := s.exec(`DELETE FROM subscribe WHERE thread = ? AND "user" = ?`, thread, user)
+	return rowCount != 0, err
+}
+
+func (s *PostgresStore) GetSubscriptions(email string) ([]int, error) {
+	return queryInts(s.db, `SELECT thread FROM subscribe WHERE "user" = $1 ORDER BY thread asc`, email)
+}
+
+func (s *PostgresStore) GetSubscriptionsOf(emails []string) (map[string][]int, error) {
+	if len(emails) == 0 {
+		return map[string][]int{}, nil
+	}
+	return queryIntGroups(s.db, `SELECT "user", thread FROM subscribe WHERE "user" = ANY($1) ORDER BY thread asc`, pq.Array(emails))
+}
+
+// ======================
+// Posts here
+// ======================
+
+func (s *PostgresStore) CreatePost(post *rs.PostCreate, parent *int64) error {
+	// path is the parent path plus own id
+	var path pq.Int64Array
+	if parent != nil {
+		err := s.db.QueryRow("SELECT path FROM post WHERE id = $1", *parent).Scan(&path)
+		if err != nil {
+			return notFound(err)
+		}
+	}
+
+	err := s.db.QueryRow("SELECT nextval(pg_get_serial_sequence('post', 'id'))").Scan(&post.Id)
+	if err != nil {
+		return err
+	}
+	path = append(path, post.Id)
+
+	query := `INSERT INTO post (id, thread, message, "user", forum, date, isapproved, ishighlighted, isedited, isspam, isdeleted, parent, path)
+		VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	_, err = s.exec(query, post.Id, int64(post.Thread), post.Message, post.User, post.Forum, post.Date,
+		post.IsApproved, post.IsHighlighted, post.IsEdited, post.IsSpam, post.IsDeleted, parent, path)
+	return err
+}
+
+func (s *PostgresStore) GetPost(id int64) (*rs.PostDetails, error) {
+	var parent sql.NullInt64
+
+	post, err := scanPost(s.queryRow("SELECT "+pgPostColumns+" FROM post WHERE id = ?", id), &parent)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	post.Parent = nullInt64(parent)
+	return post, nil
+}
+
+func (s *PostgresStore) ListPosts(field, value string, opts ListOptions) ([]rs.PostDetails, error) {
+	if field != "thread" && field != "user" && field != "forum" {
+		return nil, fmt.Errorf("can't list posts by %q", field)
+	}
+
+	query := fmt.Sprintf(`SELECT %s FROM post WHERE post."%s" = ?`, pgPostColumns, field)
+	args := []interface{}{value}
+	query = listClauses(query, &args, opts, "post", "post.id", "post.date", "post.date")
+
+	return queryPosts(s.db, rebind(query), args...)
+}
+
+func pgRoot(path string) string { return "(" + path + ")[1]" }
+
+func (s *PostgresStore) ListPostsTree(thread int64, opts ListOptions) ([]rs.PostDetails, error) {
+	query := "SELECT " + pgPostColumns + " FROM post WHERE thread = ?"
+	args := []interface{}{thread}
+
+	// roots in requested order, children by path
+	query = sinceClauses(query, &args, opts, "post.id", "post.date")
+	query = treeAfterClause(query, &args, opts, "post.path", "(SELECT a.path FROM post a WHERE a.id = ?)", pgRoot)
+	query += " ORDER BY post.path[1] " + opts.Order + ", post.path"
+	query += limitClause(opts.Limit)
+
+	return queryPosts(s.db, rebind(query), args...)
+}
+
+func (s *PostgresStore) ListPostsParentTree(thread int64, opts ListOptions) ([]rs.PostDetails, error) {
+	// limit applies to root posts, subtrees come in the same query
+	roots := "SELECT id FROM post WHERE thread = ? AND parent IS NULL"
+	args := []interface{}{thread}
+	roots = sinceClauses(roots, &args, opts, "id", "date")
+	roots = afterClause(roots, &args, opts, "post", "id", "id")
+	roots += " ORDER BY id " + opts.Order
+	roots += limitClause(opts.Limit)
+
+	query := "SELECT " + pgPostColumns +
+		" FROM post JOIN (" + roots + ") r ON post.path[1] = r.id" +
+		" ORDER BY post.path[1] " + opts.Order + ", post.path"
+
+	return queryPosts(s.db, rebind(query), args...)
+}
+
+func (s *PostgresStore) UpdatePost(id int64, message string, editor *string) error {
+	return s.atomic(func(tx *PostgresStore) error {
+		var oldMessage string
+		err := tx.queryRow("SELECT message FROM post WHERE id = ? FOR UPDATE", id).Scan(&oldMessage)
+		if err == sql.ErrNoRows || err == nil && oldMessage == message {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.exec("INSERT INTO post_revision (post, message, editor) VALUES(?, ?, ?)", id, oldMessage, editor)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.exec("UPDATE post SET message = ?, isedited = true WHERE id = ?", message, id)
+		return err
+	})
+}
+
+func (s *PostgresStore) VotePost(id int64, vote int) error {
+	var query string
+
+	if vote > 0 {
+		query = "UPDATE post SET likes = likes + 1, points = points + 1 WHERE id = ?"
+	} else {
+		query = "UPDATE post SET dislikes = dislikes + 1, points = points - 1 WHERE id = ?"
+	}
+
+	_, err := s.exec(query, id)
+	return err
+}
+
+func (s *PostgresStore) SetPostDeleted(id int64, deleted bool) (bool, error) {
+	rowCount, err := s.exec("UPDATE post SET isdeleted = ? WHERE id = ? AND isdeleted <> ?", deleted, id, deleted)
+	return rowCount != 0, err
+}
+
+// ======================
+// Votes here
+// ======================
+
+// The target row stays locked until the counters have moved, so votes of
+// one user can't race on the old vote
+func (s *PostgresStore) SetVote(target string, id int64, user string, vote int) error {
+	table, err := voteTable(target)
+	if err != nil {
+		return err
+	}
+
+	return s.atomic(func(tx *PostgresStore) error {
+		err := tx.queryRow(fmt.Sprintf("SELECT id FROM %s WHERE id = ? FOR UPDATE", target), id).Scan(new(int64))
+		if err != nil {
+			return notFound(err)
+		}
+
+		var old int
+		err = tx.queryRow(fmt.Sprintf(`SELECT vote FROM %s WHERE %s = ? AND "user" = ?`, table, target), id, user).Scan(&old)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+
+		switch {
+		case vote == old:
+			return nil
+		case vote == 0:
+			_, err = tx.exec(fmt.Sprintf(`DELETE FROM %s WHERE %s = ? AND "user" = ?`, table, target), id, user)
+		case old == 0:
+			_, err = tx.exec(fmt.Sprintf(`INSERT INTO %s (%s, "user", vote) VALUES(?, ?, ?)`, table, target), id, user, vote)
+		default:
+			_, err = tx.exec(fmt.Sprintf(`UPDATE %s SET vote = ?, date = now() WHERE %s = ? AND "user" = ?`, table, target), vote, id, user)
+		}
+		if err != nil {
+			return err
+		}
+
+		likes, dislikes, points := voteDelta(old, vote)
+		_, err = tx.exec(fmt.Sprintf("UPDATE %s SET likes = likes + ?, dislikes = dislikes + ?, points = points + ? WHERE id = ?", target),
+			likes, dislikes, points, id)
+		return err
+	})
+}
+
+func (s *PostgresStore) ListVotes(target string, id int64, opts ListOptions) ([]rs.VoteDetails, error) {
+	table, err := voteTable(target)
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf(`SELECT v.id, v."user", v.vote, to_char(v.date, 'YYYY-MM-DD HH24:MI:SS') FROM %s v WHERE v.%s = ?`, table, target)
+	args := []interface{}{id}
+	query = listClauses(query, &args, opts, table+" v", "v.id", "v.date", "v.date")
+
+	return queryVotes(s.db, rebind(query), args...)
+}
+
+// ======================
+// Revisions here
+// ======================
+
+func (s *PostgresStore) ListRevisions(target string, id int64, opts ListOptions) ([]rs.Revision, error) {
+	table, columns, err := revisionTable(target)
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf("SELECT %s, to_char(r.date, 'YYYY-MM-DD HH24:MI:SS') FROM %s r WHERE r.%s = ?", columns, table, target)
+	args := []interface{}{id}
+	query = listClauses(query, &args, opts, table+" r", "r.id", "r.date", "r.date")
+
+	return queryRevisions(s.db, rebind(query), args...)
+}
+
+func (s *PostgresStore) GetRevision(target string, id, revision int64) (*rs.Revision, error) {
+	table, columns, err := revisionTable(target)
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf("SELECT %s, to_char(r.date, 'YYYY-MM-DD HH24:MI:SS') FROM %s r WHERE r.id = ? AND r.%s = ?", columns, table, target)
+	result, err := scanRevision(s.queryRow(query, revision, id))
+	return result, notFound(err)
+}
+
+// ======================
+// Feed here
+// ======================
+
+func (s *PostgresStore) ListFeed(email string, opts ListOptions) ([]rs.FeedItem, error) {
+	var afterDate string
+	if opts.After != 0 {
+		table, id := feedRow(opts.After)
+		err := s.queryRow("SELECT to_char(date, 'YYYY-MM-DD HH24:MI:SS') FROM "+table+" WHERE id = ?", id).Scan(&afterDate)
+		if err == sql.ErrNoRows {
+			return []rs.FeedItem{}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var args []interface{}
+	keys, err := queryInt64s(s.db, rebind(feedQuery(&args, email, opts, afterDate, `"user"`)), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return feedItems(keys, s.GetThreads, func(ids []int64) ([]rs.PostDetails, error) {
+		return queryPosts(s.db, "SELECT "+pgPostColumns+" FROM post WHERE post.id = ANY($1)", pq.Array(ids))
+	})
+}
+
+// ======================
+// Notifications here
+// ======================
+
+func (s *PostgresStore) MarkNotify(post int64) error {
+	_, err := s.exec("INSERT INTO notify_pending (post) VALUES (?)", post)
+	return err
+}
+
+func (s *PostgresStore) PendingNotify(after int64, limit int) ([]int64, error) {
+	return queryInt64s(s.db, "SELECT post FROM notify_pending WHERE post > $1 ORDER BY post LIMIT $2", after, limit)
+}
+
+func (s *PostgresStore) NotifySubscribers(post int64) (int64, error) {
+	var count int64
+	err := s.atomic(func(tx *PostgresStore) error {
+		// whoever deletes the mark notifies
+		marked, err := tx.exec("DELETE FROM notify_pending WHERE post = ?", post)
+		if err != nil || marked == 0 {
+			return err
+		}
+
+		count, err = tx.exec(`INSERT INTO notification ("user", thread, post)`+
+			` SELECT subscribe."user", post.thread, post.id FROM post`+
+			` JOIN subscribe ON subscribe.thread = post.thread`+
+			` WHERE post.id = ? AND subscribe."user" <> post."user"`, post)
+		return err
+	})
+	return count, err
+}
+
+func (s *PostgresStore) ListNotifications(email string, unread bool, opts ListOptions) ([]rs.Notification, error) {
+	query := `SELECT n.id, n.thread, n.post, post."user", n.isRead, to_char(n.date, 'YYYY-MM-DD HH24:MI:SS') FROM notification n` +
+		` JOIN post ON post.id = n.post WHERE n."user" = ?`
+	if unread {
+		query += " AND NOT n.isRead"
+	}
+	args := []interface{}{email}
+	query = listClauses(query, &args, opts, "notification n", "n.id", "n.date", "n.id")
+
+	return queryNotifications(s.db, rebind(query), args...)
+}
+
+func (s *PostgresStore) CountUnread(email string) (int64, error) {
+	return queryCount(s.db, `SELECT COUNT(*) FROM notification WHERE "user" = $1 AND NOT isRead`, email)
+}
+
+func (s *PostgresStore) MarkRead(email string, ids []int64) (int64, error) {
+	query := `UPDATE notification SET isRead = TRUE WHERE "user" = ? AND NOT isRead`
+	args := []interface{}{email}
+	if ids != nil {
+		query += " AND id = ANY(?)"
+		args = append(args, pq.Array(ids))
+	}
+
+	return s.exec(query, args...)
+}
+
+// ======================
+// Search here
+// ======================
+
+// tsquery that wants all terms
+func pgTsquery(terms []string) string {
+	return strings.Join(terms, " & ")
+}
+
+// The documents are the expressions of the GIN indexes (migration 0006)
+const (
+	pgThreadDocument = `to_tsvector('simple', thread.title || ' ' || thread.message)`
+	pgPostDocument   = `to_tsvector('simple', post.message)`
+)
+
+func (s *PostgresStore) SearchThreads(opts SearchOptions) ([]rs.ThreadHit, error) {
+	tsquery := pgTsquery(opts.Terms)
+	score := "ts_rank(" + pgThreadDocument + ", to_tsquery('simple', ?))"
+
+	query := "SELECT " + pgThreadColumns + ", " + score + " AS score FROM thread" +
+		" WHERE " + pgThreadDocument + " @@ to_tsquery('simple', ?) AND NOT thread.isdeleted"
+	args := []interface{}{tsquery, tsquery}
+	query = searchClauses(query, &args, opts, "thread.forum", `thread."user"`, "thread.date")
+
+	if opts.After != 0 {
+		query += " AND (" + score + ", thread.id) < (SELECT " + score + ", thread.id FROM thread WHERE thread.id = ?)"
+		args = append(args, tsquery, tsquery, opts.After)
+	}
+
+	query += " ORDER BY score DESC, thread.id DESC" + limitClause(opts.Limit)
+	return queryThreadHits(s.db, rebind(query), args...)
+}
+
+func (s *PostgresStore) SearchPosts(opts SearchOptions) ([]rs.PostHit, error) {
+	tsquery := pgTsquery(opts.Terms)
+	score := "ts_rank(" + pgPostDocument + ", to_tsquery('simple', ?))"
+
+	query := "SELECT " + pgPostColumns + ", " + score + " AS score FROM post" +
+		" WHERE " + pgPostDocument + " @@ to_tsquery('simple', ?) AND NOT post.isdeleted AND NOT post.isspam"
+	args := []interface{}{tsquery, tsquery}
+	query = searchClauses(query, &args, opts, "post.forum", `post."user"`, "post.date")
+
+	if opts.After != 0 {
+		query += " AND (" + score + ", post.id) < (SELECT " + score + ", post.id FROM post WHERE post.id = ?)"
+		args = append(args, tsquery, tsquery, opts.After)
+	}
+
+	query += " ORDER BY score DESC, post.id DESC" + limitClause(opts.Limit)
+	return queryPostHits(s.db, rebind(query), args...)
+}
+
+// ======================
+// Information here
+// ======================
+
+func (s *PostgresStore) Status() (*rs.StatusHandler, error) {
+	status := &rs.StatusHandler{}
+
+	counts := map[string]*int64{"users": &status.User, "thread": &status.Thread, "forum": &status.Forum, "post": &status.Post}
+	for table, count := range counts {
+		var err error
+		if *count, err = queryCount(s.db, "SELECT COUNT(*) FROM "+table); err != nil {
+			return nil, err
+		}
+	}
+
+	return status, nil
+}
+
+func (s *PostgresStore) Clear() error {
+	_, err := s.exec("TRUNCATE follow, subscribe, notify_pending, notification, post_revision, thread_revision, post_vote, thread_vote, post, thread, forum, users")
+	return err
+}
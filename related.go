@@ -0,0 +1,233 @@
+package main
+
+import (
+	rs "technopark-db/response"
+)
+
+// =================
+// Related loading here
+// =================
+
+// The related=user|thread|forum expansions of a list page are loaded in
+// batches: one query per entity kind, plus three for the user lists,
+// however many rows the page has. Missing rows come back as empty details,
+// as from _getUserDetails and friends, and storage errors are returned to
+// the handler.
+
+func distinct(keys []string) []string {
+	seen := make(map[string]bool, len(keys))
+	list := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if !seen[key] {
+			seen[key] = true
+			list = append(list, key)
+		}
+	}
+	return list
+}
+
+// Fill followers, following and subscriptions of all users
+func fillUsersLists(store Store, users []rs.UserDetails) error {
+	emails := make([]string, len(users))
+	for i := range users {
+		emails[i] = users[i].Email
+	}
+	emails = distinct(emails)
+
+	followers, err := store.GetFollowersOf(emails)
+	if err != nil {
+		return err
+	}
+	following, err := store.GetFollowingOf(emails)
+	if err != nil {
+		return err
+	}
+	subscriptions, err := store.GetSubscriptionsOf(emails)
+	if err != nil {
+		return err
+	}
+
+	for i := range users {
+		email := users[i].Email
+
+		users[i].Followers = orEmpty(followers[email])
+		users[i].Following = orEmpty(following[email])
+
+		if list := subscriptions[email]; list != nil {
+			users[i].Subscriptions = list
+		} else {
+			users[i].Subscriptions = []int{}
+		}
+	}
+
+	return nil
+}
+
+// Empty lists are [] in the response, not null
+func orEmpty(list []string) []string {
+	if list == nil {
+		return []string{}
+	}
+	return list
+}
+
+// Users with their lists by email
+func loadUsers(store Store, emails []string) (map[string]*rs.UserDetails, error) {
+	emails = distinct(emails)
+
+	users, err := store.GetUsers(emails)
+	if err != nil {
+		return nil, err
+	}
+	if err := fillUsersLists(store, users); err != nil {
+		return nil, err
+	}
+
+	byEmail := make(map[string]*rs.UserDetails, len(emails))
+	for i := range users {
+		byEmail[users[i].Email] = &users[i]
+	}
+	for _, email := range emails {
+		if byEmail[email] == nil {
+			byEmail[email] = &rs.UserDetails{}
+		}
+	}
+
+	return byEmail, nil
+}
+
+func loadThreads(store Store, ids []int64) (map[int64]*rs.ThreadDetails, error) {
+	seen := make(map[int64]bool, len(ids))
+	list := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			list = append(list, id)
+		}
+	}
+
+	threads, err := store.GetThreads(list)
+	if err != nil {
+		return nil, err
+	}
+
+	byId := make(map[int64]*rs.ThreadDetails, len(list))
+	for i := range threads {
+		byId[threads[i].Id] = &threads[i]
+	}
+	for _, id := range list {
+		if byId[id] == nil {
+			byId[id] = &rs.ThreadDetails{}
+		}
+	}
+
+	return byId, nil
+}
+
+func loadForums(store Store, shortNames []string) (map[string]*rs.ForumDetails, error) {
+	shortNames = distinct(shortNames)
+
+	forums, err := store.GetForums(shortNames)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]*rs.ForumDetails, len(shortNames))
+	for i := range forums {
+		byName[forums[i].Short_Name] = &forums[i]
+	}
+	for _, shortName := range shortNames {
+		if byName[shortName] == nil {
+			byName[shortName] = &rs.ForumDetails{}
+		}
+	}
+
+	return byName, nil
+}
+
+// Replace the user and forum of threads with their details, as asked by
+// the related query param
+func relateThreads(store Store, threads []*rs.ThreadDetails, related []string) error {
+	if stringInSlice("user", related) {
+		emails := make([]string, len(threads))
+		for key := range threads {
+			emails[key] = threads[key].User.(string)
+		}
+
+		users, err := loadUsers(store, emails)
+		if err != nil {
+			return err
+		}
+		for key := range threads {
+			threads[key].User = users[threads[key].User.(string)]
+		}
+	}
+
+	if stringInSlice("forum", related) {
+		shortNames := make([]string, len(threads))
+		for key := range threads {
+			shortNames[key] = threads[key].Forum.(string)
+		}
+
+		forums, err := loadForums(store, shortNames)
+		if err != nil {
+			return err
+		}
+		for key := range threads {
+			threads[key].Forum = forums[threads[key].Forum.(string)]
+		}
+	}
+
+	return nil
+}
+
+// Replace the user, thread and forum of posts with their details, as asked
+// by the related query param
+func relatePosts(store Store, posts []*rs.PostDetails, related []string) error {
+	if stringInSlice("user", related) {
+		emails := make([]string, len(posts))
+		for key := range posts {
+			emails[key] = posts[key].User.(string)
+		}
+
+		users, err := loadUsers(store, emails)
+		if err != nil {
+			return err
+		}
+		for key := range posts {
+			posts[key].User = users[posts[key].User.(string)]
+		}
+	}
+
+	if stringInSlice("thread", related) {
+		ids := make([]int64, len(posts))
+		for key := range posts {
+			ids[key] = posts[key].Thread.(int64)
+		}
+
+		threads, err := loadThreads(store, ids)
+		if err != nil {
+			return err
+		}
+		for key := range posts {
+			posts[key].Thread = threads[posts[key].Thread.(int64)]
+		}
+	}
+
+	if stringInSlice("forum", related) {
+		shortNames := make([]string, len(posts))
+		for key := range posts {
+			shortNames[key] = posts[key].Forum.(string)
+		}
+
+		forums, err := loadForums(store, shortNames)
+		if err != nil {
+			return err
+		}
+		for key := range posts {
+			posts[key].Forum = forums[posts[key].Forum.(string)]
+		}
+	}
+
+	return nil
+}
@@ -1,5 +1,7 @@
 package response
 
+import "encoding/json"
+
 type RespStruct interface {
 	Foo() bool
 }
@@ -65,12 +67,12 @@ type UserListPosts struct {
 func (instance *UserListPosts) Foo() bool { return true }
 
 type UserCreate struct {
-	Username    string `json:"username"`
-	About       string `json:"about"`
-	Name        string `json:"name"`
-	Id          int64  `json:"id"`
-	IsAnonymous bool   `json:"isAnonymous"`
-	Email       string `json:"email"`
+	Username    *string `json:"username"`
+	About       *string `json:"about"`
+	Name        *string `json:"name"`
+	Id          int64   `json:"id"`
+	IsAnonymous bool    `json:"isAnonymous"`
+	Email       string  `json:"email"`
 }
 
 func (instance *UserCreate) Foo() bool { return true }
@@ -377,3 +379,121 @@ type ClearHandler struct {
 }
 
 func (instance *ClearHandler) Foo() bool { return true }
+
+// SlowQuery is one statement of the slow query log, times in milliseconds.
+// Args and Plan are those of its slowest run.
+type SlowQuery struct {
+	Query string        `json:"query"`
+	Args  []interface{} `json:"args,omitempty"`
+	Count int64         `json:"count"`
+	Max   float64       `json:"max"`
+	Total float64       `json:"total"`
+	Last  string        `json:"last"`
+	Plan  []string      `json:"plan"`
+}
+
+func (instance *SlowQuery) Foo() bool { return true }
+
+// VoteDetails is the vote of one user on a thread or post. Id only orders
+// the list, it is not part of the response.
+type VoteDetails struct {
+	Id   int64  `json:"-"`
+	User string `json:"user"`
+	Vote int    `json:"vote"`
+	Date string `json:"date"`
+}
+
+func (instance *VoteDetails) Foo() bool { return true }
+
+// Revision is the text of a thread or post from before an edit, with who
+// made the edit and when. Posts have no slug.
+type Revision struct {
+	Id      int64   `json:"id"`
+	Message string  `json:"message"`
+	Slug    *string `json:"slug,omitempty"`
+	Editor  *string `json:"editor"`
+	Date    string  `json:"date"`
+}
+
+func (instance *Revision) Foo() bool { return true }
+
+// ThreadHit is a thread found by a search with its score. Highlight has the
+// title and message if the words were found in them, in <b> tags.
+type ThreadHit struct {
+	ThreadDetails
+	Score     float64           `json:"score"`
+	Highlight map[string]string `json:"highlight"`
+}
+
+// PostHit is a post found by a search, as ThreadHit
+type PostHit struct {
+	PostDetails
+	Score     float64           `json:"score"`
+	Highlight map[string]string `json:"highlight"`
+}
+
+// FeedItem is a thread or a post in the feed of a user, type tells which.
+// Key only orders the feed, it is not part of the response.
+type FeedItem struct {
+	Key    int64          `json:"-"`
+	Type   string         `json:"type"`
+	Thread *ThreadDetails `json:"thread,omitempty"`
+	Post   *PostDetails   `json:"post,omitempty"`
+}
+
+func (instance *FeedItem) Foo() bool { return true }
+
+// Notification tells a subscriber of a thread about a post in it by
+// another user, the author
+type Notification struct {
+	Id     int64  `json:"id"`
+	Thread int64  `json:"thread"`
+	Post   int64  `json:"post"`
+	Author string `json:"author"`
+	IsRead bool   `json:"isRead"`
+	Date   string `json:"date"`
+}
+
+func (instance *Notification) Foo() bool { return true }
+
+// Notifications is a page of the notifications of a user with the number
+// of the unread ones, on the page or not
+type Notifications struct {
+	Unread        int64          `json:"unread"`
+	Notifications []Notification `json:"notifications"`
+}
+
+func (instance *Notifications) Foo() bool { return true }
+
+// NotificationsRead is the answer to markRead: how many notifications it
+// marked and how many are still unread
+type NotificationsRead struct {
+	User   string `json:"user"`
+	Marked int64  `json:"marked"`
+	Unread int64  `json:"unread"`
+}
+
+func (instance *NotificationsRead) Foo() bool { return true }
+
+// Follow is a follow of one user by another as live events carry it
+type Follow struct {
+	Follower string `json:"follower"`
+	Followee string `json:"followee"`
+}
+
+func (instance *Follow) Foo() bool { return true }
+
+// LiveMessage is a message of the live gateway to a client, type tells
+// which fields it has: event (channels, event, data), subscribed and
+// unsubscribed (channels), dropped (dropped), error (code, msg) or pong.
+type LiveMessage struct {
+	Type     string          `json:"type"`
+	Channels []string        `json:"channels,omitempty"`
+	Event    string          `json:"event,omitempty"`
+	Data     json.RawMessage `json:"data,omitempty"`
+	Dropped  int64           `json:"dropped,omitempty"`
+	Code     int             `json:"code,omitempty"`
+	Msg      string          `json:"msg,omitempty"`
+}
+
+func (instance *LiveMessage) Foo() bool { return true }
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+)
+
+// =================
+// Revisions here
+// =================
+
+// Revision table of a target and its columns in scanRevision order, but for
+// the date which every store formats its own way. Posts have no slug.
+func revisionTable(target string) (table, columns string, err error) {
+	switch target {
+	case "thread":
+		return "thread_revision", "r.id, r.message, r.slug, r.editor", nil
+	case "post":
+		return "post_revision", "r.id, r.message, NULL, r.editor", nil
+	}
+	return "", "", fmt.Errorf("no revisions of %q", target)
+}
+
+// Revisions of a thread or post whose id is in the query param named target
+func listRevisions(ir *InputRequest, store Store, target string) string {
+	// Validate query values
+	if len(ir.query[target]) != 1 {
+		return createInvalidResponse()
+	}
+	id, ok := parseId(ir.query[target][0])
+	if !ok {
+		return createInvalidResponse()
+	}
+
+	// Optional params
+	opts, ok := ir.listOptions("desc", "since")
+	if !ok {
+		return createInvalidResponse()
+	}
+	page := newPager(&opts)
+
+	// the target has to exist, an empty list is a target nobody edited
+	var err error
+	if target == "thread" {
+		_, err = store.GetThread(id)
+	} else {
+		_, err = store.GetPost(id)
+	}
+	if err != nil {
+		return createErrorResponse(ir, err)
+	}
+
+	revisions, err := store.ListRevisions(target, id, opts)
+	if err != nil {
+		return createErrorResponse(ir, err)
+	}
+
+	revisions = revisions[:page.cut(len(revisions), func(i int) int64 { return revisions[i].Id })]
+
+	responseInterface := make([]interface{}, len(revisions))
+	for i, r := range revisions {
+		responseInterface[i] = r
+	}
+
+	return page.response(0, responseInterface)
+}
+
+// Put the text of a revision back on its thread or post, the id of which is
+// in the json field named target, and answer with details of it. The text
+// replaced becomes a revision too.
+func revert(ir *InputRequest, store Store, target string, details func(id int64) string) string {
+	if !validateJson(ir, target, "revision") {
+		return createInvalidJsonResponse(ir)
+	}
+
+	if !checkFloat64Type(ir.json[target]) || !checkFloat64Type(ir.json["revision"]) {
+		return createInvalidJsonResponse(ir)
+	}
+
+	id := int64(ir.json[target].(float64))
+	revisionId := int64(ir.json["revision"].(float64))
+
+	editor, ok := userParam(ir)
+	if !ok {
+		return createInvalidJsonResponse(ir)
+	}
+
+	err := store.Tx(func(tx Store) error {
+		revision, err := tx.GetRevision(target, id, revisionId)
+		if err != nil {
+			return err
+		}
+
+		if target == "thread" {
+			return tx.UpdateThread(id, revision.Message, *revision.Slug, editor)
+		}
+		return tx.UpdatePost(id, revision.Message, editor)
+	})
+	if err != nil {
+		return createErrorResponse(ir, err)
+	}
+
+	return details(id)
+}
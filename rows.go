@@ -0,0 +1,406 @@
+package main
+
+import (
+	"database/sql"
+	"strings"
+
+	rs "technopark-db/response"
+)
+
+// ======================
+// Row scanning here
+// ======================
+
+// rowScanner is a *sql.Row or *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// Columns read by the scan functions, in scan order. MySQL and SQLite
+// share these names, PostgreSQL has its own lists (see postgres.go).
+const (
+	userColumns   = "user.id, user.username, user.about, user.name, user.email, user.isAnonymous"
+	forumColumns  = "forum.id, forum.name, forum.short_name, forum.user"
+	threadColumns = "thread.id, thread.forum, thread.title, thread.isClosed, thread.user, thread.date, thread.message, thread.slug, thread.isDeleted, thread.likes, thread.dislikes, thread.points, thread.posts"
+	postColumns   = "post.id, post.thread, post.message, post.user, post.forum, post.date, post.isApproved, post.isHighlighted, post.isEdited, post.isSpam, post.isDeleted, post.likes, post.dislikes, post.points"
+)
+
+// sql.ErrNoRows of a single row query is ErrNotFound
+func notFound(err error) error {
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	return err
+}
+
+func nullString(value sql.NullString) *string {
+	if !value.Valid {
+		return nil
+	}
+	return &value.String
+}
+
+func nullInt64(value sql.NullInt64) *int64 {
+	if !value.Valid {
+		return nil
+	}
+	return &value.Int64
+}
+
+func scanUser(row rowScanner) (*rs.UserDetails, error) {
+	user := &rs.UserDetails{}
+	var username, about, name sql.NullString
+
+	err := row.Scan(&user.Id, &username, &about, &name, &user.Email, &user.IsAnonymous)
+	if err != nil {
+		return nil, err
+	}
+
+	user.Username = nullString(username)
+	user.About = nullString(about)
+	user.Name = nullString(name)
+
+	return user, nil
+}
+
+func scanForum(row rowScanner) (*rs.ForumDetails, error) {
+	forum := &rs.ForumDetails{}
+	var user string
+
+	err := row.Scan(&forum.Id, &forum.Name, &forum.Short_Name, &user)
+	if err != nil {
+		return nil, err
+	}
+
+	forum.User = user
+	return forum, nil
+}
+
+// Scan threadColumns followed by extra
+func scanThread(row rowScanner, extra ...interface{}) (*rs.ThreadDetails, error) {
+	thread := &rs.ThreadDetails{}
+	var forum, user string
+
+	dest := []interface{}{&thread.Id, &forum, &thread.Title, &thread.IsClosed, &user, &thread.Date, &thread.Message,
+		&thread.Slug, &thread.IsDeleted, &thread.Likes, &thread.Dislikes, &thread.Points, &thread.Posts}
+
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+
+	thread.Forum = forum
+	thread.User = user
+	return thread, nil
+}
+
+// Scan postColumns followed by the backend's parent columns into extra
+func scanPost(row rowScanner, extra ...interface{}) (*rs.PostDetails, error) {
+	post := &rs.PostDetails{}
+	var thread int64
+	var user, forum string
+
+	dest := []interface{}{&post.Id, &thread, &post.Message, &user, &forum, &post.Date, &post.IsApproved, &post.IsHighlighted,
+		&post.IsEdited, &post.IsSpam, &post.IsDeleted, &post.Likes, &post.Dislikes, &post.Points}
+
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+
+	post.Thread = thread
+	post.User = user
+	post.Forum = forum
+	return post, nil
+}
+
+// Vote columns: id, user, vote, date
+func scanVote(row rowScanner) (*rs.VoteDetails, error) {
+	vote := new(rs.VoteDetails)
+	err := row.Scan(&vote.Id, &vote.User, &vote.Vote, &vote.Date)
+	if err != nil {
+		return nil, err
+	}
+	return vote, nil
+}
+
+// Notification columns: id, thread, post, author, isRead, date
+func scanNotification(row rowScanner) (*rs.Notification, error) {
+	notification := new(rs.Notification)
+	err := row.Scan(&notification.Id, &notification.Thread, &notification.Post, &notification.Author, &notification.IsRead, &notification.Date)
+	if err != nil {
+		return nil, err
+	}
+	return notification, nil
+}
+
+func scanRevision(row rowScanner) (*rs.Revision, error) {
+	revision := new(rs.Revision)
+	var slug, editor sql.NullString
+
+	err := row.Scan(&revision.Id, &revision.Message, &slug, &editor, &revision.Date)
+	if err != nil {
+		return nil, err
+	}
+
+	revision.Slug = nullString(slug)
+	revision.Editor = nullString(editor)
+	return revision, nil
+}
+
+// Run query and call scan for every row
+func queryRows(db querier, scan func(rows *sql.Rows) error, query string, args ...interface{}) error {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func queryUsers(db querier, query string, args ...interface{}) ([]rs.UserDetails, error) {
+	users := make([]rs.UserDetails, 0)
+
+	err := queryRows(db, func(rows *sql.Rows) error {
+		user, err := scanUser(rows)
+		if err == nil {
+			users = append(users, *user)
+		}
+		return err
+	}, query, args...)
+
+	return users, err
+}
+
+func queryForums(db querier, query string, args ...interface{}) ([]rs.ForumDetails, error) {
+	forums := make([]rs.ForumDetails, 0)
+
+	err := queryRows(db, func(rows *sql.Rows) error {
+		forum, err := scanForum(rows)
+		if err == nil {
+			forums = append(forums, *forum)
+		}
+		return err
+	}, query, args...)
+
+	return forums, err
+}
+
+func queryThreads(db querier, query string, args ...interface{}) ([]rs.ThreadDetails, error) {
+	threads := make([]rs.ThreadDetails, 0)
+
+	err := queryRows(db, func(rows *sql.Rows) error {
+		thread, err := scanThread(rows)
+		if err == nil {
+			threads = append(threads, *thread)
+		}
+		return err
+	}, query, args...)
+
+	return threads, err
+}
+
+// Posts with a nullable parent id as the last column
+func queryPosts(db querier, query string, args ...interface{}) ([]rs.PostDetails, error) {
+	posts := make([]rs.PostDetails, 0)
+
+	err := queryRows(db, func(rows *sql.Rows) error {
+		var parent sql.NullInt64
+
+		post, err := scanPost(rows, &parent)
+		if err == nil {
+			post.Parent = nullInt64(parent)
+			posts = append(posts, *post)
+		}
+		return err
+	}, query, args...)
+
+	return posts, err
+}
+
+// Threads with the search score as the last column
+func queryThreadHits(db querier, query string, args ...interface{}) ([]rs.ThreadHit, error) {
+	hits := make([]rs.ThreadHit, 0)
+
+	err := queryRows(db, func(rows *sql.Rows) error {
+		var score float64
+
+		thread, err := scanThread(rows, &score)
+		if err == nil {
+			hits = append(hits, rs.ThreadHit{ThreadDetails: *thread, Score: score})
+		}
+		return err
+	}, query, args...)
+
+	return hits, err
+}
+
+// Posts with the parent id and the search score as the last columns
+func queryPostHits(db querier, query string, args ...interface{}) ([]rs.PostHit, error) {
+	hits := make([]rs.PostHit, 0)
+
+	err := queryRows(db, func(rows *sql.Rows) error {
+		var parent sql.NullInt64
+		var score float64
+
+		post, err := scanPost(rows, &parent, &score)
+		if err == nil {
+			post.Parent = nullInt64(parent)
+			hits = append(hits, rs.PostHit{PostDetails: *post, Score: score})
+		}
+		return err
+	}, query, args...)
+
+	return hits, err
+}
+
+func queryVotes(db querier, query string, args ...interface{}) ([]rs.VoteDetails, error) {
+	votes := make([]rs.VoteDetails, 0)
+
+	err := queryRows(db, func(rows *sql.Rows) error {
+		vote, err := scanVote(rows)
+		if err == nil {
+			votes = append(votes, *vote)
+		}
+		return err
+	}, query, args...)
+
+	return votes, err
+}
+
+func queryRevisions(db querier, query string, args ...interface{}) ([]rs.Revision, error) {
+	revisions := make([]rs.Revision, 0)
+
+	err := queryRows(db, func(rows *sql.Rows) error {
+		revision, err := scanRevision(rows)
+		if err == nil {
+			revisions = append(revisions, *revision)
+		}
+		return err
+	}, query, args...)
+
+	return revisions, err
+}
+
+func queryNotifications(db querier, query string, args ...interface{}) ([]rs.Notification, error) {
+	notifications := make([]rs.Notification, 0)
+
+	err := queryRows(db, func(rows *sql.Rows) error {
+		notification, err := scanNotification(rows)
+		if err == nil {
+			notifications = append(notifications, *notification)
+		}
+		return err
+	}, query, args...)
+
+	return notifications, err
+}
+
+func queryStrings(db querier, query string, args ...interface{}) ([]string, error) {
+	list := make([]string, 0)
+
+	err := queryRows(db, func(rows *sql.Rows) error {
+		var value string
+		err := rows.Scan(&value)
+		if err == nil {
+			list = append(list, value)
+		}
+		return err
+	}, query, args...)
+
+	return list, err
+}
+
+func queryInts(db querier, query string, args ...interface{}) ([]int, error) {
+	list := make([]int, 0)
+
+	err := queryRows(db, func(rows *sql.Rows) error {
+		var value int
+		err := rows.Scan(&value)
+		if err == nil {
+			list = append(list, value)
+		}
+		return err
+	}, query, args...)
+
+	return list, err
+}
+
+func queryInt64s(db querier, query string, args ...interface{}) ([]int64, error) {
+	list := make([]int64, 0)
+
+	err := queryRows(db, func(rows *sql.Rows) error {
+		var value int64
+		err := rows.Scan(&value)
+		if err == nil {
+			list = append(list, value)
+		}
+		return err
+	}, query, args...)
+
+	return list, err
+}
+
+func queryCount(db querier, query string, args ...interface{}) (int64, error) {
+	var count int64
+	err := db.QueryRow(query, args...).Scan(&count)
+	return count, err
+}
+
+// Group the (key, value) rows of query by key
+func queryStringGroups(db querier, query string, args ...interface{}) (map[string][]string, error) {
+	groups := make(map[string][]string)
+
+	err := queryRows(db, func(rows *sql.Rows) error {
+		var key, value string
+		err := rows.Scan(&key, &value)
+		if err == nil {
+			groups[key] = append(groups[key], value)
+		}
+		return err
+	}, query, args...)
+
+	return groups, err
+}
+
+func queryIntGroups(db querier, query string, args ...interface{}) (map[string][]int, error) {
+	groups := make(map[string][]int)
+
+	err := queryRows(db, func(rows *sql.Rows) error {
+		var key string
+		var value int
+		err := rows.Scan(&key, &value)
+		if err == nil {
+			groups[key] = append(groups[key], value)
+		}
+		return err
+	}, query, args...)
+
+	return groups, err
+}
+
+// Placeholders of an IN list of n values, "(?, ?, ?)"
+func inList(n int) string {
+	return "(" + strings.TrimSuffix(strings.Repeat("?, ", n), ", ") + ")"
+}
+
+func stringArgs(keys []string) []interface{} {
+	args := make([]interface{}, len(keys))
+	for i, key := range keys {
+		args[i] = key
+	}
+	return args
+}
+
+func int64Args(keys []int64) []interface{} {
+	args := make([]interface{}, len(keys))
+	for i, key := range keys {
+		args[i] = key
+	}
+	return args
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"html"
+	"math"
+	"strings"
+	"unicode"
+
+	rs "technopark-db/response"
+)
+
+// =================
+// Search here
+// =================
+
+// Words of text in lower case, in order. A word is a run of letters and
+// digits, as for the FULLTEXT parsers of the SQL backends.
+func searchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(c rune) bool {
+		return !unicode.IsLetter(c) && !unicode.IsDigit(c)
+	})
+}
+
+// Distinct words of a search query
+func searchTerms(text string) []string {
+	terms := make([]string, 0)
+	for _, word := range searchWords(text) {
+		if !stringInSlice(word, terms) {
+			terms = append(terms, word)
+		}
+	}
+	return terms
+}
+
+// Snippets of a highlight, in runes
+const (
+	snippetBefore = 40  // context before the first word found
+	snippetLength = 200 // at most, but for the last word found
+)
+
+// Snippet of text around the first of the terms, with the terms in <b>
+// tags and the rest HTML escaped. false when no term is in text.
+func highlight(text string, terms []string) (string, bool) {
+	runes := []rune(text)
+
+	var found [][2]int // start and end of the words found
+	for i := 0; i < len(runes); {
+		if !unicode.IsLetter(runes[i]) && !unicode.IsDigit(runes[i]) {
+			i++
+			continue
+		}
+
+		j := i
+		for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j])) {
+			j++
+		}
+		if stringInSlice(strings.ToLower(string(runes[i:j])), terms) {
+			found = append(found, [2]int{i, j})
+		}
+		i = j
+	}
+
+	if len(found) == 0 {
+		return "", false
+	}
+
+	start := found[0][0] - snippetBefore
+	if start < 0 {
+		start = 0
+	}
+	end := start + snippetLength
+	if end > len(runes) {
+		end = len(runes)
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("...")
+	}
+
+	pos := start
+	for _, word := range found {
+		if word[0] >= end {
+			break
+		}
+		if word[1] > end {
+			end = word[1]
+		}
+
+		b.WriteString(html.EscapeString(string(runes[pos:word[0]])))
+		b.WriteString("<b>" + html.EscapeString(string(runes[word[0]:word[1]])) + "</b>")
+		pos = word[1]
+	}
+	b.WriteString(html.EscapeString(string(runes[pos:end])))
+
+	if end < len(runes) {
+		b.WriteString("...")
+	}
+	return b.String(), true
+}
+
+// Highlights of the fields of a hit that have the terms
+func highlights(terms []string, fields ...string) map[string]string {
+	result := make(map[string]string)
+	for i := 0; i+1 < len(fields); i += 2 {
+		if snippet, ok := highlight(fields[i+1], terms); ok {
+			result[fields[i]] = snippet
+		}
+	}
+	return result
+}
+
+// Append the forum, user and date filters of opts on the given columns
+func searchClauses(query string, args *[]interface{}, opts SearchOptions, forum, user, date string) string {
+	if opts.Forum != "" {
+		query += " AND " + forum + " = ?"
+		*args = append(*args, opts.Forum)
+	}
+	if opts.User != "" {
+		query += " AND " + user + " = ?"
+		*args = append(*args, opts.User)
+	}
+	if opts.Since != "" {
+		query += " AND " + date + " > ?"
+		*args = append(*args, opts.Since)
+	}
+	if opts.Until != "" {
+		query += " AND " + date + " <= ?"
+		*args = append(*args, opts.Until)
+	}
+
+	return query
+}
+
+// Read query, forum, user, since, until, limit and cursor from the query
+// string of a search
+func (ir *InputRequest) searchOptions() (SearchOptions, bool) {
+	var opts SearchOptions
+
+	if len(ir.query["query"]) != 1 {
+		return opts, false
+	}
+	opts.Terms = searchTerms(ir.query["query"][0])
+	if len(opts.Terms) == 0 {
+		return opts, false
+	}
+
+	var ok bool
+	if opts.ListOptions, ok = ir.listOptions("", "since"); !ok {
+		return opts, false
+	}
+	opts.Order = ""
+
+	if len(ir.query["forum"]) >= 1 {
+		opts.Forum = ir.query["forum"][0]
+	}
+	if len(ir.query["user"]) >= 1 {
+		opts.User = ir.query["user"][0]
+	}
+	if len(ir.query["until"]) >= 1 {
+		opts.Until = ir.query["until"][0]
+	}
+
+	return opts, true
+}
+
+func searchThreads(ir *InputRequest, store Store) string {
+	opts, ok := ir.searchOptions()
+	if !ok {
+		return createInvalidResponse()
+	}
+	page := newPager(&opts.ListOptions)
+
+	hits, err := store.SearchThreads(opts)
+	if err != nil {
+		return createErrorResponse(ir, err)
+	}
+
+	hits = hits[:page.cut(len(hits), func(i int) int64 { return hits[i].Id })]
+
+	threads := make([]*rs.ThreadDetails, len(hits))
+	for i := range hits {
+		hits[i].Highlight = highlights(opts.Terms, "title", hits[i].Title, "message", hits[i].Message)
+		threads[i] = &hits[i].ThreadDetails
+	}
+	if err := relateThreads(store, threads, ir.query["related"]); err != nil {
+		return createErrorResponse(ir, err)
+	}
+
+	responseInterface := make([]interface{}, len(hits))
+	for i, v := range hits {
+		responseInterface[i] = v
+	}
+
+	return page.response(0, responseInterface)
+}
+
+func searchPosts(ir *InputRequest, store Store) string {
+	opts, ok := ir.searchOptions()
+	if !ok {
+		return createInvalidResponse()
+	}
+	page := newPager(&opts.ListOptions)
+
+	hits, err := store.SearchPosts(opts)
+	if err != nil {
+		return createErrorResponse(ir, err)
+	}
+
+	hits = hits[:page.cut(len(hits), func(i int) int64 { return hits[i].Id })]
+
+	posts := make([]*rs.PostDetails, len(hits))
+	for i := range hits {
+		hits[i].Highlight = highlights(opts.Terms, "message", hits[i].Message)
+		posts[i] = &hits[i].PostDetails
+	}
+	if err := relatePosts(store, posts, ir.query["related"]); err != nil {
+		return createErrorResponse(ir, err)
+	}
+
+	responseInterface := make([]interface{}, len(hits))
+	for i, v := range hits {
+		responseInterface[i] = v
+	}
+
+	return page.response(0, responseInterface)
+}
+
+// ======================
+// Inverted index here
+// ======================
+
+// textIndex finds documents by the words of their text. MemoryStore has no
+// FULLTEXT index to lean on and keeps one for threads and one for posts;
+// invertedIndex is the plain one, another (stemming, n-grams) can take its
+// place in reset.
+type textIndex interface {
+	add(id int64, text string)
+	remove(id int64, text string)
+
+	// Documents having all terms, with their scores, higher is better
+	search(terms []string) map[int64]float64
+}
+
+// invertedIndex maps words to the documents having them
+type invertedIndex struct {
+	postings map[string]map[int64]int // word -> document -> times
+	lengths  map[int64]int            // document -> words
+}
+
+func newInvertedIndex() *invertedIndex {
+	return &invertedIndex{
+		postings: make(map[string]map[int64]int),
+		lengths:  make(map[int64]int),
+	}
+}
+
+func (x *invertedIndex) add(id int64, text string) {
+	words := searchWords(text)
+	for _, word := range words {
+		if x.postings[word] == nil {
+			x.postings[word] = make(map[int64]int)
+		}
+		x.postings[word][id]++
+	}
+	x.lengths[id] += len(words)
+}
+
+// Take back an add of the same id and text
+func (x *invertedIndex) remove(id int64, text string) {
+	words := searchWords(text)
+	for _, word := range words {
+		documents := x.postings[word]
+		if documents[id]--; documents[id] <= 0 {
+			delete(documents, id)
+		}
+		if len(documents) == 0 {
+			delete(x.postings, word)
+		}
+	}
+
+	if x.lengths[id] -= len(words); x.lengths[id] <= 0 {
+		delete(x.lengths, id)
+	}
+}
+
+// Scores are tf-idf: for every term the share of the document's words it
+// makes, weighted by how rare the term is among all documents
+func (x *invertedIndex) search(terms []string) map[int64]float64 {
+	scores := make(map[int64]float64)
+	if len(terms) == 0 {
+		return scores
+	}
+
+	// the documents of the rarest term are the candidates
+	rarest := x.postings[terms[0]]
+	for _, term := range terms[1:] {
+		if len(x.postings[term]) < len(rarest) {
+			rarest = x.postings[term]
+		}
+	}
+
+	n := float64(len(x.lengths))
+
+candidates:
+	for id := range rarest {
+		var score float64
+		for _, term := range terms {
+			times := x.postings[term][id]
+			if times == 0 {
+				continue candidates
+			}
+			idf := math.Log(1 + n/float64(len(x.postings[term])))
+			score += float64(times) / float64(x.lengths[id]) * idf
+		}
+		scores[id] = score
+	}
+
+	return scores
+}
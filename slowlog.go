@@ -0,0 +1,206 @@
+package main
+
+import (
+	"database/sql"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	rs "technopark-db/response"
+)
+
+// =================
+// Slow query log here
+// =================
+
+// slowLog keeps the statements that ran longer than a threshold, one entry
+// per query text with the args and plan of its slowest run. When it is full
+// a new query replaces the fastest entry if it is slower. The args hold
+// emails and messages, top hands them out only with showArgs.
+type slowLog struct {
+	threshold atomic.Int64 // time.Duration, 0 records nothing
+
+	mu       sync.Mutex
+	size     int
+	showArgs bool
+	entries  map[string]*rs.SlowQuery
+
+	explain    func(query string, args []interface{}) ([]string, error) // nil without EXPLAIN
+	explaining chan struct{}                                            // one EXPLAIN at a time
+}
+
+// Statements of every store go through timedQuerier, and so here
+var slowQueries = &slowLog{entries: make(map[string]*rs.SlowQuery)}
+
+func (l *slowLog) configure(threshold time.Duration, size int, showArgs bool, explain func(query string, args []interface{}) ([]string, error)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.size = size
+	l.showArgs = showArgs
+	l.explain = explain
+	l.explaining = make(chan struct{}, 1)
+	l.threshold.Store(int64(threshold))
+}
+
+func (l *slowLog) observe(query string, args []interface{}, d time.Duration) {
+	threshold := time.Duration(l.threshold.Load())
+	if threshold == 0 || d < threshold {
+		return
+	}
+
+	slog.Warn("slow query", "query", query, "args", slowArgs(args), "duration", d.String())
+
+	ms := float64(d.Microseconds()) / 1000
+
+	l.mu.Lock()
+	entry := l.entries[query]
+	if entry == nil {
+		if len(l.entries) >= l.size && !l.evictFasterThan(ms) {
+			l.mu.Unlock()
+			return
+		}
+
+		entry = &rs.SlowQuery{Query: query}
+		l.entries[query] = entry
+	}
+
+	entry.Count++
+	entry.Total += ms
+	entry.Last = time.Now().Format("2006-01-02 15:04:05")
+
+	slowest := ms > entry.Max
+	if slowest {
+		entry.Max = ms
+		entry.Args = slowArgs(args)
+		entry.Plan = nil
+	}
+	explain := l.explain
+	l.mu.Unlock()
+
+	if slowest && explain != nil && strings.HasPrefix(queryLabel(query), "SELECT") {
+		go l.capturePlan(explain, query, args)
+	}
+}
+
+// Drop the fastest entry if it is faster than ms, called with mu held
+func (l *slowLog) evictFasterThan(ms float64) bool {
+	var fastest *rs.SlowQuery
+	for _, entry := range l.entries {
+		if fastest == nil || entry.Max < fastest.Max {
+			fastest = entry
+		}
+	}
+
+	if fastest == nil || fastest.Max >= ms {
+		return false
+	}
+
+	delete(l.entries, fastest.Query)
+	return true
+}
+
+// Run EXPLAIN on the pool, not in the unit of work of the query. Plans
+// are skipped while another one is running.
+func (l *slowLog) capturePlan(explain func(query string, args []interface{}) ([]string, error), query string, args []interface{}) {
+	select {
+	case l.explaining <- struct{}{}:
+		defer func() { <-l.explaining }()
+	default:
+		return
+	}
+
+	plan, err := explain(query, args)
+	if err != nil {
+		slog.Warn("can't explain slow query", "query", query, "error", err)
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if entry := l.entries[query]; entry != nil {
+		entry.Plan = plan
+	}
+}
+
+// Slowest n entries, slowest first, without args unless showArgs
+func (l *slowLog) top(n int) []rs.SlowQuery {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	list := make([]rs.SlowQuery, 0, len(l.entries))
+	for _, entry := range l.entries {
+		item := *entry
+		if !l.showArgs {
+			item.Args = nil
+		}
+		list = append(list, item)
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Max > list[j].Max })
+
+	if n < len(list) {
+		list = list[:n]
+	}
+	return list
+}
+
+// Copy of args for the log, long strings (post messages) cut
+func slowArgs(args []interface{}) []interface{} {
+	list := make([]interface{}, len(args))
+	for i, arg := range args {
+		if value, ok := arg.(string); ok && len(value) > 64 {
+			arg = value[:64] + "..."
+		}
+		list[i] = arg
+	}
+	return list
+}
+
+// EXPLAIN of a query on db, one "column=value" line per plan row
+func explainer(driver string, db *sql.DB) func(query string, args []interface{}) ([]string, error) {
+	prefix := "EXPLAIN "
+	if driver == "sqlite" {
+		prefix = "EXPLAIN QUERY PLAN "
+	}
+
+	return func(query string, args []interface{}) ([]string, error) {
+		rows, err := db.Query(prefix+query, args...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		columns, err := rows.Columns()
+		if err != nil {
+			return nil, err
+		}
+
+		plan := make([]string, 0)
+		values := make([]sql.NullString, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+
+		for rows.Next() {
+			if err := rows.Scan(dest...); err != nil {
+				return nil, err
+			}
+
+			var line []string
+			for i, value := range values {
+				if value.Valid {
+					line = append(line, columns[i]+"="+value.String)
+				}
+			}
+			plan = append(plan, strings.Join(line, " "))
+		}
+
+		return plan, rows.Err()
+	}
+}
@@ -0,0 +1,783 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	rs "technopark-db/response"
+
+	sqlite3 "github.com/mattn/go-sqlite3"
+)
+
+// =================
+// SQLite storage here
+// =================
+
+// SqliteStore serves the API from a single file. Posts keep the base92
+// materialized paths of the MySQL schema in post.parent.
+type SqliteStore struct {
+	db   querier
+	conn *sql.DB // nil inside a unit of work
+}
+
+// Post columns with the parent id resolved from the path of the parent post
+const (
+	sqlitePostFrom = " FROM post" +
+		" LEFT JOIN post pp ON length(post.parent) > 5 AND pp.parent = substr(post.parent, 1, length(post.parent) - 5)"
+	sqlitePostSelect = "SELECT " + postColumns + ", pp.id" + sqlitePostFrom
+)
+
+func NewSqliteStore(db *sql.DB) *SqliteStore {
+	return &SqliteStore{db: timed(db), conn: db}
+}
+
+// Run fn on a store bound to one transaction, or on s when it already is
+func (s *SqliteStore) atomic(fn func(tx *SqliteStore) error) error {
+	if s.conn == nil {
+		return fn(s)
+	}
+	return runTx(s.conn, func(tx *sql.Tx) error { return fn(&SqliteStore{db: timed(tx)}) })
+}
+
+func (s *SqliteStore) Tx(fn func(tx Store) error) error {
+	return s.atomic(func(tx *SqliteStore) error { return fn(tx) })
+}
+
+// Map SQLite constraint errors to storage errors
+func sqliteError(err error) error {
+	if driverErr, ok := err.(sqlite3.Error); ok {
+		switch driverErr.ExtendedCode {
+		case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey:
+			return fmt.Errorf("%w: %v", ErrDuplicate, err)
+		case sqlite3.ErrConstraintForeignKey:
+			return fmt.Errorf("%w: %v", ErrForeignKey, err)
+		}
+	}
+	return err
+}
+
+func (s *SqliteStore) exec(query string, args ...interface{}) (*ExecResponse, error) {
+	resp, err := execQuery(query, &args, s.db)
+	if err != nil {
+		return nil, sqliteError(err)
+	}
+	return resp, nil
+}
+
+// ======================
+// Users here
+// ======================
+
+func (s *SqliteStore) CreateUser(user *rs.UserDetails) error {
+	query := "INSERT INTO user (id, username, about, name, email, isAnonymous) VALUES((SELECT IFNULL(MAX(id), 0) + 1 FROM user), ?, ?, ?, ?, ?)"
+
+	dbResp, err := s.exec(query, user.Username, user.About, user.Name, user.Email, user.IsAnonymous)
+	if err != nil {
+		return err
+	}
+
+	return s.db.QueryRow("SELECT id FROM user WHERE rowid = ?", dbResp.lastId).Scan(&user.Id)
+}
+
+func (s *SqliteStore) GetUser(email string) (*rs.UserDetails, error) {
+	user, err := scanUser(s.db.QueryRow("SELECT "+userColumns+" FROM user WHERE email = ?", email))
+	return user, notFound(err)
+}
+
+func (s *SqliteStore) GetUsers(emails []string) ([]rs.UserDetails, error) {
+	if len(emails) == 0 {
+		return []rs.UserDetails{}, nil
+	}
+	return queryUsers(s.db, "SELECT "+userColumns+" FROM user WHERE email IN "+inList(len(emails)), stringArgs(emails)...)
+}
+
+func (s *SqliteStore) UpdateUser(email, about, name string) error {
+	_, err := s.exec("UPDATE user SET about = ?, name = ? WHERE email = ?", about, name, email)
+	return err
+}
+
+func (s *SqliteStore) listUsers(query string, email string, opts ListOptions) ([]rs.UserDetails, error) {
+	args := []interface{}{email}
+	query = listClauses(query, &args, opts, "user", "user.id", "user.date", "user.date")
+
+	return queryUsers(s.db, query, args...)
+}
+
+func (s *SqliteStore) ListFollowers(email string, opts ListOptions) ([]rs.UserDetails, error) {
+	query := "SELECT " + userColumns + " FROM user JOIN follow ON user.email = follow.follower WHERE follow.followee = ?"
+
+	return s.listUsers(query, email, opts)
+}
+
+func (s *SqliteStore) ListFollowing(email string, opts ListOptions) ([]rs.UserDetails, error) {
+	query := "SELECT " + userColumns + " FROM user JOIN follow ON user.email = follow.followee WHERE follow.follower = ?"
+
+	return s.listUsers(query, email, opts)
+}
+
+// ======================
+// Follows here
+// ======================
+
+func (s *SqliteStore) Follow(follower, followee string) error {
+	_, err := s.exec("INSERT INTO follow (follower, followee) VALUES(?, ?)", follower, followee)
+	return err
+}
+
+func (s *SqliteStore) Unfollow(follower, followee string) error {
+	_, err := s.exec("DELETE FROM follow WHERE follower = ? AND followee = ?", follower, followee)
+	return err
+}
+
+func (s *SqliteStore) GetFollowers(email string) ([]string, error) {
+	return queryStrings(s.db, "SELECT follower FROM follow WHERE followee = ? ORDER BY follower", email)
+}
+
+func (s *SqliteStore) GetFollowing(email string) ([]string, error) {
+	return queryStrings(s.db, "SELECT followee FROM follow WHERE follower = ? ORDER BY followee", email)
+}
+
+func (s *SqliteStore) GetFollowersOf(emails []string) (map[string][]string, error) {
+	if len(emails) == 0 {
+		return map[string][]string{}, nil
+	}
+	query := "SELECT followee, follower FROM follow WHERE followee IN " + inList(len(emails)) + " ORDER BY follower"
+	return queryStringGroups(s.db, query, stringArgs(emails)...)
+}
+
+func (s *SqliteStore) GetFollowingOf(emails []string) (map[string][]string, error) {
+	if len(emails) == 0 {
+		return map[string][]string{}, nil
+	}
+	query := "SELECT follower, followee FROM follow WHERE follower IN " + inList(len(emails)) + " ORDER BY followee"
+	return queryStringGroups(s.db, query, stringArgs(emails)...)
+}
+
+// ======================
+// Forums here
+// ======================
+
+func (s *SqliteStore) CreateForum(forum *rs.ForumCreate) error {
+	query := "INSERT INTO forum (id, name, short_name, user) VALUES((SELECT IFNULL(MAX(id), 0) + 1 FROM forum), ?, ?, ?)"
+
+	dbResp, err := s.exec(query, forum.Name, forum.Short_Name, forum.User)
+	if err != nil {
+		return err
+	}
+
+	return s.db.QueryRow("SELECT id FROM forum WHERE rowid = ?", dbResp.lastId).Scan(&forum.Id)
+}
+
+func (s *SqliteStore) GetForum(shortName string) (*rs.ForumDetails, error) {
+	forum, err := scanForum(s.db.QueryRow("SELECT "+forumColumns+" FROM forum WHERE short_name = ?", shortName))
+	return forum, notFound(err)
+}
+
+func (s *SqliteStore) GetForums(shortNames []string) ([]rs.ForumDetails, error) {
+	if len(shortNames) == 0 {
+		return []rs.ForumDetails{}, nil
+	}
+	return queryForums(s.db, "SELECT "+forumColumns+" FROM forum WHERE short_name IN "+inList(len(shortNames)), stringArgs(shortNames)...)
+}
+
+func (s *SqliteStore) ListForumUsers(forum string, opts ListOptions) ([]string, error) {
+	query := "SELECT u.email FROM user u WHERE u.email IN (SELECT DISTINCT p.user FROM post p WHERE p.forum = ?)"
+	args := []interface{}{forum}
+	query = listClauses(query, &args, opts, "user u", "u.id", "u.date", "COALESCE(u.name, '')")
+
+	return queryStrings(s.db, query, args...)
+}
+
+// ======================
+// Threads here
+// ======================
+
+func (s *SqliteStore) CreateThread(thread *rs.ThreadCreate) error {
+	query := "INSERT INTO thread (forum, title, isClosed, user, date, message, slug, isDeleted) VALUES(?, ?, ?, ?, ?, ?, ?, ?)"
+
+	dbResp, err := s.exec(query, thread.Forum, thread.Title, thread.IsClosed, thread.User, thread.Date, thread.Message, thread.Slug, thread.IsDeleted)
+	if err != nil {
+		return err
+	}
+
+	thread.Id = dbResp.lastId
+	return nil
+}
+
+func (s *SqliteStore) GetThread(id int64) (*rs.ThreadDetails, error) {
+	thread, err := scanThread(s.db.QueryRow("SELECT "+threadColumns+" FROM thread WHERE id = ?", id))
+	return thread, notFound(err)
+}
+
+func (s *SqliteStore) GetThreads(ids []int64) ([]rs.ThreadDetails, error) {
+	if len(ids) == 0 {
+		return []rs.ThreadDetails{}, nil
+	}
+	return queryThreads(s.db, "SELECT "+threadColumns+" FROM thread WHERE id IN "+inList(len(ids)), int64Args(ids)...)
+}
+
+func (s *SqliteStore) ListThreads(field, value string, opts ListOptions) ([]rs.ThreadDetails, error) {
+	if field != "user" && field != "forum" {
+		return nil, fmt.Errorf("can't list threads by %q", field)
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM thread WHERE thread.%s = ?", threadColumns, field)
+	args := []interface{}{value}
+	query = listClauses(query, &args, opts, "thread", "thread.id", "thread.date", "thread.date")
+
+	return queryThreads(s.db, query, args...)
+}
+
+func (s *SqliteStore) UpdateThread(id int64, message, slug string, editor *string) error {
+	return s.atomic(func(tx *SqliteStore) error {
+		var oldMessage, oldSlug string
+		err := tx.db.QueryRow("SELECT message, slug FROM thread WHERE id = ?", id).Scan(&oldMessage, &oldSlug)
+		if err == sql.ErrNoRows || err == nil && oldMessage == message && oldSlug == slug {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.exec("INSERT INTO thread_revision (thread, message, slug, editor) VALUES(?, ?, ?, ?)", id, oldMessage, oldSlug, editor)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.exec("UPDATE thread SET message = ?, slug = ? WHERE id = ?", message, slug, id)
+		return err
+	})
+}
+
+func (s *SqliteStore) VoteThread(id int64, vote int) error {
+	var query string
+
+	if vote > 0 {
+		query = "UPDATE thread SET likes = likes + 1, points = points + 1 WHERE id = ?"
+	} else {
+		query = "UPDATE thread SET dislikes = dislikes + 1, points = points - 1 WHERE id = ?"
+	}
+
+	_, err := s.exec(query, id)
+	return err
+}
+
+// Updates only count changed rows, as MySQL does
+func (s *SqliteStore) SetThreadClosed(id int64, closed bool) (bool, error) {
+	dbResp, err := s.exec("UPDATE thread SET isClosed = ? WHERE id = ? AND isClosed <> ?", closed, id, closed)
+	if err != nil {
+		return false, err
+	}
+	return dbResp.rowCount != 0, nil
+}
+
+func (s *SqliteStore) RemoveThread(id int64) (bool, error) {
+	var changed bool
+
+	err := s.atomic(func(tx *SqliteStore) error {
+		dbResp, err := tx.exec("UPDATE thread SET isDeleted = 1, posts = 0 WHERE id = ? AND (isDeleted = 0 OR posts <> 0)", id)
+		if err != nil {
+			return err
+		}
+		changed = dbResp.rowCount != 0
+
+		_, err = tx.exec("UPDATE post SET isDeleted = 1 WHERE thread = ?", id)
+		return err
+	})
+
+	return changed, err
+}
+
+func (s *SqliteStore) RestoreThread(id int64) (bool, error) {
+	var changed bool
+
+	err := s.atomic(func(tx *SqliteStore) error {
+		_, err := tx.exec("UPDATE post SET isDeleted = 0 WHERE thread = ?", id)
+		if err != nil {
+			return err
+		}
+
+		count := "(SELECT COUNT(*) FROM post p WHERE p.thread = thread.id AND p.isDeleted = 0)"
+		query := "UPDATE thread SET isDeleted = 0, posts = " + count + " WHERE id = ? AND (isDeleted = 1 OR posts <> " + count + ")"
+		dbResp, err := tx.exec(query, id)
+		if err != nil {
+			return err
+		}
+		changed = dbResp.rowCount != 0
+
+		return nil
+	})
+
+	return changed, err
+}
+
+func (s *SqliteStore) UpdateThreadPosts(id int64, delta int) error {
+	_, err := s.exec("UPDATE thread SET posts = posts + ? WHERE id = ?", delta, id)
+	return err
+}
+
+// ======================
+// Subscriptions here
+// ======================
+
+func (s *SqliteStore) Subscribe(thread int64, user string) error {
+	_, err := s.exec("INSERT INTO subscribe (thread, user) VALUES(?, ?)", thread, user)
+	return err
+}
+
+func (s *SqliteStore) Unsubscribe(thread int64, user string) (bool, error) {
+	dbResp, err := s.exec("DELETE FROM subscribe WHERE thread = ? AND user = ?", thread, user)
+	if err != nil {
+		return false, err
+	}
+	return dbResp.rowCount != 0, nil
+}
+
+func (s *SqliteStore) GetSubscriptions(email string) ([]int, error) {
+	return queryInts(s.db, "SELECT thread FROM subscribe WHERE user = ? ORDER BY thread asc", email)
+}
+
+func (s *SqliteStore) GetSubscriptionsOf(emails []string) (map[string][]int, error) {
+	if len(emails) == 0 {
+		return map[string][]int{}, nil
+	}
+	query := "SELECT user, thread FROM subscribe WHERE user IN " + inList(len(emails)) + " ORDER BY thread asc"
+	return queryIntGroups(s.db, query, stringArgs(emails)...)
+}
+
+// ======================
+// Posts here
+// ======================
+
+// Materialized path of a new child of parent: parent path + next base92
+// segment, counted in the parent row. Units take the write lock when they
+// begin (_txlock=immediate), so no two replies read the same count.
+func (s *SqliteStore) childPath(parent int64) (string, error) {
+	_, err := s.exec("UPDATE post SET children = children + 1 WHERE id = ?", parent)
+	if err != nil {
+		return "", err
+	}
+
+	var parentPath string
+	var children int
+
+	err = s.db.QueryRow("SELECT parent, children FROM post WHERE id = ?", parent).Scan(&parentPath, &children)
+	if err != nil {
+		return "", notFound(err)
+	}
+
+	return parentPath + toBase92(children), nil
+}
+
+// Insert and path update are one unit, a post never keeps a NULL path
+func (s *SqliteStore) CreatePost(post *rs.PostCreate, parent *int64) error {
+	return s.atomic(func(tx *SqliteStore) error {
+		var path interface{}
+
+		if parent != nil {
+			child, err := tx.childPath(*parent)
+			if err != nil {
+				return err
+			}
+			path = child
+		}
+
+		query := "INSERT INTO post (thread, message, user, forum, date, isApproved, isHighlighted, isEdited, isSpam, isDeleted, parent) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+
+		dbResp, err := tx.exec(query, int64(post.Thread), post.Message, post.User, post.Forum, post.Date,
+			post.IsApproved, post.IsHighlighted, post.IsEdited, post.IsSpam, post.IsDeleted, path)
+		if err != nil {
+			return err
+		}
+
+		post.Id = dbResp.lastId
+
+		// root posts start their own path
+		if parent == nil {
+			_, err = tx.exec("UPDATE post SET parent = ? WHERE id = ?", toBase92(int(post.Id)), post.Id)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s *SqliteStore) GetPost(id int64) (*rs.PostDetails, error) {
+	var parent sql.NullInt64
+
+	post, err := scanPost(s.db.QueryRow(sqlitePostSelect+" WHERE post.id = ?", id), &parent)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	post.Parent = nullInt64(parent)
+	return post, nil
+}
+
+func (s *SqliteStore) ListPosts(field, value string, opts ListOptions) ([]rs.PostDetails, error) {
+	if field != "thread" && field != "user" && field != "forum" {
+		return nil, fmt.Errorf("can't list posts by %q", field)
+	}
+
+	query := fmt.Sprintf("%s WHERE post.%s = ?", sqlitePostSelect, field)
+	args := []interface{}{value}
+	query = listClauses(query, &args, opts, "post", "post.id", "post.date", "post.date")
+
+	return queryPosts(s.db, query, args...)
+}
+
+func sqliteRoot(path string) string { return "substr(" + path + ", 1, 5)" }
+
+func (s *SqliteStore) ListPostsTree(thread int64, opts ListOptions) ([]rs.PostDetails, error) {
+	query := sqlitePostSelect + " WHERE post.thread = ?"
+	args := []interface{}{thread}
+
+	// roots in requested order, children by path
+	query = sinceClauses(query, &args, opts, "post.id", "post.date")
+	query = treeAfterClause(query, &args, opts, "post.parent", "(SELECT a.parent FROM post a WHERE a.id = ?)", sqliteRoot)
+	query += " ORDER BY substr(post.parent, 1, 5) " + opts.Order + ", post.parent asc"
+	query += limitClause(opts.Limit)
+
+	return queryPosts(s.db, query, args...)
+}
+
+func (s *SqliteStore) ListPostsParentTree(thread int64, opts ListOptions) ([]rs.PostDetails, error) {
+	// limit applies to root posts, subtrees come in the same query
+	roots := "SELECT parent FROM post WHERE thread = ? AND length(parent) = 5"
+	args := []interface{}{thread}
+	roots = sinceClauses(roots, &args, opts, "id", "date")
+	roots = afterClause(roots, &args, opts, "post", "id", "parent")
+	roots += " ORDER BY parent " + opts.Order
+	roots += limitClause(opts.Limit)
+
+	query := sqlitePostSelect + " WHERE post.thread = ? AND substr(post.parent, 1, 5) IN (" + roots + ")" +
+		" ORDER BY substr(post.parent, 1, 5) " + opts.Order + ", post.parent asc"
+	args = append([]interface{}{thread}, args...)
+
+	return queryPosts(s.db, query, args...)
+}
+
+func (s *SqliteStore) UpdatePost(id int64, message string, editor *string) error {
+	return s.atomic(func(tx *SqliteStore) error {
+		var oldMessage string
+		err := tx.db.QueryRow("SELECT message FROM post WHERE id = ?", id).Scan(&oldMessage)
+		if err == sql.ErrNoRows || err == nil && oldMessage == message {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.exec("INSERT INTO post_revision (post, message, editor) VALUES(?, ?, ?)", id, oldMessage, editor)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.exec("UPDATE post SET message = ?, isEdited = 1 WHERE id = ?", message, id)
+		return err
+	})
+}
+
+func (s *SqliteStore) VotePost(id int64, vote int) error {
+	var query string
+
+	if vote > 0 {
+		query = "UPDATE post SET likes = likes + 1, points = points + 1 WHERE id = ?"
+	} else {
+		query = "UPDATE post SET dislikes = dislikes + 1, points = points - 1 WHERE id = ?"
+	}
+
+	_, err := s.exec(query, id)
+	return err
+}
+
+func (s *SqliteStore) SetPostDeleted(id int64, deleted bool) (bool, error) {
+	dbResp, err := s.exec("UPDATE post SET isDeleted = ? WHERE id = ? AND isDeleted <> ?", deleted, id, deleted)
+	if err != nil {
+		return false, err
+	}
+	return dbResp.rowCount != 0, nil
+}
+
+// ======================
+// Votes here
+// ======================
+
+// Units take the write lock when they begin, so the old vote can't change
+// before the counters move
+func (s *SqliteStore) SetVote(target string, id int64, user string, vote int) error {
+	table, err := voteTable(target)
+	if err != nil {
+		return err
+	}
+
+	return s.atomic(func(tx *SqliteStore) error {
+		err := tx.db.QueryRow(fmt.Sprintf("SELECT id FROM %s WHERE id = ?", target), id).Scan(new(int64))
+		if err != nil {
+			return notFound(err)
+		}
+
+		var old int
+		err = tx.db.QueryRow(fmt.Sprintf("SELECT vote FROM %s WHERE %s = ? AND user = ?", table, target), id, user).Scan(&old)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+
+		switch {
+		case vote == old:
+			return nil
+		case vote == 0:
+			_, err = tx.exec(fmt.Sprintf("DELETE FROM %s WHERE %s = ? AND user = ?", table, target), id, user)
+		case old == 0:
+			_, err = tx.exec(fmt.Sprintf("INSERT INTO %s (%s, user, vote) VALUES(?, ?, ?)", table, target), id, user, vote)
+		default:
+			_, err = tx.exec(fmt.Sprintf("UPDATE %s SET vote = ?, date = CURRENT_TIMESTAMP WHERE %s = ? AND user = ?", table, target), vote, id, user)
+		}
+		if err != nil {
+			return err
+		}
+
+		likes, dislikes, points := voteDelta(old, vote)
+		_, err = tx.exec(fmt.Sprintf("UPDATE %s SET likes = likes + ?, dislikes = dislikes + ?, points = points + ? WHERE id = ?", target),
+			likes, dislikes, points, id)
+		return err
+	})
+}
+
+func (s *SqliteStore) ListVotes(target string, id int64, opts ListOptions) ([]rs.VoteDetails, error) {
+	table, err := voteTable(target)
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf("SELECT v.id, v.user, v.vote, v.date FROM %s v WHERE v.%s = ?", table, target)
+	args := []interface{}{id}
+	query = listClauses(query, &args, opts, table+" v", "v.id", "v.date", "v.date")
+
+	return queryVotes(s.db, query, args...)
+}
+
+// ======================
+// Revisions here
+// ======================
+
+func (s *SqliteStore) ListRevisions(target string, id int64, opts ListOptions) ([]rs.Revision, error) {
+	table, columns, err := revisionTable(target)
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf("SELECT %s, r.date FROM %s r WHERE r.%s = ?", columns, table, target)
+	args := []interface{}{id}
+	query = listClauses(query, &args, opts, table+" r", "r.id", "r.date", "r.date")
+
+	return queryRevisions(s.db, query, args...)
+}
+
+func (s *SqliteStore) GetRevision(target string, id, revision int64) (*rs.Revision, error) {
+	table, columns, err := revisionTable(target)
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf("SELECT %s, r.date FROM %s r WHERE r.id = ? AND r.%s = ?", columns, table, target)
+	result, err := scanRevision(s.db.QueryRow(query, revision, id))
+	return result, notFound(err)
+}
+
+// ======================
+// Feed here
+// ======================
+
+func (s *SqliteStore) ListFeed(email string, opts ListOptions) ([]rs.FeedItem, error) {
+	var afterDate string
+	if opts.After != 0 {
+		table, id := feedRow(opts.After)
+		err := s.db.QueryRow("SELECT date FROM "+table+" WHERE id = ?", id).Scan(&afterDate)
+		if err == sql.ErrNoRows {
+			return []rs.FeedItem{}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var args []interface{}
+	keys, err := queryInt64s(s.db, feedQuery(&args, email, opts, afterDate, "user"), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return feedItems(keys, s.GetThreads, func(ids []int64) ([]rs.PostDetails, error) {
+		return queryPosts(s.db, sqlitePostSelect+" WHERE post.id IN "+inList(len(ids)), int64Args(ids)...)
+	})
+}
+
+// ======================
+// Notifications here
+// ======================
+
+func (s *SqliteStore) MarkNotify(post int64) error {
+	_, err := s.exec("INSERT INTO notify_pending (post) VALUES (?)", post)
+	return err
+}
+
+func (s *SqliteStore) PendingNotify(after int64, limit int) ([]int64, error) {
+	return queryInt64s(s.db, "SELECT post FROM notify_pending WHERE post > ? ORDER BY post LIMIT ?", after, limit)
+}
+
+func (s *SqliteStore) NotifySubscribers(post int64) (int64, error) {
+	var count int64
+	err := s.atomic(func(tx *SqliteStore) error {
+		// whoever deletes the mark notifies
+		dbResp, err := tx.exec("DELETE FROM notify_pending WHERE post = ?", post)
+		if err != nil || dbResp.rowCount == 0 {
+			return err
+		}
+
+		dbResp, err = tx.exec("INSERT INTO notification (user, thread, post)"+
+			" SELECT subscribe.user, post.thread, post.id FROM post"+
+			" JOIN subscribe ON subscribe.thread = post.thread"+
+			" WHERE post.id = ? AND subscribe.user <> post.user", post)
+		if err != nil {
+			return err
+		}
+		count = dbResp.rowCount
+		return nil
+	})
+	return count, err
+}
+
+func (s *SqliteStore) ListNotifications(email string, unread bool, opts ListOptions) ([]rs.Notification, error) {
+	query := "SELECT n.id, n.thread, n.post, post.user, n.isRead, n.date FROM notification n" +
+		" JOIN post ON post.id = n.post WHERE n.user = ?"
+	if unread {
+		query += " AND NOT n.isRead"
+	}
+	args := []interface{}{email}
+	query = listClauses(query, &args, opts, "notification n", "n.id", "n.date", "n.id")
+
+	return queryNotifications(s.db, query, args...)
+}
+
+func (s *SqliteStore) CountUnread(email string) (int64, error) {
+	return queryCount(s.db, "SELECT COUNT(*) FROM notification WHERE user = ? AND NOT isRead", email)
+}
+
+func (s *SqliteStore) MarkRead(email string, ids []int64) (int64, error) {
+	query := "UPDATE notification SET isRead = 1 WHERE user = ? AND NOT isRead"
+	args := []interface{}{email}
+	if ids != nil {
+		if len(ids) == 0 {
+			return 0, nil
+		}
+		query += " AND id IN " + inList(len(ids))
+		args = append(args, int64Args(ids)...)
+	}
+
+	dbResp, err := s.exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return dbResp.rowCount, nil
+}
+
+// ======================
+// Search here
+// ======================
+
+// FTS query that wants all terms
+func sqliteMatch(terms []string) string {
+	return `"` + strings.Join(terms, `" "`) + `"`
+}
+
+// Score of a row of an FTS table found by MATCH: the number of times the
+// terms are in it, from the 4 numbers per term found that offsets gives
+func sqliteScore(table string) string {
+	offsets := "offsets(" + table + ")"
+	return fmt.Sprintf("(length(%s) - length(replace(%s, ' ', '')) + 1) / 4", offsets, offsets)
+}
+
+func (s *SqliteStore) SearchThreads(opts SearchOptions) ([]rs.ThreadHit, error) {
+	match := sqliteMatch(opts.Terms)
+	score := sqliteScore("thread_fts")
+
+	query := "SELECT " + threadColumns + ", " + score + " AS score FROM thread" +
+		" JOIN thread_fts ON thread_fts.docid = thread.id" +
+		" WHERE thread_fts MATCH ? AND NOT thread.isDeleted"
+	args := []interface{}{match}
+	query = searchClauses(query, &args, opts, "thread.forum", "thread.user", "thread.date")
+
+	if opts.After != 0 {
+		query += " AND (" + score + ", thread.id) < (SELECT " + score + ", docid FROM thread_fts WHERE thread_fts MATCH ? AND docid = ?)"
+		args = append(args, match, opts.After)
+	}
+
+	query += " ORDER BY score DESC, thread.id DESC" + limitClause(opts.Limit)
+	return queryThreadHits(s.db, query, args...)
+}
+
+func (s *SqliteStore) SearchPosts(opts SearchOptions) ([]rs.PostHit, error) {
+	match := sqliteMatch(opts.Terms)
+	score := sqliteScore("post_fts")
+
+	query := "SELECT " + postColumns + ", pp.id, " + score + " AS score" + sqlitePostFrom +
+		" JOIN post_fts ON post_fts.docid = post.id" +
+		" WHERE post_fts MATCH ? AND NOT post.isDeleted AND NOT post.isSpam"
+	args := []interface{}{match}
+	query = searchClauses(query, &args, opts, "post.forum", "post.user", "post.date")
+
+	if opts.After != 0 {
+		query += " AND (" + score + ", post.id) < (SELECT " + score + ", docid FROM post_fts WHERE post_fts MATCH ? AND docid = ?)"
+		args = append(args, match, opts.After)
+	}
+
+	query += " ORDER BY score DESC, post.id DESC" + limitClause(opts.Limit)
+	return queryPostHits(s.db, query, args...)
+}
+
+// ======================
+// Information here
+// ======================
+
+func (s *SqliteStore) Status() (*rs.StatusHandler, error) {
+	status := &rs.StatusHandler{}
+
+	counts := map[string]*int64{"user": &status.User, "thread": &status.Thread, "forum": &status.Forum, "post": &status.Post}
+	for table, count := range counts {
+		var err error
+		if *count, err = queryCount(s.db, "SELECT COUNT(*) FROM "+table); err != nil {
+			return nil, err
+		}
+	}
+
+	return status, nil
+}
+
+func (s *SqliteStore) Clear() error {
+	queries := []string{
+		"DELETE FROM follow",
+		"DELETE FROM subscribe",
+		"DELETE FROM notify_pending",
+		"DELETE FROM notification",
+		"DELETE FROM post_revision",
+		"DELETE FROM thread_revision",
+		"DELETE FROM post_vote",
+		"DELETE FROM thread_vote",
+		"DELETE FROM post",
+		"DELETE FROM thread",
+		"DELETE FROM forum",
+		"DELETE FROM user",
+	}
+
+	for _, query := range queries {
+		if _, err := s.exec(query); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+
+	rs "technopark-db/response"
+)
+
+// =================
+// Storage here
+// =================
+
+var (
+	// ErrNotFound is returned by getters when the requested row does not exist
+	ErrNotFound = errors.New("not found")
+
+	// ErrDuplicate is returned when a unique key already exists (MySQL error 1062)
+	ErrDuplicate = errors.New("duplicate entry")
+
+	// ErrForeignKey is returned when a referenced row does not exist (MySQL error 1452)
+	ErrForeignKey = errors.New("foreign key constraint fails")
+)
+
+// ListOptions holds the optional params shared by the list methods.
+//
+// Rows are listed by their sort key (date, name or tree path) and then by
+// id, or by id alone without an order, so every row has one place in the
+// list and After can point into it.
+type ListOptions struct {
+	Since   string // only rows with date > Since, empty for any
+	SinceId int64  // only rows with id >= SinceId, 0 for any
+	After   int64  // only rows after the row with this id, 0 for any
+	Order   string // "asc", "desc" or empty for id order
+	Limit   int    // -1 for no limit
+}
+
+// SearchOptions holds the params of a full-text search. Matches are ranked
+// by a score of the backend's own, best first, and then by id, newest
+// first; After points into that order.
+type SearchOptions struct {
+	ListOptions // Since, After and Limit; SinceId and Order are not used
+
+	Terms []string // lower case words, a match has all of them
+	Forum string   // "" for any
+	User  string   // "" for any
+	Until string   // only rows with date <= Until, empty for any
+}
+
+// Store is the storage backend behind the API handlers.
+//
+// Getters return ErrNotFound for missing rows, writes return ErrDuplicate or
+// ErrForeignKey for constraint violations. Methods returning a bool report
+// whether a row was actually changed. Batch getters (GetUsers, GetFollowersOf
+// ...) take distinct keys, skip missing rows and leave out empty lists.
+type Store interface {
+	// users
+	CreateUser(user *rs.UserDetails) error
+	GetUser(email string) (*rs.UserDetails, error)
+	GetUsers(emails []string) ([]rs.UserDetails, error)
+	UpdateUser(email, about, name string) error
+	ListFollowers(email string, opts ListOptions) ([]rs.UserDetails, error)
+	ListFollowing(email string, opts ListOptions) ([]rs.UserDetails, error)
+
+	// follows
+	Follow(follower, followee string) error
+	Unfollow(follower, followee string) error
+	GetFollowers(email string) ([]string, error)
+	GetFollowing(email string) ([]string, error)
+	GetFollowersOf(emails []string) (map[string][]string, error)
+	GetFollowingOf(emails []string) (map[string][]string, error)
+
+	// forums
+	CreateForum(forum *rs.ForumCreate) error
+	GetForum(shortName string) (*rs.ForumDetails, error)
+	GetForums(shortNames []string) ([]rs.ForumDetails, error)
+	ListForumUsers(forum string, opts ListOptions) ([]string, error)
+
+	// threads
+	CreateThread(thread *rs.ThreadCreate) error
+	GetThread(id int64) (*rs.ThreadDetails, error)
+	GetThreads(ids []int64) ([]rs.ThreadDetails, error)
+	ListThreads(field, value string, opts ListOptions) ([]rs.ThreadDetails, error)
+	UpdateThread(id int64, message, slug string, editor *string) error
+	VoteThread(id int64, vote int) error
+	SetThreadClosed(id int64, closed bool) (bool, error)
+	RemoveThread(id int64) (bool, error)
+	RestoreThread(id int64) (bool, error)
+	UpdateThreadPosts(id int64, delta int) error
+
+	// subscriptions
+	Subscribe(thread int64, user string) error
+	Unsubscribe(thread int64, user string) (bool, error)
+	GetSubscriptions(email string) ([]int, error)
+	GetSubscriptionsOf(emails []string) (map[string][]int, error)
+
+	// posts
+	CreatePost(post *rs.PostCreate, parent *int64) error
+	GetPost(id int64) (*rs.PostDetails, error)
+	ListPosts(field, value string, opts ListOptions) ([]rs.PostDetails, error)
+	ListPostsTree(thread int64, opts ListOptions) ([]rs.PostDetails, error)
+	// limit and After count root posts, subtrees come whole
+	ListPostsParentTree(thread int64, opts ListOptions) ([]rs.PostDetails, error)
+	UpdatePost(id int64, message string, editor *string) error
+	VotePost(id int64, vote int) error
+	SetPostDeleted(id int64, deleted bool) (bool, error)
+
+	// votes of users, target is "thread" or "post"
+
+	// SetVote replaces the vote of user on the target, 1 or -1, or takes it
+	// back with 0, and moves the target's likes, dislikes and points by the
+	// difference. VoteThread and VotePost count anonymous votes, which the
+	// API only takes with -anonymous-votes.
+	SetVote(target string, id int64, user string, vote int) error
+	ListVotes(target string, id int64, opts ListOptions) ([]rs.VoteDetails, error)
+
+	// revisions, target is "thread" or "post"
+
+	// UpdateThread and UpdatePost keep the old text as a revision by editor,
+	// nil when unknown, if they change it. GetRevision returns ErrNotFound for
+	// a revision of another target.
+	ListRevisions(target string, id int64, opts ListOptions) ([]rs.Revision, error)
+	GetRevision(target string, id, revision int64) (*rs.Revision, error)
+
+	// feed
+
+	// ListFeed lists the threads and posts of the users email follows,
+	// deleted ones left out, newest first. After is a feed key (see
+	// feedKey); Since and Limit work as for lists, the order is always desc.
+	ListFeed(email string, opts ListOptions) ([]rs.FeedItem, error)
+
+	// notifications
+
+	// MarkNotify marks post pending, for its subscribers to be notified of
+	// it. Done in the unit of work that creates the post.
+	MarkNotify(post int64) error
+	// PendingNotify lists up to limit pending posts after the post after,
+	// oldest first.
+	PendingNotify(after int64, limit int) ([]int64, error)
+	// NotifySubscribers gives every user subscribed to the thread of post,
+	// but its author, a notification of it and returns how many it gave.
+	// The post is no longer pending after; one that is not gets nothing.
+	NotifySubscribers(post int64) (int64, error)
+	// ListNotifications lists the notifications of email by id, only the
+	// unread ones if unread; Since is on the date they were given.
+	ListNotifications(email string, unread bool, opts ListOptions) ([]rs.Notification, error)
+	CountUnread(email string) (int64, error)
+	// MarkRead marks the notifications ids of email read, all of them for
+	// nil ids, and returns how many of them were unread.
+	MarkRead(email string, ids []int64) (int64, error)
+
+	// search, deleted threads and deleted or spam posts are never found
+	SearchThreads(opts SearchOptions) ([]rs.ThreadHit, error)
+	SearchPosts(opts SearchOptions) ([]rs.PostHit, error)
+
+	// units of work
+
+	// Tx runs fn as one unit of work: the writes made through tx are
+	// committed if fn returns nil and rolled back otherwise.
+	Tx(fn func(tx Store) error) error
+
+	// information
+	Status() (*rs.StatusHandler, error)
+	Clear() error
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	rs "technopark-db/response"
+)
+
+// =================
+// Stress here
+// =================
+
+// Fire replies at one root post from parallel workers, the way post/create
+// does, then check the thread: every reply stored once, the counter right
+// and the tree in the order the paths were handed out. Returns the id of
+// the thread, also when a check fails.
+func stressReplies(store Store, w io.Writer, replies, workers int) (int64, error) {
+	stamp := strconv.FormatInt(time.Now().UnixNano(), 36)
+	date := time.Now().Format("2006-01-02 15:04:05")
+
+	user := &rs.UserDetails{Email: "stress" + stamp + "@example.com"}
+	if err := store.CreateUser(user); err != nil {
+		return 0, err
+	}
+
+	forum := &rs.ForumCreate{Name: "stress " + stamp, Short_Name: "stress" + stamp, User: user.Email}
+	if err := store.CreateForum(forum); err != nil {
+		return 0, err
+	}
+
+	thread := &rs.ThreadCreate{Forum: forum.Short_Name, Title: "stress", Slug: "stress" + stamp,
+		User: user.Email, Date: date, Message: "stress"}
+	if err := store.CreateThread(thread); err != nil {
+		return 0, err
+	}
+
+	newPost := func(parent *int64) (*rs.PostCreate, error) {
+		post := &rs.PostCreate{Forum: forum.Short_Name, Thread: float64(thread.Id), User: user.Email, Date: date, Message: "stress"}
+
+		err := store.Tx(func(tx Store) error {
+			if err := tx.CreatePost(post, parent); err != nil {
+				return err
+			}
+			return tx.UpdateThreadPosts(thread.Id, 1)
+		})
+		return post, err
+	}
+
+	root, err := newPost(nil)
+	if err != nil {
+		return thread.Id, err
+	}
+
+	jobs := make(chan int)
+	failures := make(chan error, replies)
+	var wg sync.WaitGroup
+
+	start := time.Now()
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range jobs {
+				if _, err := newPost(&root.Id); err != nil {
+					failures <- err
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < replies; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	close(failures)
+
+	fmt.Fprintf(w, "%d replies from %d workers in %v\n", replies, workers, time.Since(start))
+
+	failed := 0
+	for err := range failures {
+		if failed == 0 {
+			fmt.Fprintln(w, "first failure:", err)
+		}
+		failed++
+	}
+	if failed != 0 {
+		return thread.Id, fmt.Errorf("%d of %d replies failed", failed, replies)
+	}
+
+	// check here
+	details, err := store.GetThread(thread.Id)
+	if err != nil {
+		return thread.Id, err
+	}
+	if details.Posts != int64(replies+1) {
+		return thread.Id, fmt.Errorf("thread counter is %d, want %d", details.Posts, replies+1)
+	}
+
+	posts, err := store.ListPostsTree(thread.Id, ListOptions{Order: "asc", Limit: -1})
+	if err != nil {
+		return thread.Id, err
+	}
+	if len(posts) != replies+1 {
+		return thread.Id, fmt.Errorf("tree has %d posts, want %d", len(posts), replies+1)
+	}
+
+	// a reply takes its path segment and id under the same lock,
+	// so tree order is id order unless two replies got one path
+	for i := 1; i < len(posts); i++ {
+		if posts[i].Parent == nil || *posts[i].Parent != root.Id {
+			return thread.Id, fmt.Errorf("post %d is not a reply to %d", posts[i].Id, root.Id)
+		}
+		if posts[i].Id <= posts[i-1].Id {
+			return thread.Id, fmt.Errorf("post %d comes after %d in the tree", posts[i].Id, posts[i-1].Id)
+		}
+	}
+
+	fmt.Fprintf(w, "thread %d ok\n", thread.Id)
+	return thread.Id, nil
+}
+
+// stress [replies] [workers] against the configured database
+func stressCommand(config *Config, args []string) error {
+	replies, workers := 1000, 32
+
+	if len(args) > 2 {
+		return errors.New("usage: stress [replies] [workers]")
+	}
+	for i, value := range args {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("bad number %q", value)
+		}
+		if i == 0 {
+			replies = n
+		} else {
+			workers = n
+		}
+	}
+
+	store, db := openStore(config)
+	if db != nil {
+		defer db.Close()
+		db.SetMaxOpenConns(workers)
+
+		checkSchema(config.Storage, db)
+	}
+
+	_, err := stressReplies(store, os.Stdout, replies, workers)
+	return err
+}
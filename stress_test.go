@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// =================
+// Stress tests here
+// =================
+
+const stressTestReplies, stressTestWorkers = 500, 16
+
+// Run stressReplies, then check the paths and the replies of the root post
+// that the store keeps: paths of the thread by post id and the replies of
+// a post as the store counts them. The root is the first post of the
+// thread, the store need not be fresh.
+func testStressReplies(t *testing.T, store Store, paths func(thread int64) (map[int64]string, error), children func(post int64) (int, error)) {
+	var out bytes.Buffer
+	thread, err := stressReplies(store, &out, stressTestReplies, stressTestWorkers)
+	t.Log(out.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	byId, err := paths(thread)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(byId) != stressTestReplies+1 {
+		t.Fatalf("thread has %d posts, want %d", len(byId), stressTestReplies+1)
+	}
+
+	var root int64
+	seen := make(map[string]int64, len(byId))
+	for id, path := range byId {
+		if other, ok := seen[path]; ok {
+			t.Fatalf("posts %d and %d share the path %q", other, id, path)
+		}
+		seen[path] = id
+
+		if root == 0 || id < root {
+			root = id
+		}
+	}
+
+	count, err := children(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != stressTestReplies {
+		t.Fatalf("root post %d counts %d children, want %d", root, count, stressTestReplies)
+	}
+}
+
+// Open storage at dsn with a connection per worker and migrate it up
+func openStressStore(t *testing.T, storage, dsn string) (Store, *sql.DB) {
+	config := defaultConfig()
+	config.Storage = storage
+	config.DSN = dsn
+	config.MaxOpenConns = stressTestWorkers
+
+	store, db := openStore(config)
+	t.Cleanup(func() { db.Close() })
+
+	m, err := NewMigrator(storage, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(io.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	return store, db
+}
+
+// Paths of the thread read with query, which takes the thread id
+func queryStressPaths(db *sql.DB, query string) func(thread int64) (map[int64]string, error) {
+	return func(thread int64) (map[int64]string, error) {
+		rows, err := db.Query(query, thread)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		paths := make(map[int64]string)
+		for rows.Next() {
+			var id int64
+			var path string
+			if err := rows.Scan(&id, &path); err != nil {
+				return nil, err
+			}
+			paths[id] = path
+		}
+		return paths, rows.Err()
+	}
+}
+
+// Replies of a post read with query, which takes the post id
+func queryStressChildren(db *sql.DB, query string) func(post int64) (int, error) {
+	return func(post int64) (int, error) {
+		var children int
+		err := db.QueryRow(query, post).Scan(&children)
+		return children, err
+	}
+}
+
+func TestStressRepliesMemory(t *testing.T) {
+	t.Parallel()
+
+	store := NewMemoryStore()
+
+	testStressReplies(t, store,
+		func(thread int64) (map[int64]string, error) {
+			store.mu.RLock()
+			defer store.mu.RUnlock()
+
+			paths := make(map[int64]string)
+			for id, post := range store.posts {
+				if post.details.Thread.(int64) == thread {
+					paths[id] = post.path
+				}
+			}
+			return paths, nil
+		},
+		func(post int64) (int, error) {
+			store.mu.RLock()
+			defer store.mu.RUnlock()
+
+			return store.children[store.posts[post].path], nil
+		})
+}
+
+func TestStressRepliesSqlite(t *testing.T) {
+	t.Parallel()
+
+	store, db := openStressStore(t, "sqlite", filepath.Join(t.TempDir(), "stress.db"))
+
+	testStressReplies(t, store,
+		queryStressPaths(db, "SELECT id, parent FROM post WHERE thread = ?"),
+		queryStressChildren(db, "SELECT children FROM post WHERE id = ?"))
+}
+
+// The MySQL and Postgres databases are migrated up and keep the stress
+// rows, point the DSNs at throwaway ones.
+
+func TestStressRepliesMysql(t *testing.T) {
+	dsn := os.Getenv("TECHNOPARK_TEST_MYSQL_DSN")
+	if dsn == "" {
+		t.Skip("TECHNOPARK_TEST_MYSQL_DSN not set")
+	}
+	t.Parallel()
+
+	store, db := openStressStore(t, "mysql", dsn)
+
+	testStressReplies(t, store,
+		queryStressPaths(db, "SELECT id, parent FROM post WHERE thread = ?"),
+		queryStressChildren(db, "SELECT children FROM post WHERE id = ?"))
+}
+
+func TestStressRepliesPostgres(t *testing.T) {
+	dsn := os.Getenv("TECHNOPARK_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TECHNOPARK_TEST_POSTGRES_DSN not set")
+	}
+	t.Parallel()
+
+	store, db := openStressStore(t, "postgres", dsn)
+
+	// no counter here, paths end with the own id
+	testStressReplies(t, store,
+		queryStressPaths(db, "SELECT id, array_to_string(path, '.') FROM post WHERE thread = $1"),
+		queryStressChildren(db, "SELECT COUNT(*) FROM post WHERE parent = $1"))
+}
@@ -1,12 +1,8 @@
 package main
 
 import (
-	"database/sql"
-	"fmt"
 	"io"
-	"log"
 	"net/http"
-	"strconv"
 
 	rs "technopark-db/response"
 )
@@ -17,12 +13,11 @@ import (
 
 type Thread struct {
 	inputRequest *InputRequest
-	db           *sql.DB
+	store        Store
 }
 
-func (t *Thread) updateBoolBasic(query string, value bool) string {
-	args := Args{}
-
+// event is published to the thread's streams when update changes it
+func (t *Thread) updateBoolBasic(event string, update func(id int64) (bool, error)) string {
 	if !validateJson(t.inputRequest, "thread") {
 		return createInvalidJsonResponse(t.inputRequest)
 	}
@@ -33,17 +28,16 @@ func (t *Thread) updateBoolBasic(query string, value bool) string {
 
 	threadId := t.inputRequest.json["thread"].(float64)
 
-	args.append(value, threadId)
-
-	dbResp, err := execQuery(query, &args.data, t.db)
+	changed, err := update(int64(threadId))
 	if err != nil {
-		return createErrorResponse(err)
+		return createErrorResponse(t.inputRequest, err)
 	}
 
-	if dbResp.rowCount == 0 {
-		threadArgs := Args{}
-		threadArgs.append(threadId)
-		responseCode, responseMsg := t._getThreadDetails(threadArgs)
+	if !changed {
+		responseCode, responseMsg, err := t._getThreadDetails(int64(threadId))
+		if err != nil {
+			return createErrorResponse(t.inputRequest, err)
+		}
 
 		if responseCode != 0 {
 			return createNotExistResponse()
@@ -57,125 +51,76 @@ func (t *Thread) updateBoolBasic(query string, value bool) string {
 		Thread: threadId,
 	}
 
+	threadEvents.publish(int64(threadId), event, responseMsg)
+
 	return createResponse(responseCode, responseMsg)
 }
 
 func (t *Thread) close() string {
-	query := "UPDATE thread SET isClosed = ? WHERE id = ?"
-
-	return t.updateBoolBasic(query, true)
+	return t.updateBoolBasic("thread_close", func(id int64) (bool, error) {
+		return t.store.SetThreadClosed(id, true)
+	})
 }
 
 func (t *Thread) create() string {
 	var resp string
 	args := Args{}
 
-	query := "INSERT INTO thread (forum, title, isClosed, user, date, message, slug, isDeleted) VALUES(?, ?, ?, ?, ?, ?, ?, ?)"
-
 	if !validateJson(t.inputRequest, "forum", "title", "isClosed", "user", "date", "message", "slug") {
 		return createInvalidJsonResponse(t.inputRequest)
 	}
 
-	args.generateFromJson(&t.inputRequest.json, "forum", "title", "isClosed", "user", "date", "message", "slug")
-
-	// Validate isDeleted param
-	if !validateBoolParams(t.inputRequest.json, &args, "isDeleted") {
+	if !checkStringParams(t.inputRequest.json, "forum", "title", "user", "date", "message", "slug") {
 		return createInvalidJsonResponse(t.inputRequest)
 	}
 
-	dbResp, err := execQuery(query, &args.data, t.db)
-	if err != nil {
-		return createErrorResponse(err)
+	// Validate isClosed and isDeleted params
+	if !validateBoolParams(t.inputRequest.json, &args, "isClosed", "isDeleted") {
+		return createInvalidJsonResponse(t.inputRequest)
 	}
 
 	responseCode := 0
 	responseMsg := &rs.ThreadCreate{
 		Forum:     t.inputRequest.json["forum"].(string),
 		Title:     t.inputRequest.json["title"].(string),
-		Id:        dbResp.lastId,
 		User:      t.inputRequest.json["user"].(string),
 		Date:      t.inputRequest.json["date"].(string),
 		Message:   t.inputRequest.json["message"].(string),
 		Slug:      t.inputRequest.json["slug"].(string),
-		IsClosed:  t.inputRequest.json["isClosed"].(bool),
-		IsDeleted: t.inputRequest.json["isDeleted"].(bool),
+		IsClosed:  args.data[0].(bool),
+		IsDeleted: args.data[1].(bool),
+	}
+
+	err := t.store.CreateThread(responseMsg)
+	if err != nil {
+		return createErrorResponse(t.inputRequest, err)
 	}
 
 	resp = createResponse(responseCode, responseMsg)
 
-	log.Printf("Thread '#%d' created", responseMsg.Id)
+	t.inputRequest.log.Info("thread created", "thread", responseMsg.Id)
+
+	gateway.publish("thread_create", responseMsg,
+		forumChannel(responseMsg.Forum), threadChannel(responseMsg.Id), userChannel(responseMsg.User))
 
 	return resp
 }
 
-// Rewrite subquery
-func (t *Thread) _getThreadDetails(args Args) (int, *rs.ThreadDetails) {
-	query := "SELECT t.* FROM thread t WHERE t.id = ?"
-
-	getThread := selectQuery(query, &args.data, t.db)
+// Code 1 and empty details for a missing thread, storage errors are returned
+func (t *Thread) _getThreadDetails(id int64) (int, *rs.ThreadDetails, error) {
+	responseMsg, err := t.store.GetThread(id)
 
-	if getThread.rows == 0 {
+	if err == ErrNotFound {
 		responseCode := 1
 		errorMessage := &rs.ThreadDetails{}
 
-		return responseCode, errorMessage
+		return responseCode, errorMessage, nil
+	} else if err != nil {
+		return 0, nil, err
 	}
 
 	responseCode := 0
-	responseMsg := &rs.ThreadDetails{
-		Date:      getThread.values[0]["date"],
-		Dislikes:  stringToInt64(getThread.values[0]["dislikes"]),
-		Forum:     getThread.values[0]["forum"],
-		Id:        stringToInt64(getThread.values[0]["id"]),
-		IsClosed:  stringToBool(getThread.values[0]["isClosed"]),
-		IsDeleted: stringToBool(getThread.values[0]["isDeleted"]),
-		Likes:     stringToInt64(getThread.values[0]["likes"]),
-		Message:   getThread.values[0]["message"],
-		Points:    stringToInt64(getThread.values[0]["points"]),
-		Posts:     stringToInt64(getThread.values[0]["posts"]),
-		Slug:      getThread.values[0]["slug"],
-		Title:     getThread.values[0]["title"],
-		User:      getThread.values[0]["user"],
-	}
-
-	return responseCode, responseMsg
-}
-
-func (t *Thread) _getArrayThreadsDetails(query string, args Args) (int, *rs.ThreadList) {
-	getThread := selectQuery(query, &args.data, t.db)
-
-	if getThread.rows == 0 {
-		responseCode := 1
-		errorMessage := &rs.ThreadList{}
-
-		return responseCode, errorMessage
-	}
-
-	responseCode := 0
-	responseArray := make([]rs.ThreadDetails, 0)
-	responseMsg := &rs.ThreadList{Threads: responseArray}
-
-	for _, value := range getThread.values {
-		tempMsg := &rs.ThreadDetails{
-			Date:      value["date"],
-			Dislikes:  stringToInt64(value["dislikes"]),
-			Forum:     value["forum"],
-			Id:        stringToInt64(value["id"]),
-			IsClosed:  stringToBool(value["isClosed"]),
-			IsDeleted: stringToBool(value["isDeleted"]),
-			Likes:     stringToInt64(value["likes"]),
-			Message:   value["message"],
-			Points:    stringToInt64(value["points"]),
-			Posts:     stringToInt64(value["posts"]),
-			Slug:      value["slug"],
-			Title:     value["title"],
-			User:      value["user"],
-		}
-
-		responseMsg.Threads = append(responseMsg.Threads, *tempMsg)
-	}
-
-	return responseCode, responseMsg
+	return responseCode, responseMsg, nil
 }
 
 // Проверка на пустой ответ с кодом 1 после _getThreadDetails()
@@ -185,8 +130,10 @@ func (t *Thread) details() string {
 	if len(t.inputRequest.query["thread"]) != 1 {
 		return createInvalidResponse()
 	}
-	args := Args{}
-	args.append(t.inputRequest.query["thread"][0])
+	threadId, ok := parseId(t.inputRequest.query["thread"][0])
+	if !ok {
+		return createInvalidResponse()
+	}
 
 	if len(t.inputRequest.query["related"]) >= 1 && stringInSlice("user", t.inputRequest.query["related"]) {
 		relatedUser = true
@@ -198,81 +145,86 @@ func (t *Thread) details() string {
 		return createInvalidQuery()
 	}
 
-	responseCode, responseMsg := t._getThreadDetails(args)
+	responseCode, responseMsg, err := t._getThreadDetails(threadId)
+	if err != nil {
+		return createErrorResponse(t.inputRequest, err)
+	}
+	if responseCode != 0 {
+		return createResponse(responseCode, responseMsg)
+	}
 
 	if relatedUser {
-		u := User{inputRequest: t.inputRequest, db: t.db}
+		u := User{inputRequest: t.inputRequest, store: t.store}
 		clearQuery(&u.inputRequest.query)
-		args := Args{}
-		args.append(responseMsg.User)
 
-		_, userDetails := u._getUserDetails(args)
+		_, userDetails, err := u._getUserDetails(responseMsg.User.(string))
+		if err != nil {
+			return createErrorResponse(t.inputRequest, err)
+		}
 
 		responseMsg.User = userDetails
 	}
 
 	if relatedForum {
-		f := Forum{inputRequest: t.inputRequest, db: t.db}
+		f := Forum{inputRequest: t.inputRequest, store: t.store}
 		clearQuery(&f.inputRequest.query)
-		args := Args{}
-		args.append(responseMsg.Forum)
 
-		_, forumDetails := f._getForumDetails(args)
+		_, forumDetails, err := f._getForumDetails(responseMsg.Forum.(string))
+		if err != nil {
+			return createErrorResponse(t.inputRequest, err)
+		}
 		responseMsg.Forum = forumDetails
 	}
 
 	return createResponse(responseCode, responseMsg)
 }
 
-func (t *Thread) listBasic() (int, *rs.ThreadList) {
-	var query string
-	args := Args{}
+func (t *Thread) listBasic() (int, *rs.ThreadList, *pager, error) {
+	var field string
 
 	// Validate query values
 	if len(t.inputRequest.query["user"]) == 1 {
-		query = "SELECT t.* FROM thread t WHERE t.user = ?"
-		args.append(t.inputRequest.query["user"][0])
+		field = "user"
 	} else if len(t.inputRequest.query["forum"]) == 1 {
-		query = "SELECT t.* FROM thread t WHERE t.forum = ?"
-		args.append(t.inputRequest.query["forum"][0])
+		field = "forum"
 	} else {
-		return 100500, nil
+		return 100500, nil, nil, nil
 	}
 
 	// Check and validate optional params
-	if len(t.inputRequest.query["since"]) >= 1 {
-		query += " AND t.date > ?"
-		args.append(t.inputRequest.query["since"][0])
+	opts, ok := t.inputRequest.listOptions("", "since")
+	if !ok {
+		return 100500, nil, nil, nil
 	}
+	page := newPager(&opts)
 
-	if len(t.inputRequest.query["order"]) >= 1 {
-		orderType := t.inputRequest.query["order"][0]
-		if orderType != "desc" && orderType != "asc" {
-			return 100500, nil
-		}
-
-		query += fmt.Sprintf(" ORDER BY t.date %s", orderType)
+	// Response here
+	threads, err := t.store.ListThreads(field, t.inputRequest.query[field][0], opts)
+	if err != nil {
+		return 0, nil, nil, err
 	}
 
-	if len(t.inputRequest.query["limit"]) >= 1 {
-		limitValue := t.inputRequest.query["limit"][0]
-		i, err := strconv.Atoi(limitValue)
-		if err != nil || i < 0 {
-			return 100500, nil
-		}
+	if len(threads) == 0 {
+		responseCode := 1
+		errorMessage := &rs.ThreadList{}
 
-		query += fmt.Sprintf(" LIMIT %d", i)
+		return responseCode, errorMessage, page, nil
 	}
 
-	// Response here
-	responseCode, responseMsg := t._getArrayThreadsDetails(query, args)
+	threads = threads[:page.cut(len(threads), func(i int) int64 { return threads[i].Id })]
 
-	return responseCode, responseMsg
+	responseCode := 0
+	responseMsg := &rs.ThreadList{Threads: threads}
+
+	return responseCode, responseMsg, page, nil
 }
 
 // Rewrite subquery
 func (t *Thread) list() string {
-	responseCode, responseMsg := t.listBasic()
+	responseCode, responseMsg, page, err := t.listBasic()
+	if err != nil {
+		return createErrorResponse(t.inputRequest, err)
+	}
 
 	if responseCode != 0 {
 		return becauseAPI()
@@ -283,366 +235,314 @@ func (t *Thread) list() string {
 		responseInterface[i] = v
 	}
 
-	return createResponseFromArray(responseCode, responseInterface)
+	return page.response(responseCode, responseInterface)
 }
 
-func (t *Thread) parentTree(order string) (int, *rs.PostList) {
-	query := "SELECT parent FROM post WHERE thread = ?"
-	order = " ORDER BY parent " + order
-	args := Args{}
-
-	args.append(t.inputRequest.query["thread"][0])
+func (t *Thread) listPosts() string {
+	var resp string
 
-	// Check and validate optional params
-	if len(t.inputRequest.query["since"]) >= 1 {
-		query += " AND date > ?"
-		args.append(t.inputRequest.query["since"][0])
+	// Validate query values
+	if len(t.inputRequest.query["thread"]) != 1 {
+		return createInvalidResponse()
 	}
-
-	query += " GROUP BY id HAVING LENGTH(parent) = 5"
-	query += order
-
-	if len(t.inputRequest.query["limit"]) >= 1 {
-		limitValue := t.inputRequest.query["limit"][0]
-		i, err := strconv.Atoi(limitValue)
-		if err != nil || i < 0 {
-			return 100500, nil
-		}
-		query += fmt.Sprintf(" LIMIT %d", i)
+	threadId, ok := parseId(t.inputRequest.query["thread"][0])
+	if !ok {
+		return createInvalidResponse()
 	}
 
-	//
-	// query here
-	//
-
-	getPost := selectQuery(query, &args.data, t.db)
-
-	if getPost.rows == 0 {
-		responseCode := 1
-		errorMessage := &rs.PostList{}
-
-		return responseCode, errorMessage
+	// order and limit here
+	opts, ok := t.inputRequest.listOptions("desc", "since")
+	if !ok {
+		return createInvalidResponse()
 	}
+	page := newPager(&opts)
 
-	responseCode := 0
-	responseArray := make([]rs.PostDetails, 0)
-	responseMsg := &rs.PostList{Posts: responseArray}
-
-	for _, value := range getPost.values {
-		subQuery := "SELECT * FROM post WHERE thread = ? AND parent LIKE ? ORDER BY parent"
-		subArgs := Args{}
-		subArgs.append(t.inputRequest.query["thread"][0])
-		subArgs.append(value["parent"] + "%")
-
-		getSubPost := selectQuery(subQuery, &subArgs.data, t.db)
-
-		for _, subValue := range getSubPost.values {
-			respId := stringToInt64(subValue["id"])
-
-			tempMsg := &rs.PostDetails{
-				Date:          subValue["date"],
-				Dislikes:      stringToInt64(subValue["dislikes"]),
-				Forum:         subValue["forum"],
-				Id:            respId,
-				IsApproved:    stringToBool(subValue["isApproved"]),
-				IsHighlighted: stringToBool(subValue["isHighlighted"]),
-				IsEdited:      stringToBool(subValue["isEdited"]),
-				IsSpam:        stringToBool(subValue["isSpam"]),
-				IsDeleted:     stringToBool(subValue["isDeleted"]),
-				Likes:         stringToInt64(subValue["likes"]),
-				Message:       subValue["message"],
-				Parent:        nil,
-				Points:        stringToInt64(subValue["points"]),
-				Thread:        stringToInt64(subValue["thread"]),
-				User:          subValue["user"],
-			}
-
-			p := Post{inputRequest: t.inputRequest, db: t.db}
-			parent := p.getParentId(respId, subValue["parent"])
-			if parent == int(respId) {
-				tempMsg.Parent = nil
-			} else {
-				tempParent := int64(parent)
-				tempMsg.Parent = &tempParent
-			}
+	var posts []rs.PostDetails
+	var err error
 
-			responseMsg.Posts = append(responseMsg.Posts, *tempMsg)
-		}
+	// sort here
+	sortType := "flat"
+	if len(t.inputRequest.query["sort"]) >= 1 {
+		sortType = t.inputRequest.query["sort"][0]
 	}
 
-	fmt.Println("Thread.parentTree()")
-
-	return responseCode, responseMsg
-}
-
-func (t *Thread) listPosts() string {
-	var query, order, sort, resp string
-	parentTree := false
-	args := Args{}
-
-	// Validate query values
-	if len(t.inputRequest.query["thread"]) == 1 {
-		query = "SELECT * FROM post WHERE thread = ?"
-		args.append(t.inputRequest.query["thread"][0])
-	} else {
+	switch sortType {
+	case "flat":
+		posts, err = t.store.ListPosts("thread", int64ToString(threadId), opts)
+	case "tree":
+		posts, err = t.store.ListPostsTree(threadId, opts)
+	case "parent_tree":
+		posts, err = t.store.ListPostsParentTree(threadId, opts)
+	default:
 		return createInvalidResponse()
 	}
 
-	// order by here
-	if len(t.inputRequest.query["order"]) >= 1 {
-		orderType := t.inputRequest.query["order"][0]
-		if orderType != "desc" && orderType != "asc" {
-			return createInvalidResponse()
-		}
-		order = orderType
-	} else {
-		order = "DESC"
+	if err != nil {
+		return createErrorResponse(t.inputRequest, err)
 	}
 
-	// sort here
-	if len(t.inputRequest.query["sort"]) >= 1 {
-		switch sortType := t.inputRequest.query["sort"][0]; sortType {
-		case "flat":
-			sort = " ORDER BY date " + order
-		case "tree":
-			sort = " ORDER BY SUBSTRING(parent, 1, 5) " + order + ", parent asc "
-		case "parent_tree":
-			parentTree = true
-		default:
-			return createInvalidResponse()
-		}
-	} else {
-		sort = " ORDER BY date " + order
+	// check posts
+	if len(posts) == 0 {
+		return becauseAPI()
 	}
 
-	var responseCode int
-	responseMsg := &rs.PostList{}
+	if sortType == "parent_tree" {
+		// pages of root posts with their subtrees
+		roots := make([]int, 0)
+		for i := range posts {
+			if posts[i].Parent == nil {
+				roots = append(roots, i)
+			}
+		}
 
-	// simple sort
-	if parentTree == false {
-		p := Post{inputRequest: t.inputRequest, db: t.db}
-		responseCode, responseMsg = p._getList(query, sort, args)
+		n := page.cut(len(roots), func(i int) int64 { return posts[roots[i]].Id })
+		if n < len(roots) {
+			posts = posts[:roots[n]]
+		}
 	} else {
-		// parent_tree sort
-		responseCode, responseMsg = t.parentTree(order)
+		posts = posts[:page.cut(len(posts), func(i int) int64 { return posts[i].Id })]
 	}
 
-	// check responseCode
-	if responseCode == 0 {
-		responseInterface := make([]interface{}, len(responseMsg.Posts))
-		for i, v := range responseMsg.Posts {
-			responseInterface[i] = v
-		}
-		resp = createResponseFromArray(responseCode, responseInterface)
-	} else if responseCode == 1 {
-		resp = becauseAPI()
-	} else {
-		resp = createInvalidResponse()
+	responseInterface := make([]interface{}, len(posts))
+	for i, v := range posts {
+		responseInterface[i] = v
 	}
+	resp = page.response(0, responseInterface)
 
 	return resp
 }
 
 func (t *Thread) open() string {
-	query := "UPDATE thread SET isClosed = ? WHERE id = ?"
-
-	return t.updateBoolBasic(query, false)
+	return t.updateBoolBasic("thread_open", func(id int64) (bool, error) {
+		return t.store.SetThreadClosed(id, false)
+	})
 }
 
 func (t *Thread) remove() string {
-	query := "UPDATE thread SET isDeleted = ?, posts = 0 WHERE id = ?"
-
-	resp := t.updateBoolBasic(query, true)
-
-	query = "UPDATE post SET isDeleted = ? WHERE thread = ?"
-
-	_ = t.updateBoolBasic(query, true)
-
-	return resp
+	return t.updateBoolBasic("thread_remove", t.store.RemoveThread)
 }
 
 func (t *Thread) restore() string {
-	query := "UPDATE post SET isDeleted = ? WHERE thread = ?"
-
-	_ = t.updateBoolBasic(query, false)
-
-	query = "UPDATE thread t SET t.isDeleted = ?, t.posts = (SELECT COUNT(*) FROM post p WHERE p.thread = t.id AND p.isDeleted = false) WHERE t.id = ?"
-
-	return t.updateBoolBasic(query, false)
+	return t.updateBoolBasic("thread_restore", t.store.RestoreThread)
 }
 
 func (t *Thread) subscribe() string {
 	var resp string
-	args := Args{}
-
-	query := "INSERT INTO subscribe (thread, user) VALUES(?, ?)"
 
 	if !validateJson(t.inputRequest, "thread", "user") {
 		return createInvalidJsonResponse(t.inputRequest)
 	}
 
+	if !checkStringParams(t.inputRequest.json, "user") {
+		return createInvalidJsonResponse(t.inputRequest)
+	}
+
 	if !checkFloat64Type(t.inputRequest.json["thread"]) {
 		return createInvalidJsonResponse(t.inputRequest)
 	}
 
-	args.generateFromJson(&t.inputRequest.json, "thread", "user")
+	threadId := int64(t.inputRequest.json["thread"].(float64))
 
-	_, err := execQuery(query, &args.data, t.db)
+	err := t.store.Subscribe(threadId, t.inputRequest.json["user"].(string))
 	if err != nil {
-		fmt.Println(err)
-
 		// return exist
 		if checkError1062(err) == true {
 			clearQuery(&t.inputRequest.query)
-			t.inputRequest.query["thread"] = append(t.inputRequest.query["thread"], floatToString(t.inputRequest.json["thread"].(float64)))
+			t.inputRequest.query["thread"] = append(t.inputRequest.query["thread"], int64ToString(threadId))
 
 			return t.details()
 		}
 
-		return createErrorResponse(err)
+		return createErrorResponse(t.inputRequest, err)
 	}
 
 	// else return info
 
 	responseCode := 0
 	responseMsg := &rs.ThreadSubscribe{
-		Thread: int64(t.inputRequest.json["thread"].(float64)),
+		Thread: threadId,
 		User:   t.inputRequest.json["user"].(string),
 	}
 
 	resp = createResponse(responseCode, responseMsg)
 
-	log.Printf("User '%s' subscribe to thread '#%d'", responseMsg.User, responseMsg.Thread)
+	t.inputRequest.log.Info("subscribed", "user", responseMsg.User, "thread", responseMsg.Thread)
 
 	return resp
 }
 
 func (t *Thread) unsubscribe() string {
 	var resp string
-	args := Args{}
-
-	query := "DELETE FROM subscribe WHERE thread = ? AND user = ?"
 
 	if !validateJson(t.inputRequest, "thread", "user") {
 		return createInvalidJsonResponse(t.inputRequest)
 	}
 
+	if !checkStringParams(t.inputRequest.json, "user") {
+		return createInvalidJsonResponse(t.inputRequest)
+	}
+
 	if !checkFloat64Type(t.inputRequest.json["thread"]) {
 		return createInvalidJsonResponse(t.inputRequest)
 	}
 
-	args.generateFromJson(&t.inputRequest.json, "thread", "user")
+	threadId := int64(t.inputRequest.json["thread"].(float64))
 
-	dbResp, err := execQuery(query, &args.data, t.db)
+	changed, err := t.store.Unsubscribe(threadId, t.inputRequest.json["user"].(string))
 	if err != nil {
-		return createErrorResponse(err)
+		return createErrorResponse(t.inputRequest, err)
 	}
 
-	if dbResp.rowCount == 0 {
+	if !changed {
 		clearQuery(&t.inputRequest.query)
-		t.inputRequest.query["thread"] = append(t.inputRequest.query["thread"], floatToString(t.inputRequest.json["thread"].(float64)))
+		t.inputRequest.query["thread"] = append(t.inputRequest.query["thread"], int64ToString(threadId))
 
 		return t.details()
 	}
 
 	responseCode := 0
 	responseMsg := &rs.ThreadSubscribe{
-		Thread: int64(t.inputRequest.json["thread"].(float64)),
+		Thread: threadId,
 		User:   t.inputRequest.json["user"].(string),
 	}
 
 	resp = createResponse(responseCode, responseMsg)
 
-	log.Printf("User '%s' unsubscribe from thread '#%d'", responseMsg.User, responseMsg.Thread)
+	t.inputRequest.log.Info("unsubscribed", "user", responseMsg.User, "thread", responseMsg.Thread)
 
 	return resp
 }
 
 func (t *Thread) update() string {
-	args := Args{}
-
-	query := "UPDATE thread SET message = ?, slug = ? WHERE id = ?"
-
 	if !validateJson(t.inputRequest, "thread", "message", "slug") {
 		return createInvalidJsonResponse(t.inputRequest)
 	}
 
+	if !checkStringParams(t.inputRequest.json, "message", "slug") {
+		return createInvalidJsonResponse(t.inputRequest)
+	}
+
 	if !checkFloat64Type(t.inputRequest.json["thread"]) {
 		return createInvalidJsonResponse(t.inputRequest)
 	}
 
-	threadId := t.inputRequest.json["thread"].(float64)
+	threadId := int64(t.inputRequest.json["thread"].(float64))
 
-	args.generateFromJson(&t.inputRequest.json, "message", "slug", "thread")
+	editor, ok := userParam(t.inputRequest)
+	if !ok {
+		return createInvalidJsonResponse(t.inputRequest)
+	}
 
-	_, err := execQuery(query, &args.data, t.db)
+	err := t.store.UpdateThread(threadId, t.inputRequest.json["message"].(string), t.inputRequest.json["slug"].(string), editor)
 	if err != nil {
-		return createErrorResponse(err)
+		return createErrorResponse(t.inputRequest, err)
 	}
 
-	threadArgs := Args{}
-	threadArgs.append(threadId)
-	responseCode, responseMsg := t._getThreadDetails(threadArgs)
+	responseCode, responseMsg, err := t._getThreadDetails(threadId)
+	if err != nil {
+		return createErrorResponse(t.inputRequest, err)
+	}
 
 	if responseCode != 0 {
 		return createNotExistResponse()
 	}
 
+	threadEvents.publish(threadId, "thread_update", responseMsg)
+
 	return createResponse(responseCode, responseMsg)
 }
 
-func (t *Thread) vote() string {
-	var query string
-	args := Args{}
+func (t *Thread) search() string {
+	return searchThreads(t.inputRequest, t.store)
+}
+
+func (t *Thread) history() string {
+	return listRevisions(t.inputRequest, t.store, "thread")
+}
+
+func (t *Thread) revert() string {
+	return revert(t.inputRequest, t.store, "thread", func(id int64) string {
+		responseCode, responseMsg, err := t._getThreadDetails(id)
+		if err != nil {
+			return createErrorResponse(t.inputRequest, err)
+		}
+
+		if responseCode != 0 {
+			return createNotExistResponse()
+		}
+
+		threadEvents.publish(id, "thread_update", responseMsg)
+
+		return createResponse(responseCode, responseMsg)
+	})
+}
 
+func (t *Thread) listVotes() string {
+	return listVotes(t.inputRequest, t.store, "thread")
+}
+
+func (t *Thread) vote() string {
 	if !validateJson(t.inputRequest, "thread", "vote") {
 		return createInvalidJsonResponse(t.inputRequest)
 	}
 
-	if !checkFloat64Type(t.inputRequest.json["thread"]) || !checkFloat64Type(t.inputRequest.json["vote"]) {
+	if !checkFloat64Type(t.inputRequest.json["thread"]) {
 		return createInvalidJsonResponse(t.inputRequest)
 	}
 
-	threadId := t.inputRequest.json["thread"].(float64)
-	vote := t.inputRequest.json["vote"].(float64)
-
-	if vote == 1 {
-		query = "UPDATE thread SET likes = likes + 1, points = points + 1 WHERE id = ?"
-	} else if vote == -1 {
-		query = "UPDATE thread SET dislikes = dislikes + 1, points = points - 1 WHERE id = ?"
-	} else {
+	threadId := int64(t.inputRequest.json["thread"].(float64))
+	user, vote, ok := voteParams(t.inputRequest)
+	if !ok {
 		return createInvalidJsonResponse(t.inputRequest)
 	}
 
-	args.append(threadId)
-
-	_, err := execQuery(query, &args.data, t.db)
+	var err error
+	if user != nil {
+		err = t.store.SetVote("thread", threadId, *user, vote)
+	} else {
+		err = t.store.VoteThread(threadId, vote)
+	}
 	if err != nil {
-		return createErrorResponse(err)
+		return createErrorResponse(t.inputRequest, err)
 	}
 
-	threadArgs := Args{}
-	threadArgs.append(threadId)
-	responseCode, responseMsg := t._getThreadDetails(threadArgs)
+	responseCode, responseMsg, err := t._getThreadDetails(threadId)
+	if err != nil {
+		return createErrorResponse(t.inputRequest, err)
+	}
 
 	if responseCode != 0 {
 		return createNotExistResponse()
 	}
 
+	threadEvents.publish(threadId, "thread_vote", responseMsg)
+
 	return createResponse(responseCode, responseMsg)
 }
 
-func threadHandler(w http.ResponseWriter, r *http.Request, inputRequest *InputRequest, db *sql.DB) {
+func threadHandler(w http.ResponseWriter, r *http.Request, inputRequest *InputRequest, store Store) {
 	//t0 := time.Now()
-	thread := Thread{inputRequest: inputRequest, db: db}
+	thread := Thread{inputRequest: inputRequest, store: store}
 	var result string
 
+	// a stream writes as it goes
+	if inputRequest.method == "GET" && inputRequest.path == "/db/api/thread/stream/" {
+		thread.stream(w, r)
+		return
+	}
+
 	if inputRequest.method == "GET" {
 		switch inputRequest.path {
 		case "/db/api/thread/details/":
 			result = thread.details()
 		case "/db/api/thread/list/":
 			result = thread.list()
+		case "/db/api/thread/listVotes/":
+			result = thread.listVotes()
+		case "/db/api/thread/history/":
+			result = thread.history()
+		case "/db/api/thread/search/":
+			result = thread.search()
 		case "/db/api/thread/listPosts/":
 			result = thread.listPosts()
 		}
@@ -662,6 +562,8 @@ func threadHandler(w http.ResponseWriter, r *http.Request, inputRequest *InputRe
 			result = thread.open()
 		case "/db/api/thread/update/":
 			result = thread.update()
+		case "/db/api/thread/revert/":
+			result = thread.revert()
 		case "/db/api/thread/subscribe/":
 			result = thread.subscribe()
 		case "/db/api/thread/unsubscribe/":
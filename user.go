@@ -1,12 +1,8 @@
 package main
 
 import (
-	"database/sql"
-	"fmt"
 	"io"
-	"log"
 	"net/http"
-	"strconv"
 
 	rs "technopark-db/response"
 )
@@ -17,156 +13,101 @@ import (
 
 type User struct {
 	inputRequest *InputRequest
-	db           *sql.DB
+	store        Store
 }
 
 func (u *User) create() string {
 	var resp string
-	args := Args{}
-
-	query := "INSERT INTO user (username, about, name, email, isAnonymous) VALUES(?, ?, ?, ?, ?)"
 
 	if !validateJson(u.inputRequest, "email") {
 		return createInvalidJsonResponse(u.inputRequest)
 	}
 
-	args.generateFromJson(&u.inputRequest.json, "username", "about", "name", "email")
+	if !checkStringParams(u.inputRequest.json, "email") {
+		return createInvalidJsonResponse(u.inputRequest)
+	}
 
-	// Validate isAnonymous param
-	isAnonymous := u.inputRequest.json["isAnonymous"]
-	if isAnonymous == nil {
-		args.append(false)
-	} else {
-		if isAnonymous != false && isAnonymous != true {
-			return createInvalidResponse()
+	// about, name and username are null for anonymous users
+	for _, key := range []string{"about", "name", "username"} {
+		if u.inputRequest.json[key] != nil && !checkStringType(u.inputRequest.json[key]) {
+			return createInvalidJsonResponse(u.inputRequest)
 		}
-		args.addFromJson(&u.inputRequest.json, "isAnonymous")
 	}
 
-	dbResp, err := execQuery(query, &args.data, u.db)
-	if err != nil {
-		return createErrorResponse(err)
+	// Validate isAnonymous param
+	args := Args{}
+	if !validateBoolParams(u.inputRequest.json, &args, "isAnonymous") {
+		return createInvalidResponse()
+	}
+
+	newUser := &rs.UserDetails{
+		About:       jsonStringPtr(u.inputRequest.json, "about"),
+		Email:       *jsonStringPtr(u.inputRequest.json, "email"),
+		IsAnonymous: args.data[0].(bool),
+		Name:        jsonStringPtr(u.inputRequest.json, "name"),
+		Username:    jsonStringPtr(u.inputRequest.json, "username"),
 	}
 
-	query = "SELECT * FROM user WHERE id = ?"
-	args.clear()
-	args.append(dbResp.lastId)
-	newUser := selectQuery(query, &args.data, u.db)
+	err := u.store.CreateUser(newUser)
+	if err != nil {
+		return createErrorResponse(u.inputRequest, err)
+	}
 
 	responseCode := 0
 	responseMsg := &rs.UserCreate{
-		About:       newUser.values[0]["about"],
-		Email:       newUser.values[0]["email"],
-		Id:          dbResp.lastId,
-		IsAnonymous: stringToBool(newUser.values[0]["isAnonymous"]),
-		Name:        newUser.values[0]["name"],
-		Username:    newUser.values[0]["username"],
+		About:       newUser.About,
+		Email:       newUser.Email,
+		Id:          newUser.Id,
+		IsAnonymous: newUser.IsAnonymous,
+		Name:        newUser.Name,
+		Username:    newUser.Username,
 	}
 
 	resp = createResponse(responseCode, responseMsg)
 
-	log.Printf("User '%s' created", responseMsg.Email)
+	u.inputRequest.log.Info("user created", "email", responseMsg.Email)
 
 	return resp
 }
 
-func (u *User) _getUserDetails(args Args) (int, *rs.UserDetails) {
-	query := "SELECT * FROM user WHERE email = ?"
+// Code 1 and empty details for a missing user, storage errors are returned
+func (u *User) _getUserDetails(email string) (int, *rs.UserDetails, error) {
+	responseMsg, err := u.store.GetUser(email)
 
-	getUser := selectQuery(query, &args.data, u.db)
-
-	if getUser.rows == 0 {
+	if err == ErrNotFound {
 		responseCode := 1
 		errorMessage := &rs.UserDetails{}
 
-		return responseCode, errorMessage
-	}
-
-	// followers here
-	listFollowers := u.getUserFollowers(args.data[0].(string))
-
-	// following here
-	listFollowing := u.getUserFollowing(args.data[0].(string))
-
-	// subscriptions here
-	listSubscriptions := u.getUserSubscriptions(args.data[0].(string))
-
-	respAbout := getUser.values[0]["about"]
-	respName := getUser.values[0]["name"]
-	respUsername := getUser.values[0]["username"]
-
-	responseCode := 0
-	responseMsg := &rs.UserDetails{
-		About:         &respAbout,
-		Email:         getUser.values[0]["email"],
-		Followers:     listFollowers,
-		Following:     listFollowing,
-		Id:            stringToInt64(getUser.values[0]["id"]),
-		IsAnonymous:   stringToBool(getUser.values[0]["isAnonymous"]),
-		Name:          &respName,
-		Subscriptions: listSubscriptions,
-		Username:      &respUsername,
+		return responseCode, errorMessage, nil
+	} else if err != nil {
+		return 0, nil, err
 	}
 
-	if respAbout == "NULL" {
-		responseMsg.About = nil
-	}
-	if respName == "NULL" {
-		responseMsg.Name = nil
-	}
-	if respUsername == "NULL" {
-		responseMsg.Username = nil
+	if err := u.fillUserLists(responseMsg); err != nil {
+		return 0, nil, err
 	}
 
-	return responseCode, responseMsg
+	responseCode := 0
+	return responseCode, responseMsg, nil
 }
 
-func (u *User) getUserFollowers(followee string) []string {
-	args := Args{}
-	args.append(followee)
+// Fill followers, following and subscriptions of user
+func (u *User) fillUserLists(user *rs.UserDetails) error {
+	var err error
 
 	// followers here
-	query := "SELECT follower FROM follow WHERE followee = ?"
-	getUserFollowers := selectQuery(query, &args.data, u.db)
-
-	listFollowers := make([]string, 0)
-	for _, value := range getUserFollowers.values {
-		listFollowers = append(listFollowers, value["follower"])
+	if user.Followers, err = u.store.GetFollowers(user.Email); err != nil {
+		return err
 	}
 
-	return listFollowers
-}
-
-func (u *User) getUserFollowing(follower string) []string {
-	args := Args{}
-	args.append(follower)
-
 	// following here
-	query := "SELECT followee FROM follow WHERE follower = ?"
-	getUserFollowing := selectQuery(query, &args.data, u.db)
-
-	listFollowing := make([]string, 0)
-	for _, value := range getUserFollowing.values {
-		listFollowing = append(listFollowing, value["followee"])
+	if user.Following, err = u.store.GetFollowing(user.Email); err != nil {
+		return err
 	}
 
-	return listFollowing
-}
-
-func (u *User) getUserSubscriptions(user string) []int {
-	args := Args{}
-	args.append(user)
-
 	// subscriptions here
-	query := "SELECT thread FROM subscribe WHERE user = ? ORDER BY thread asc"
-	getUserSubscriptions := selectQuery(query, &args.data, u.db)
-
-	listSubscriptions := make([]int, 0)
-	for _, value := range getUserSubscriptions.values {
-		listSubscriptions = append(listSubscriptions, stringToInt(value["thread"]))
-	}
-
-	return listSubscriptions
+	user.Subscriptions, err = u.store.GetSubscriptions(user.Email)
+	return err
 }
 
 func (u *User) getDetails() string {
@@ -174,10 +115,10 @@ func (u *User) getDetails() string {
 		return createInvalidResponse()
 	}
 
-	args := Args{}
-	args.append(u.inputRequest.query["user"][0])
-
-	responseCode, responseMsg := u._getUserDetails(args)
+	responseCode, responseMsg, err := u._getUserDetails(u.inputRequest.query["user"][0])
+	if err != nil {
+		return createErrorResponse(u.inputRequest, err)
+	}
 	if responseCode == 1 {
 		return createNotExistResponse()
 	}
@@ -186,26 +127,28 @@ func (u *User) getDetails() string {
 }
 
 func (u *User) follow() string {
-	query := "INSERT INTO follow (follower, followee) VALUES(?, ?)"
-	args := Args{}
-
 	if !validateJson(u.inputRequest, "follower", "followee") {
 		return createInvalidJsonResponse(u.inputRequest)
 	}
 
-	args.generateFromJson(&u.inputRequest.json, "follower", "followee")
+	if !checkStringParams(u.inputRequest.json, "follower", "followee") {
+		return createInvalidJsonResponse(u.inputRequest)
+	}
+
+	follower := u.inputRequest.json["follower"].(string)
+	followee := u.inputRequest.json["followee"].(string)
 
-	_, err := execQuery(query, &args.data, u.db)
+	err := u.store.Follow(follower, followee)
 	if err != nil {
 		// return exist
 		if checkError1062(err) == true {
 			clearQuery(&u.inputRequest.query)
-			u.inputRequest.query["user"] = append(u.inputRequest.query["user"], u.inputRequest.json["follower"].(string))
+			u.inputRequest.query["user"] = append(u.inputRequest.query["user"], follower)
 
 			return u.getDetails()
 		}
 
-		responseCode, msg := errorExecParse(err)
+		responseCode, msg := errorExecParse(u.inputRequest, err)
 		errorMessage := &rs.ErrorMsg{
 			Msg: msg,
 		}
@@ -213,158 +156,109 @@ func (u *User) follow() string {
 		return createResponse(responseCode, errorMessage)
 	}
 
-	u.inputRequest.query["user"] = append(u.inputRequest.query["user"], u.inputRequest.json["follower"].(string))
+	gateway.publish("follow", &rs.Follow{Follower: follower, Followee: followee}, userChannel(follower), userChannel(followee))
+
+	u.inputRequest.query["user"] = append(u.inputRequest.query["user"], follower)
 	return u.getDetails()
 }
 
-func (u *User) listBasic(query string) string {
-	args := Args{}
-
+func (u *User) listBasic(list func(string, ListOptions) ([]rs.UserDetails, error)) string {
 	// Validate query values
-	if len(u.inputRequest.query["user"]) == 1 {
-		args.append(u.inputRequest.query["user"][0])
-	} else {
+	if len(u.inputRequest.query["user"]) != 1 {
 		return createInvalidResponse()
 	}
 
 	// Check and validate optional params
-	if len(u.inputRequest.query["since_id"]) >= 1 {
-		query += " AND id >= ?"
-		args.append(u.inputRequest.query["since_id"][0])
-	}
-	if len(u.inputRequest.query["order"]) >= 1 {
-		orderType := u.inputRequest.query["order"][0]
-		if orderType != "desc" && orderType != "asc" {
-			return createInvalidResponse()
-		}
-
-		query += fmt.Sprintf(" ORDER BY date %s", orderType)
-	}
-	if len(u.inputRequest.query["limit"]) >= 1 {
-		limitValue := u.inputRequest.query["limit"][0]
-		i, err := strconv.Atoi(limitValue)
-		if err != nil || i < 0 {
-			return createInvalidResponse()
-		}
-		query += fmt.Sprintf(" LIMIT %d", i)
+	opts, ok := u.inputRequest.listOptions("", "since_id")
+	if !ok {
+		return createInvalidResponse()
 	}
+	page := newPager(&opts)
 
 	// Prepare users
-	getUserFollowers := selectQuery(query, &args.data, u.db)
+	users, err := list(u.inputRequest.query["user"][0], opts)
+	if err != nil {
+		return createErrorResponse(u.inputRequest, err)
+	}
 
 	responseCode := 0
-	responseArray := make([]rs.UserDetails, 0)
-	responseMsg := &rs.UserListBasic{Users: responseArray}
-
-	for _, value := range getUserFollowers.values {
-		// followers here
-		listFollowers := u.getUserFollowers(value["email"])
-
-		// following here
-		listFollowing := u.getUserFollowing(value["email"])
-
-		// subscriptions here
-		listSubscriptions := u.getUserSubscriptions(value["email"])
-
-		respAbout := value["about"]
-		respName := value["name"]
-		respUsername := value["username"]
-
-		tempUser := &rs.UserDetails{
-			About:         &respAbout,
-			Email:         value["email"],
-			Followers:     listFollowers,
-			Following:     listFollowing,
-			Id:            stringToInt64(value["id"]),
-			IsAnonymous:   stringToBool(value["isAnonymous"]),
-			Name:          &respName,
-			Subscriptions: listSubscriptions,
-			Username:      &respUsername,
-		}
-
-		if respAbout == "NULL" {
-			tempUser.About = nil
-		}
-		if respName == "NULL" {
-			tempUser.Name = nil
-		}
-		if respUsername == "NULL" {
-			tempUser.Username = nil
-		}
 
-		responseMsg.Users = append(responseMsg.Users, *tempUser)
+	users = users[:page.cut(len(users), func(i int) int64 { return users[i].Id })]
+	if err := fillUsersLists(u.store, users); err != nil {
+		return createErrorResponse(u.inputRequest, err)
 	}
 
-	responseInterface := make([]interface{}, len(responseMsg.Users))
-	for i, v := range responseMsg.Users {
-		responseInterface[i] = v
+	responseInterface := make([]interface{}, len(users))
+	for i := range users {
+		responseInterface[i] = users[i]
 	}
 
-	return createResponseFromArray(responseCode, responseInterface)
+	return page.response(responseCode, responseInterface)
 }
 
 func (u *User) listFollowers() string {
-	query := "SELECT u.* FROM user u JOIN follow f ON u.email = f.follower WHERE followee = ?"
-
-	return u.listBasic(query)
+	return u.listBasic(u.store.ListFollowers)
 }
 
 func (u *User) listFollowing() string {
-	query := "SELECT u.* FROM user u JOIN follow f ON u.email = f.followee WHERE follower = ?"
-
-	return u.listBasic(query)
+	return u.listBasic(u.store.ListFollowing)
 }
 
 func (u *User) listPosts() string {
 	delete(u.inputRequest.query, "forum")
 
-	p := Post{inputRequest: u.inputRequest, db: u.db}
+	p := Post{inputRequest: u.inputRequest, store: u.store}
 	return p.list()
 }
 
 func (u *User) unfollow() string {
-	query := "DELETE FROM follow WHERE follower = ? AND followee = ?"
-	args := Args{}
-
 	if !validateJson(u.inputRequest, "follower", "followee") {
 		return createInvalidJsonResponse(u.inputRequest)
 	}
 
-	args.generateFromJson(&u.inputRequest.json, "follower", "followee")
+	if !checkStringParams(u.inputRequest.json, "follower", "followee") {
+		return createInvalidJsonResponse(u.inputRequest)
+	}
 
-	_, err := execQuery(query, &args.data, u.db)
+	follower := u.inputRequest.json["follower"].(string)
+	followee := u.inputRequest.json["followee"].(string)
+
+	err := u.store.Unfollow(follower, followee)
 	if err != nil {
-		return createErrorResponse(err)
+		return createErrorResponse(u.inputRequest, err)
 	}
 
+	gateway.publish("unfollow", &rs.Follow{Follower: follower, Followee: followee}, userChannel(follower), userChannel(followee))
+
 	clearQuery(&u.inputRequest.query)
-	u.inputRequest.query["user"] = append(u.inputRequest.query["user"], u.inputRequest.json["follower"].(string))
+	u.inputRequest.query["user"] = append(u.inputRequest.query["user"], follower)
 	return u.getDetails()
 }
 
 func (u *User) updateProfile() string {
-	query := "UPDATE user SET about = ?, name = ? WHERE email =  ?"
-	args := Args{}
-
 	if !validateJson(u.inputRequest, "about", "name", "user") {
 		return createInvalidJsonResponse(u.inputRequest)
 	}
 
-	args.generateFromJson(&u.inputRequest.json, "about", "name", "user")
+	if !checkStringParams(u.inputRequest.json, "about", "name", "user") {
+		return createInvalidJsonResponse(u.inputRequest)
+	}
+
+	user := u.inputRequest.json["user"].(string)
 
-	_, err := execQuery(query, &args.data, u.db)
+	err := u.store.UpdateUser(user, u.inputRequest.json["about"].(string), u.inputRequest.json["name"].(string))
 	if err != nil {
-		return createErrorResponse(err)
+		return createErrorResponse(u.inputRequest, err)
 	}
 
 	clearQuery(&u.inputRequest.query)
-	u.inputRequest.query["user"] = append(u.inputRequest.query["user"], u.inputRequest.json["user"].(string))
+	u.inputRequest.query["user"] = append(u.inputRequest.query["user"], user)
 	return u.getDetails()
 }
 
-func userHandler(w http.ResponseWriter, r *http.Request, inputRequest *InputRequest, db *sql.DB) {
+func userHandler(w http.ResponseWriter, r *http.Request, inputRequest *InputRequest, store Store) {
 	//t0 := time.Now()
-	user := User{inputRequest: inputRequest, db: db}
+	user := User{inputRequest: inputRequest, store: store}
 	var result string
 
 	if inputRequest.method == "GET" {
@@ -377,6 +271,10 @@ func userHandler(w http.ResponseWriter, r *http.Request, inputRequest *InputRequ
 			result = user.listFollowing()
 		case "/db/api/user/listPosts/":
 			result = user.listPosts()
+		case "/db/api/user/feed/":
+			result = user.feed()
+		case "/db/api/user/notifications/":
+			result = user.notifications()
 		}
 	} else if inputRequest.method == "POST" {
 		switch inputRequest.path {
@@ -388,6 +286,8 @@ func userHandler(w http.ResponseWriter, r *http.Request, inputRequest *InputRequ
 			result = user.unfollow()
 		case "/db/api/user/updateProfile/":
 			result = user.updateProfile()
+		case "/db/api/user/markRead/":
+			result = user.markRead()
 		}
 	}
 
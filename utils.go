@@ -2,17 +2,17 @@ package main
 
 import (
 	"database/sql"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"net/http"
 	"reflect"
 	"strconv"
 	"strings"
 	rs "technopark-db/response"
-
-	mysql "github.com/go-sql-driver/mysql"
 )
 
 type InputRequest struct {
@@ -21,9 +21,10 @@ type InputRequest struct {
 	path   string
 	json   map[string]interface{}
 	query  map[string][]string
+	log    *slog.Logger // with the request id and endpoint
 }
 
-func (ir *InputRequest) parse(r *http.Request) {
+func (ir *InputRequest) parse(r *http.Request) error {
 	ir.method = r.Method
 	ir.url = fmt.Sprintf("%v", r.URL)
 	ir.path = r.URL.EscapedPath()
@@ -31,17 +32,27 @@ func (ir *InputRequest) parse(r *http.Request) {
 	// POST JSON
 	body, err := ioutil.ReadAll(r.Body) // ReadAll reads from r until an error or EOF and returns the data it read
 	if err != nil {
-		log.Panic(err)
+		return err
 	}
 
+	// An empty body is fine for GET, anything else has to be a JSON object
 	var parsed map[string]interface{}
-	json.Unmarshal([]byte(body), &parsed)
+	if strings.TrimSpace(string(body)) != "" {
+		if err := json.Unmarshal(body, &parsed); err != nil {
+			return err
+		}
+	}
 	ir.json = parsed
 
 	// GET Query
 	ir.query = r.URL.Query()
+
+	return nil
 }
 
+// Sent when a response can't be encoded
+const unknownErrorResponse = `{"code":4,"response":{"msg":"Unknown error"}}`
+
 func createResponse(code int, response rs.RespStruct) string {
 	content := map[string]interface{}{
 		"code":     code,
@@ -50,8 +61,8 @@ func createResponse(code int, response rs.RespStruct) string {
 
 	str, err := json.Marshal(content)
 	if err != nil {
-		log.Println("Error encoding JSON")
-		log.Panic(err)
+		slog.Error("can't encode JSON", "error", err)
+		return unknownErrorResponse
 	}
 
 	return string(str)
@@ -65,43 +76,70 @@ func createResponseFromArray(code int, response []interface{}) string {
 
 	str, err := json.Marshal(cacheContent)
 	if err != nil {
-		log.Println("Error encoding JSON")
-		log.Panic(err)
+		slog.Error("can't encode JSON", "error", err)
+		return unknownErrorResponse
 	}
 
 	return string(str)
 }
 
-func errorExecParse(err error) (int, string) {
-	log.Println("Error:\t", err)
-	if driverErr, ok := err.(*mysql.MySQLError); ok { // Now the error number is accessible directly
-		var responseCode int
-		var errorMessage string
+// A list response with the cursor of the next page, null on the last one
+func createPageFromArray(code int, response []interface{}, cursor interface{}) string {
+	content := map[string]interface{}{
+		"code":     code,
+		"response": response,
+		"cursor":   cursor,
+	}
 
-		switch driverErr.Number {
-		case 1062:
-			responseCode = 5
-			errorMessage = "Exist"
+	str, err := json.Marshal(content)
+	if err != nil {
+		slog.Error("can't encode JSON", "error", err)
+		return unknownErrorResponse
+	}
 
-		// Error 1452: Cannot add or update a child row: a foreign key constraint fails
-		case 1452:
-			responseCode = 5
-			errorMessage = "Exist [Error 1452]"
+	return string(str)
+}
 
-		default:
-			// fmt.Println("errorExecParse() default")
-			panic(err.Error())
-			responseCode = 4
-			errorMessage = "Unknown Error"
-		}
+// A response of an object that holds a page, with the cursor of the next
+func createPage(code int, response rs.RespStruct, cursor interface{}) string {
+	content := map[string]interface{}{
+		"code":     code,
+		"response": response,
+		"cursor":   cursor,
+	}
 
-		return responseCode, errorMessage
+	str, err := json.Marshal(content)
+	if err != nil {
+		slog.Error("can't encode JSON", "error", err)
+		return unknownErrorResponse
+	}
+
+	return string(str)
+}
+
+// Map a storage error to the API code and message. Expected errors are
+// logged at debug level, unknown ones as errors.
+func errorExecParse(inputRequest *InputRequest, err error) (int, string) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		inputRequest.log.Debug("not found", "error", err)
+		return 1, "Not exist"
+
+	case errors.Is(err, ErrDuplicate):
+		inputRequest.log.Debug("duplicate", "error", err)
+		return 5, "Exist"
+
+	case errors.Is(err, ErrForeignKey):
+		inputRequest.log.Debug("foreign key", "error", err)
+		return 5, "Exist [Error 1452]"
 	}
-	panic(err.Error()) // proper error handling instead of panic in your app
+
+	inputRequest.log.Error("storage error", "error", err)
+	return 4, "Unknown error"
 }
 
-func createErrorResponse(err error) string {
-	responseCode, msg := errorExecParse(err)
+func createErrorResponse(inputRequest *InputRequest, err error) string {
+	responseCode, msg := errorExecParse(inputRequest, err)
 	errorMessage := &rs.ErrorMsg{
 		Msg: msg,
 	}
@@ -124,19 +162,12 @@ func createInvalidJsonResponse(inputRequest *InputRequest) string {
 		Msg: "Invalid json",
 	}
 
-	log.Println("Invalid JSON:\turl=\tjson=", inputRequest.url, inputRequest.json)
+	inputRequest.log.Info("invalid json", "url", inputRequest.url, "json", inputRequest.json)
 
 	return createResponse(responseCode, errorMessage)
 }
 
-func checkError1062(err error) bool {
-	if driverErr, ok := err.(*mysql.MySQLError); ok { // Now the error number is accessible directly
-		if driverErr.Number == 1062 {
-			return true
-		}
-	}
-	return false
-}
+func checkError1062(err error) bool { return errors.Is(err, ErrDuplicate) }
 
 func createInvalidResponse() string {
 	responseCode := 2
@@ -167,8 +198,8 @@ func becauseAPI() string {
 
 	str, err := json.Marshal(content)
 	if err != nil {
-		log.Println("Error encoding JSON")
-		log.Panic(err)
+		slog.Error("can't encode JSON", "error", err)
+		return unknownErrorResponse
 	}
 
 	return string(str)
@@ -200,6 +231,130 @@ func validateBoolParams(json map[string]interface{}, args *Args, params ...strin
 	return true
 }
 
+// Read order, limit, cursor and the given since params ("since", "since_id") from query
+func (ir *InputRequest) listOptions(defaultOrder string, since ...string) (ListOptions, bool) {
+	opts := ListOptions{Order: defaultOrder, Limit: -1}
+
+	if len(ir.query["cursor"]) >= 1 {
+		after, ok := decodeCursor(ir.query["cursor"][0])
+		if !ok {
+			return opts, false
+		}
+		opts.After = after
+	}
+
+	if stringInSlice("since", since) && len(ir.query["since"]) >= 1 {
+		opts.Since = ir.query["since"][0]
+	}
+	if stringInSlice("since_id", since) && len(ir.query["since_id"]) >= 1 {
+		sinceId, err := strconv.ParseInt(ir.query["since_id"][0], 10, 64)
+		if err != nil {
+			return opts, false
+		}
+		opts.SinceId = sinceId
+	}
+	if len(ir.query["order"]) >= 1 {
+		orderType := ir.query["order"][0]
+		if orderType != "desc" && orderType != "asc" {
+			return opts, false
+		}
+		opts.Order = orderType
+	}
+	if len(ir.query["limit"]) >= 1 {
+		i, err := strconv.Atoi(ir.query["limit"][0])
+		if err != nil || i < 0 {
+			return opts, false
+		}
+		opts.Limit = i
+	}
+
+	return opts, true
+}
+
+// ======================
+// Pages here
+// ======================
+
+// A cursor is the id of the last row of a page, opaque to clients. The
+// store lists the rows after it, see ListOptions.
+func encodeCursor(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("after:" + int64ToString(id)))
+}
+
+func decodeCursor(cursor string) (int64, bool) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || !strings.HasPrefix(string(data), "after:") {
+		return 0, false
+	}
+
+	id, ok := parseId(strings.TrimPrefix(string(data), "after:"))
+	return id, ok && id >= 0
+}
+
+// pager cuts list results into pages. The store is asked for one row more
+// than the limit, that row only tells whether there is a next page.
+type pager struct {
+	limit int // -1 for no limit, no pages then
+	next  *string
+}
+
+// Pager of opts, which are changed to fetch the extra row
+func newPager(opts *ListOptions) *pager {
+	p := &pager{limit: opts.Limit}
+	if opts.Limit >= 0 {
+		opts.Limit++
+	}
+	return p
+}
+
+// Number of the n fetched rows on the page. id gives the id of row i.
+func (p *pager) cut(n int, id func(i int) int64) int {
+	if p.limit < 0 || n <= p.limit {
+		return n
+	}
+
+	// an empty page has no next one, its cursor would not move
+	if p.limit == 0 {
+		return 0
+	}
+
+	next := encodeCursor(id(p.limit - 1))
+	p.next = &next
+	return p.limit
+}
+
+// The list response, with the next cursor when a limit was given
+func (p *pager) response(code int, response []interface{}) string {
+	if p.limit < 0 {
+		return createResponseFromArray(code, response)
+	}
+	if p.next == nil {
+		return createPageFromArray(code, response, nil)
+	}
+	return createPageFromArray(code, response, *p.next)
+}
+
+// The response of an object holding the page, for lists that come with
+// more than their rows
+func (p *pager) objectResponse(code int, response rs.RespStruct) string {
+	if p.limit < 0 {
+		return createResponse(code, response)
+	}
+	if p.next == nil {
+		return createPage(code, response, nil)
+	}
+	return createPage(code, response, *p.next)
+}
+
+// Optional JSON string param, nil for null
+func jsonStringPtr(json map[string]interface{}, key string) *string {
+	if json[key] == nil {
+		return nil
+	}
+	value := json[key].(string)
+	return &value
+}
+
 func clearQuery(query *map[string][]string) {
 	for k := range *query {
 		delete(*query, k)
@@ -234,27 +389,48 @@ func (args *Args) clear() { args.data = args.data[0:0] }
 // Database queries here
 // ======================
 
-type ExecResponse struct {
-	lastId   int64
-	rowCount int64
+// querier is a *sql.DB or a *sql.Tx, so store methods run the same
+// statements inside and outside a unit of work
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
 }
 
-func execQuery(query string, args *[]interface{}, db *sql.DB) (*ExecResponse, error) {
-	resp := new(ExecResponse)
-
+// Run fn in a transaction, commit if it returns nil and roll back on an
+// error or a panic
+func runTx(db *sql.DB, fn func(tx *sql.Tx) error) (err error) {
 	tx, err := db.Begin()
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer tx.Commit()
 
-	stmt, err := tx.Prepare(query)
-	if err != nil {
-		return nil, err
+	defer func() {
+		if failure := recover(); failure != nil {
+			tx.Rollback()
+			panic(failure)
+		}
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err = fn(tx); err != nil {
+		return err
 	}
-	defer stmt.Close()
 
-	res, err := stmt.Exec(*args...)
+	return tx.Commit()
+}
+
+type ExecResponse struct {
+	lastId   int64
+	rowCount int64
+}
+
+func execQuery(query string, args *[]interface{}, db querier) (*ExecResponse, error) {
+	resp := new(ExecResponse)
+
+	res, err := db.Exec(query, *args...)
 	if err != nil {
 		return nil, err
 	}
@@ -275,92 +451,50 @@ func execQuery(query string, args *[]interface{}, db *sql.DB) (*ExecResponse, er
 	return resp, nil
 }
 
-type SelectResponse struct {
-	rows    int
-	columns []string
-	values  []map[string]string
-}
-
-func selectQuery(query string, args *[]interface{}, db *sql.DB) *SelectResponse {
-	resp := new(SelectResponse)
-
-	rows, err := db.Query(query, *args...)
-	if err != nil {
-		log.Panic(err)
-	}
-	defer rows.Close()
-
-	// Get column names
-	columns, err := rows.Columns()
-	if err != nil {
-		log.Panic(err)
-	}
-
-	// Make a slice for the values
-	values := make([]sql.RawBytes, len(columns))
-
-	// rows.Scan wants '[]interface{}' as an argument, so we must copy the
-	// references into such a slice
-	// See http://code.google.com/p/go-wiki/wiki/InterfaceSlice for details
-	scanArgs := make([]interface{}, len(values))
+// =================
+// Utils here
+// =================
 
-	for i := range values {
-		scanArgs[i] = &values[i]
-	}
+func floatToString(inputNum float64) string { return strconv.FormatFloat(inputNum, 'f', 6, 64) }
 
-	var respValues []map[string]string
+func int64ToString(inputNum int64) string { return strconv.FormatInt(inputNum, 10) }
 
-	// Fetch rows
-	for rows.Next() {
-		x := make(map[string]string)
+func checkFloat64Type(inputNum interface{}) bool {
+	_, ok := inputNum.(float64)
+	return ok
+}
 
-		// get RawBytes from data
-		err = rows.Scan(scanArgs...)
-		if err != nil {
-			log.Panic(err)
-		}
+func checkStringType(inputStr interface{}) bool {
+	_, ok := inputStr.(string)
+	return ok
+}
 
-		// Now do something with the data.
-		// Here we just print each column as a string.
-		var value string
-		for i, col := range values {
-			// Here we can check if the value is nil (NULL value)
-			if col == nil {
-				value = "NULL"
-			} else {
-				value = string(col)
-			}
-			x[columns[i]] = value
-			// x = append(x, value)
+// Every one of params in the request json is a string
+func checkStringParams(json map[string]interface{}, params ...string) bool {
+	for _, value := range params {
+		if !checkStringType(json[value]) {
+			return false
 		}
-
-		respValues = append(respValues, x)
 	}
 
-	resp.columns = columns
-	resp.values = respValues
-	resp.rows = len(resp.values)
+	return true
+}
 
-	if err = rows.Err(); err != nil {
-		log.Panic(err)
+// Optional user field of a request, as the voter or the editor
+func userParam(ir *InputRequest) (user *string, ok bool) {
+	if ir.json["user"] == nil {
+		return nil, true
 	}
-
-	return resp
+	if !checkStringType(ir.json["user"]) {
+		return nil, false
+	}
+	email := ir.json["user"].(string)
+	return &email, true
 }
 
-// =================
-// Utils here
-// =================
-
-func floatToString(inputNum float64) string { return strconv.FormatFloat(inputNum, 'f', 6, 64) }
-
-func int64ToString(inputNum int64) string { return strconv.FormatInt(inputNum, 10) }
-
-func checkFloat64Type(inputNum interface{}) bool {
-	if reflect.TypeOf(inputNum).Kind() != reflect.Float64 {
-		return false
-	}
-	return true
+func parseId(inputStr string) (int64, bool) {
+	result, err := strconv.ParseInt(inputStr, 10, 64)
+	return result, err == nil
 }
 
 func stringInSlice(a string, list []string) bool {
@@ -372,16 +506,6 @@ func stringInSlice(a string, list []string) bool {
 	return false
 }
 
-func stringToInt(inputStr string) int {
-	result, err := strconv.Atoi(inputStr)
-	if err != nil {
-		log.Panic(err)
-	}
-	return result
-}
-
-func stringToInt64(inputStr string) int64 { return int64(stringToInt(inputStr)) }
-
 func toBase92(value int) string {
 	BASE92 := ` !"#$&'()*+,-./0123456789:;<=>?@ABCDEFGHIJKLMNOPQRSTUVWXYZ[]^` + "`" + `abcdefghijklmnopqrstuvwxyz{|}~`
 	length := 5
@@ -428,13 +552,3 @@ func fromBase92(value string) int {
 
 	return result
 }
-
-func stringToBool(inputString string) bool {
-	result, err := strconv.ParseBool(inputString)
-
-	if err != nil {
-		log.Panic(err)
-	}
-
-	return result
-}
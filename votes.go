@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+)
+
+// =================
+// Votes here
+// =================
+
+// Vote table of a target, "thread_vote" or "post_vote". Its target column
+// is named as the target.
+func voteTable(target string) (string, error) {
+	if target != "thread" && target != "post" {
+		return "", fmt.Errorf("can't vote on %q", target)
+	}
+	return target + "_vote", nil
+}
+
+// Change of likes, dislikes and points when a vote goes from old to vote,
+// 0 standing for no vote
+func voteDelta(old, vote int) (likes, dislikes, points int) {
+	count := func(v, value int) int {
+		if v == value {
+			return 1
+		}
+		return 0
+	}
+
+	likes = count(vote, 1) - count(old, 1)
+	dislikes = count(vote, -1) - count(old, -1)
+	points = vote - old
+	return likes, dislikes, points
+}
+
+// Votes without a user, off unless -anonymous-votes is set
+var anonymousVotes bool
+
+// Voter and vote of a vote request, 1 or -1, or 0 to take the vote back.
+// A vote without a user is invalid unless anonymousVotes is on; then it is
+// counted every time, 1 or -1.
+func voteParams(ir *InputRequest) (user *string, vote int, ok bool) {
+	if !checkFloat64Type(ir.json["vote"]) {
+		return nil, 0, false
+	}
+	value := ir.json["vote"].(float64)
+
+	user, ok = userParam(ir)
+	if !ok || user == nil && !anonymousVotes {
+		return nil, 0, false
+	}
+
+	switch {
+	case value == 1 || value == -1:
+	case value == 0 && user != nil:
+	default:
+		return nil, 0, false
+	}
+
+	return user, int(value), true
+}
+
+// Votes on a thread or post whose id is in the query param named target
+func listVotes(ir *InputRequest, store Store, target string) string {
+	// Validate query values
+	if len(ir.query[target]) != 1 {
+		return createInvalidResponse()
+	}
+	id, ok := parseId(ir.query[target][0])
+	if !ok {
+		return createInvalidResponse()
+	}
+
+	// Optional params
+	opts, ok := ir.listOptions("desc", "since")
+	if !ok {
+		return createInvalidResponse()
+	}
+	page := newPager(&opts)
+
+	// the target has to exist, an empty list is a target nobody voted on
+	var err error
+	if target == "thread" {
+		_, err = store.GetThread(id)
+	} else {
+		_, err = store.GetPost(id)
+	}
+	if err != nil {
+		return createErrorResponse(ir, err)
+	}
+
+	votes, err := store.ListVotes(target, id, opts)
+	if err != nil {
+		return createErrorResponse(ir, err)
+	}
+
+	votes = votes[:page.cut(len(votes), func(i int) int64 { return votes[i].Id })]
+
+	responseInterface := make([]interface{}, len(votes))
+	for i, v := range votes {
+		responseInterface[i] = v
+	}
+
+	return page.response(0, responseInterface)
+}